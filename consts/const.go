@@ -21,6 +21,8 @@ const (
 	StateMahjongGame
 	StateTexasGame
 	StateLiarGame
+	StateLiarDiceGame
+	StateMatch
 )
 
 type SkillID int
@@ -50,21 +52,107 @@ const (
 	RoomStateWaiting = 1
 	RoomStateRunning = 2
 
-	GameTypeClassic = 1
-	GameTypeLaiZi   = 2
-	GameTypeSkill   = 3
-	GameTypeRunFast = 4
-	GameTypeTexas   = 5
-	GameTypeMahjong = 6
-	GameTypeLiar    = 7
-	GameTypeUno     = 8
+	GameTypeClassic  = 1
+	GameTypeLaiZi    = 2
+	GameTypeSkill    = 3
+	GameTypeRunFast  = 4
+	GameTypeTexas    = 5
+	GameTypeMahjong  = 6
+	GameTypeLiar     = 7
+	GameTypeUno      = 8
+	GameTypeLiarDice = 9
 
 	RobTimeout         = 20 * time.Second
 	PlayTimeout        = 40 * time.Second
 	PlayMahjongTimeout = 30 * time.Second
 	BetTimeout         = 60 * time.Second
+	// TimeBank 每位玩家每局可以动用的额外时间，TurnTimerInterval 广播剩余时间的间隔
+	TimeBank          = 60 * time.Second
+	TurnTimerInterval = 10 * time.Second
+
+	LiarDiceCount = 5
+
+	// MahjongBasePoints 一番的分数，每多一番翻倍，最多 MahjongMaxFan 番
+	MahjongBasePoints = 8
+	MahjongMaxFan     = 6
+	// MahjongAIDelay 电脑玩家出牌前的停顿，方便其他玩家看清
+	MahjongAIDelay = time.Second
+
+	UnoChallengeTimeout = 15 * time.Second
+	UnoJumpInTimeout    = 5 * time.Second
+	UnoTargetScore      = 500
+
+	// MatchRatingWindow 快速匹配初始的分差范围，每等待 MatchWidenInterval 放宽 MatchWindowStep
+	MatchRatingWindow  = 100
+	MatchWindowStep    = 50
+	MatchWidenInterval = 10 * time.Second
+	DefaultRating      = 1500
+	// RatingK Elo 每局积分变化的系数，RatingHistorySize 每位玩家保留的积分记录数
+	RatingK           = 32
+	RatingHistorySize = 50
+	LeaderboardSize   = 20
+
+	// AutoStartCountdown 所有人准备后自动开局的倒计时，ReadyTimeout 房间坐满后未准备玩家的超时时间
+	AutoStartCountdown = 5 * time.Second
+	ReadyTimeout       = 60 * time.Second
+
+	// KickVoteTimeout 投票踢人的时限
+	KickVoteTimeout = 30 * time.Second
+	// RematchTimeout 一局结束后再来一局投票的时限
+	RematchTimeout = 30 * time.Second
+	// RevealDelay 房主开启亮牌时默认的延迟秒数
+	RevealDelay = 30
+
+	// PauseVoteTimeout 投票暂停或继续的时限，MaxPauseDuration 对局最长暂停时间，超过后自动恢复
+	PauseVoteTimeout = 30 * time.Second
+	MaxPauseDuration = 5 * time.Minute
+	// GameLoopJoinTimeout 开局后等待入座玩家离开等待房间的最长时间，超过后事件循环不再等待
+	GameLoopJoinTimeout = 3 * time.Second
+
+	// ChatRateLimit 每个 ChatRateWindow 内最多发言的条数，超过后按 ChatMuteDurations 逐级禁言，ChatStrikeReset 内没有再刷屏则重新计算
+	ChatRateLimit           = 5
+	ChatRateWindow          = 10 * time.Second
+	ChatStrikeReset         = time.Hour
+	ChatWordsReloadInterval = 10 * time.Second
+	// ChatHistorySize 房间保留的最近聊天条数，ChatLogSize 和 ChatLogRetention 为每位玩家保留的聊天记录条数和时间
+	ChatHistorySize  = 20
+	ChatLogSize      = 200
+	ChatLogRetention = 72 * time.Hour
+
+	// RoomKickDuration 被踢出的玩家多久后可以重新加入该房间
+	RoomKickDuration = 30 * time.Minute
+	// ReportCooldown 同一玩家重复举报同一人的间隔，ReportLogSize 保留的举报条数
+	ReportCooldown = 10 * time.Minute
+	ReportLogSize  = 200
+
+	// MaxFriends 每位玩家最多的好友数
+	MaxFriends = 100
+
+	// RoomPageSize 房间列表每页显示的房间数
+	RoomPageSize = 10
+
+	// InviteTTL 邀请码的有效期
+	InviteTTL        = 30 * time.Minute
+	InviteCodeLength = 6
+
+	// AdminTokenAttempts 同一 IP 连续输错管理员口令的次数上限，达到后 AdminTokenLockout 内不再校验口令
+	AdminTokenAttempts = 3
+	AdminTokenLockout  = 10 * time.Minute
+
+	// SupervisorSpectatorDelay 观众开启观察者模式后看到真实手牌的延迟，防止场外报牌
+	SupervisorSpectatorDelay = 30 * time.Second
+
+	// OutboxMaxBytes 每个连接发送队列最多积压的字节数，OutboxStallTimeout 消息多久没有写出算慢客户端，超过任一项就断开连接
+	OutboxMaxBytes     = 1 << 20
+	OutboxStallTimeout = 15 * time.Second
+	// OutboxCoalesceSize 相邻文本消息合并后单个包的最大字节数，OutboxFlushTimeout 主动断开连接前等待队列写完的时间
+	OutboxCoalesceSize = 16 * 1024
+	OutboxFlushTimeout = time.Second
 )
 
+// CodeProfile 玩家资料，接在 core 的消息码之后
+const CodeProfile = 1010
+
 // Room properties.
 const (
 	RoomPropsDotShuffle    = "ds"
@@ -75,8 +163,24 @@ const (
 	RoomPropsChat          = "ct"
 	RoomPropsShowIP        = "ip"
 	RoomPropsJokerAsTarget = "jt"
+	RoomPropsCasual        = "cs"
+	RoomPropsWildOnes      = "wo"
+	RoomPropsSpotOn        = "so"
+	RoomPropsUnoStacking   = "sd"
+	RoomPropsUnoChallenge  = "ch"
+	RoomPropsUnoCall       = "uc"
+	RoomPropsUnoJumpIn     = "ji"
+	RoomPropsUnoTarget     = "ts"
+	RoomPropsSichuan       = "sc"
+	RoomPropsAutoStart     = "ar"
+	RoomPropsUnready       = "ur"
+	RoomPropsRematchSeats  = "rs"
+	RoomPropsReveal        = "rv"
 )
 
+// ChatMuteDurations 刷屏后依次加长的禁言时间
+var ChatMuteDurations = []time.Duration{30 * time.Second, 2 * time.Minute, 10 * time.Minute, time.Hour}
+
 var MnemonicSorted = []int{15, 14, 2, 1, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3}
 
 var RunFastMnemonicSorted = []int{2, 1, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3}
@@ -98,6 +202,7 @@ func NewErr(code int, exit bool, msg string) Error {
 var (
 	ErrorsExist                   = NewErr(1, true, "Exist. ")
 	ErrorsChanClosed              = NewErr(1, true, "Chan closed. ")
+	ErrorsSlowConsumer            = NewErr(1, true, "Connection is too slow to receive messages. ")
 	ErrorsTimeout                 = NewErr(1, false, "Timeout. ")
 	ErrorsInputInvalid            = NewErr(1, false, "Input invalid. ")
 	ErrorsChatUnopened            = NewErr(1, false, "Chat disabled. ")
@@ -118,15 +223,47 @@ var (
 	ErrorsGamePlayersInsufficient = NewErr(1, false, "Game players insufficient. ")
 	ErrorsCannotKickYourself      = NewErr(1, false, "Cannot kick yourself. ")
 	ErrorsPlayerNotInRoom         = NewErr(1, true, "Player not in room. ")
+	ErrorsSupervisorDenied        = NewErr(1, false, "Supervisor mode denied, only admins, spectators or the owner of a casual room can use it. ")
+	ErrorsAdminTokenInvalid       = NewErr(1, false, "Admin token invalid. ")
+	ErrorsAdminTokenLocked        = NewErr(1, false, "Too many invalid admin tokens, please try again later. ")
+	ErrorsDiceBidInvalid          = NewErr(1, false, "Bid invalid, please raise the quantity or the face. ")
+	ErrorsAIUnsupported           = NewErr(1, false, "AI players are only available in Mahjong rooms. ")
+	ErrorsPlayerNotFound          = NewErr(1, false, "Player not found. ")
+	ErrorsVoteInProgress          = NewErr(1, false, "A vote is already in progress. ")
+	ErrorsNoVote                  = NewErr(1, false, "No vote in progress. ")
+	ErrorsVoteDenied              = NewErr(1, false, "Only seated players can vote, and not on their own kick. ")
+	ErrorsNoRematch               = NewErr(1, false, "No rematch vote in progress. ")
+	ErrorsNoGame                  = NewErr(1, false, "No game in progress. ")
+	ErrorsGamePaused              = NewErr(1, false, "Game is paused, input resume to vote for resuming. ")
+	ErrorsGameNotPaused           = NewErr(1, false, "Game is not paused. ")
+	ErrorsNoReply                 = NewErr(1, false, "No one to reply to. ")
+	ErrorsChatFlooding            = NewErr(1, false, "You are sending messages too fast and have been muted for a while. ")
+	ErrorsAdminRequired           = NewErr(1, false, "Only admins can use this command. ")
+	ErrorsReportInvalid           = NewErr(1, false, "Report invalid, e.g. /report <id|name> <reason>. ")
+	ErrorsReportTooOften          = NewErr(1, false, "You have reported this player recently. ")
+	ErrorsBanInvalid              = NewErr(1, false, "Ban invalid, e.g. /ban <id|ip> <duration|perm> <reason>, duration like 30m, 2h or 7d. ")
+	ErrorsBanNotFound             = NewErr(1, false, "Ban not found. ")
+	ErrorsFriendLimit             = NewErr(1, false, "Your friend list is full. ")
+	ErrorsNotFriend               = NewErr(1, false, "Not in your friend list. ")
+	ErrorsFriendNotInRoom         = NewErr(1, false, "Your friend is not in a room. ")
+	ErrorsLeaveRoomFirst          = NewErr(1, false, "Please leave the room first. ")
+	ErrorsRematchDenied           = NewErr(1, false, "Only seated players can vote for a rematch. ")
+	ErrorsSeatDenied              = NewErr(1, false, "Only seated players can change seats while the room is waiting. ")
+	ErrorsSeatInvalid             = NewErr(1, false, "Seat invalid, please choose a seat from 1 to the max players. ")
+	ErrorsSeatTaken               = NewErr(1, false, "Seat is taken, use swap <id> to ask the player to swap seats. ")
+	ErrorsRoomFilterInvalid       = NewErr(1, false, "Room filter invalid, e.g. ls t=1 w f o c sort=id p=2. ")
+	ErrorsInviteInvalid           = NewErr(1, false, "Invite code invalid. ")
+	ErrorsInviteExpired           = NewErr(1, false, "Invite code expired, please ask the room owner for a new one. ")
 	GameTypes                     = map[int]string{
-		GameTypeClassic: "斗地主",
-		GameTypeLaiZi:   "斗地主-癞子版",
-		GameTypeSkill:   "斗地主-大招版",
-		GameTypeRunFast: "跑得快",
-		GameTypeTexas:   "德州扑克",
-		//GameTypeUno:     "Uno",
-		GameTypeMahjong: "Mahjong",
-		GameTypeLiar:    "liar's bar",
+		GameTypeClassic:  "斗地主",
+		GameTypeLaiZi:    "斗地主-癞子版",
+		GameTypeSkill:    "斗地主-大招版",
+		GameTypeRunFast:  "跑得快",
+		GameTypeTexas:    "德州扑克",
+		GameTypeMahjong:  "Mahjong",
+		GameTypeLiar:     "liar's bar",
+		GameTypeLiarDice: "liar's dice",
+		GameTypeUno:      "Uno",
 	}
 	GameTypesIds = []int{
 		GameTypeClassic,
@@ -136,6 +273,20 @@ var (
 		GameTypeTexas,
 		GameTypeMahjong,
 		GameTypeLiar,
+		GameTypeLiarDice,
+		GameTypeUno,
+	}
+	// MatchTableSizes 快速匹配每种玩法凑齐多少人开局
+	MatchTableSizes = map[int]int{
+		GameTypeClassic:  3,
+		GameTypeLaiZi:    3,
+		GameTypeSkill:    3,
+		GameTypeRunFast:  3,
+		GameTypeTexas:    4,
+		GameTypeMahjong:  4,
+		GameTypeLiar:     4,
+		GameTypeLiarDice: 4,
+		GameTypeUno:      4,
 	}
 	RoomStates = map[int]string{
 		RoomStateWaiting: "Waiting",
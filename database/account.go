@@ -0,0 +1,88 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	stringx "strings"
+	"sync"
+
+	modelx "github.com/ratel-online/core/model"
+)
+
+// Account 登录身份对应的账号，同一身份重新连接后沿用账号上的积分、积分记录和生涯统计
+type Account struct {
+	Key  string `json:"key"`
+	Name string `json:"name"` // 最近一次登录时的昵称
+
+	ratings       map[int]int
+	ratingHistory []RatingRecord
+	stats         Stats
+}
+
+var (
+	accountLock sync.Mutex
+	accounts    = map[string]*Account{}
+)
+
+// AccountKey 登录身份，按客户端登录时带的账号 ID 区分，没有 ID 时返回空
+// 服务端不校验账号 ID，需要由可信的登录服务转发；昵称谁都可以冒用，只用昵称登录的玩家不建立可以沿用的账号
+func AccountKey(info *modelx.AuthInfo) string {
+	if info.ID == 0 {
+		return ""
+	}
+	return "id:" + strconv.FormatInt(info.ID, 10)
+}
+
+// loadAccount 取出登录身份的账号，第一次登录时创建
+func loadAccount(key, name string) *Account {
+	accountLock.Lock()
+	defer accountLock.Unlock()
+	a, ok := accounts[key]
+	if !ok {
+		a = &Account{Key: key}
+		accounts[key] = a
+	}
+	a.Name = name
+	return a
+}
+
+// findAccount 按昵称找登录过的账号
+func findAccount(name string) *Account {
+	accountLock.Lock()
+	defer accountLock.Unlock()
+	for _, a := range accounts {
+		if stringx.EqualFold(a.Name, name) {
+			return a
+		}
+	}
+	return nil
+}
+
+// lookupAccount 按玩家 ID 或昵称找账号，玩家 ID 包括已经掉线的连接；昵称先找在线的玩家，再找用账号 ID 登录过的账号
+// 找到的是在线或掉线的玩家时一并返回
+func lookupAccount(key string) (*Account, *Player) {
+	if id, err := strconv.ParseInt(key, 10, 64); err == nil {
+		if p := getPlayer(id); p != nil && !p.ai {
+			return p.Account(), p
+		}
+	}
+	if p := FindPlayer(key); p != nil {
+		return p.Account(), p
+	}
+	return findAccount(key), nil
+}
+
+// temporary 临时账号只在本次连接内有效
+func (a *Account) temporary() bool {
+	return stringx.HasPrefix(a.Key, "player:")
+}
+
+// Account 玩家的账号，电脑玩家和没有账号 ID 的玩家使用只属于自己的临时账号
+func (p *Player) Account() *Account {
+	accountLock.Lock()
+	defer accountLock.Unlock()
+	if p.account == nil {
+		p.account = &Account{Key: fmt.Sprintf("player:%d", p.ID), Name: p.Name}
+	}
+	return p.account
+}
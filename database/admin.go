@@ -0,0 +1,62 @@
+package database
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ratel-online/core/log"
+	"github.com/ratel-online/server/consts"
+)
+
+var adminToken string
+
+// adminAttempt 同一 IP 连续输错口令的次数和锁定到期时间
+type adminAttempt struct {
+	failures int
+	locked   time.Time
+}
+
+var adminAttemptLock sync.Mutex
+var adminAttempts = map[string]*adminAttempt{}
+
+// SetAdminToken 设置管理员口令，为空时不允许任何人成为管理员
+func SetAdminToken(token string) {
+	adminToken = token
+}
+
+// Elevate 使用管理员口令提升权限，同一 IP 连续输错 AdminTokenAttempts 次后锁定一段时间
+func (p *Player) Elevate(token string) error {
+	key := p.IP
+	if key == "" {
+		key = fmt.Sprintf("player:%d", p.ID)
+	}
+	adminAttemptLock.Lock()
+	defer adminAttemptLock.Unlock()
+	attempt, ok := adminAttempts[key]
+	if !ok {
+		attempt = &adminAttempt{}
+		adminAttempts[key] = attempt
+	}
+	if time.Now().Before(attempt.locked) {
+		return consts.ErrorsAdminTokenLocked
+	}
+	if adminToken == "" || subtle.ConstantTimeCompare([]byte(adminToken), []byte(token)) != 1 {
+		attempt.failures++
+		if attempt.failures < consts.AdminTokenAttempts {
+			return consts.ErrorsAdminTokenInvalid
+		}
+		attempt.failures = 0
+		attempt.locked = time.Now().Add(consts.AdminTokenLockout)
+		log.Infof("player %s[%d] from %s entered too many invalid admin tokens\n", p.Name, p.ID, p.IP)
+		return consts.ErrorsAdminTokenLocked
+	}
+	delete(adminAttempts, key)
+	p.admin = true
+	return nil
+}
+
+func (p *Player) IsAdmin() bool {
+	return p.admin
+}
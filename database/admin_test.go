@@ -0,0 +1,31 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/ratel-online/server/consts"
+)
+
+func TestElevate(t *testing.T) {
+	SetAdminToken("secret")
+	defer SetAdminToken("")
+	defer delete(adminAttempts, "10.0.0.8")
+	alice := &Player{ID: 8401, Name: "Alice", IP: "10.0.0.8"}
+	for i := 1; i < consts.AdminTokenAttempts; i++ {
+		if err := alice.Elevate("guess"); err != consts.ErrorsAdminTokenInvalid {
+			t.Fatalf("wrong token should be rejected, err: %v", err)
+		}
+	}
+	// 输错次数用完后同一 IP 暂时不再校验口令，换个连接也一样
+	if err := alice.Elevate("guess"); err != consts.ErrorsAdminTokenLocked {
+		t.Fatalf("too many wrong tokens should lock, err: %v", err)
+	}
+	again := &Player{ID: 8402, Name: "Alice", IP: "10.0.0.8"}
+	if err := again.Elevate("secret"); err != consts.ErrorsAdminTokenLocked || again.IsAdmin() {
+		t.Fatalf("locked ip should not elevate, err: %v", err)
+	}
+	bob := &Player{ID: 8403, Name: "Bob", IP: "10.0.0.9"}
+	if err := bob.Elevate("secret"); err != nil || !bob.IsAdmin() {
+		t.Fatalf("right token should elevate, err: %v", err)
+	}
+}
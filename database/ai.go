@@ -0,0 +1,61 @@
+package database
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/ratel-online/server/consts"
+)
+
+// 电脑玩家使用负数 ID，避免和连接 ID 冲突
+var aiIds int64 = 0
+
+func (p *Player) IsAI() bool {
+	return p.ai
+}
+
+// AddAI 向房间空位加入一个电脑玩家
+func AddAI(roomId int64) (*Player, error) {
+	room := getRoom(roomId)
+	if room == nil {
+		return nil, consts.ErrorsRoomInvalid
+	}
+	room.Lock()
+	defer room.Unlock()
+	if room.State == consts.RoomStateRunning {
+		return nil, consts.ErrorsJoinFailForRoomRunning
+	}
+	if room.Players >= room.MaxPlayers {
+		return nil, consts.ErrorsRoomPlayersIsFull
+	}
+	id := atomic.AddInt64(&aiIds, -1)
+	player := &Player{
+		ID:     id,
+		Name:   fmt.Sprintf("AI-%d", -id),
+		Amount: 2000,
+		RoomID: roomId,
+		Role:   RolePlayer,
+		ai:     true,
+	}
+	store.SetPlayer(player)
+	store.AddRoomPlayer(roomId, id)
+	room.seat(id)
+	room.Players++
+	return player, nil
+}
+
+// removeAIs 房间里只剩电脑玩家时把它们全部移除
+func removeAIs(room *Room) {
+	playersIds := getRoomPlayers(room.ID)
+	for id := range playersIds {
+		if p := getPlayer(id); p == nil || !p.ai {
+			return
+		}
+	}
+	for id := range playersIds {
+		store.DelPlayer(id)
+		store.DelRoomPlayer(room.ID, id)
+		room.unseat(id)
+		room.Players--
+	}
+}
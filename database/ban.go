@@ -0,0 +1,223 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	stringx "strings"
+	"sync"
+	"time"
+
+	"github.com/ratel-online/core/log"
+	"github.com/ratel-online/server/consts"
+)
+
+// 封禁类型
+const (
+	BanAccount = "account"
+	BanIP      = "ip"
+)
+
+// Ban 全服封禁，账号封禁按登录身份生效，IP 封禁按 IP 生效
+type Ban struct {
+	Kind     string    `json:"kind"`
+	Target   string    `json:"target"` // 账号或 IP
+	Name     string    `json:"name"`   // 封禁账号时的昵称，用来展示和解封
+	Reason   string    `json:"reason"`
+	Operator int64     `json:"operator"`
+	Created  time.Time `json:"created"`
+	Expire   time.Time `json:"expire"` // 为零时永久封禁
+}
+
+var (
+	banLock sync.RWMutex
+	bans    = map[string]*Ban{}
+)
+
+func banKey(kind, target string) string {
+	return kind + ":" + target
+}
+
+func (b *Ban) expired(now time.Time) bool {
+	return !b.Expire.IsZero() && now.After(b.Expire)
+}
+
+func (b *Ban) until() string {
+	if b.Expire.IsZero() {
+		return "forever"
+	}
+	return "until " + b.Expire.Format("2006-01-02 15:04")
+}
+
+func (b *Ban) String() string {
+	target := b.Target
+	if b.Name != "" {
+		target = b.Name
+	}
+	return fmt.Sprintf("%s %s banned %s, reason: %s", b.Kind, target, b.until(), b.Reason)
+}
+
+// Err 告知被封禁的玩家封禁原因和期限
+func (b *Ban) Err() error {
+	return consts.NewErr(1, false, fmt.Sprintf("You are banned %s, reason: %s. ", b.until(), b.Reason))
+}
+
+// ParseBanDuration 解析封禁时长，支持 30m、2h、7d，perm 为永久封禁
+func ParseBanDuration(s string) (time.Duration, error) {
+	if s == "perm" {
+		return 0, nil
+	}
+	if days, ok := stringx.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, consts.ErrorsBanInvalid
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, consts.ErrorsBanInvalid
+	}
+	return d, nil
+}
+
+// resolveBan 把玩家 ID、昵称或 IP 解析为封禁对象和展示用的昵称，ip 为 true 时封禁该玩家的 IP
+// 没有账号 ID 的玩家换个昵称就能重新登录，只能封禁 IP；不在线的玩家按昵称找用账号 ID 登录过的账号
+func resolveBan(key string, ip bool) (string, string, string) {
+	if net.ParseIP(key) != nil {
+		return BanIP, key, ""
+	}
+	target := FindPlayer(key)
+	if target == nil {
+		if id, err := strconv.ParseInt(key, 10, 64); err == nil {
+			target = getPlayer(id)
+		}
+	}
+	switch {
+	case target != nil && (ip || target.Account().temporary()):
+		return BanIP, target.IP, ""
+	case target != nil:
+		return BanAccount, target.Account().Key, target.Name
+	case ip:
+		return "", "", ""
+	}
+	if a := findAccount(key); a != nil {
+		return BanAccount, a.Key, a.Name
+	}
+	return "", "", ""
+}
+
+// BanPlayer 管理员封禁账号或 IP，duration 为 0 时永久封禁，在线的玩家会被断开连接
+func BanPlayer(admin *Player, key string, ip bool, duration time.Duration, reason string) (*Ban, error) {
+	if !admin.IsAdmin() {
+		return nil, consts.ErrorsAdminRequired
+	}
+	kind, target, name := resolveBan(key, ip)
+	if target == "" || reason == "" {
+		return nil, consts.ErrorsBanInvalid
+	}
+	if banKey(kind, target) == banKey(BanAccount, admin.Account().Key) || banKey(kind, target) == banKey(BanIP, admin.IP) {
+		return nil, consts.ErrorsCannotKickYourself
+	}
+	ban := &Ban{Kind: kind, Target: target, Name: name, Reason: reason, Operator: admin.ID, Created: time.Now()}
+	if duration > 0 {
+		ban.Expire = ban.Created.Add(duration)
+	}
+	banLock.Lock()
+	bans[banKey(kind, target)] = ban
+	banLock.Unlock()
+	log.Infof("admin %s[%d] %s\n", admin.Name, admin.ID, ban)
+
+	for _, p := range store.Players() {
+		if p.online && p.banned() != nil {
+			_ = p.WriteError(ban.Err())
+			p.disconnect()
+		}
+	}
+	return ban, nil
+}
+
+// Unban 管理员解除封禁，key 为昵称、IP 或在线玩家的 ID
+func Unban(admin *Player, key string) error {
+	if !admin.IsAdmin() {
+		return consts.ErrorsAdminRequired
+	}
+	keys := []string{banKey(BanIP, key)}
+	if p := FindPlayer(key); p != nil {
+		keys = append(keys, banKey(BanAccount, p.Account().Key), banKey(BanIP, p.IP))
+	}
+	banLock.Lock()
+	defer banLock.Unlock()
+	for k, ban := range bans {
+		if ban.Kind == BanAccount && stringx.EqualFold(ban.Name, key) {
+			keys = append(keys, k)
+		}
+	}
+	found := false
+	for _, k := range keys {
+		if ban, ok := bans[k]; ok {
+			log.Infof("admin %s[%d] lifted %s\n", admin.Name, admin.ID, ban)
+			delete(bans, k)
+			found = true
+		}
+	}
+	if !found {
+		return consts.ErrorsBanNotFound
+	}
+	return nil
+}
+
+// CheckBan 返回登录身份或 IP 上生效中的封禁，account 为 AccountKey 返回的身份
+func CheckBan(account, ip string) *Ban {
+	banLock.RLock()
+	defer banLock.RUnlock()
+	now := time.Now()
+	for _, k := range []string{banKey(BanAccount, account), banKey(BanIP, ip)} {
+		if ban, ok := bans[k]; ok && !ban.expired(now) {
+			return ban
+		}
+	}
+	return nil
+}
+
+func (p *Player) banned() *Ban {
+	if p.ai {
+		return nil
+	}
+	return CheckBan(p.Account().Key, p.IP)
+}
+
+func cleanBans() {
+	banLock.Lock()
+	defer banLock.Unlock()
+	now := time.Now()
+	for k, ban := range bans {
+		if ban.expired(now) {
+			delete(bans, k)
+		}
+	}
+}
+
+// SprintBans 生效中的封禁列表
+func SprintBans() string {
+	banLock.RLock()
+	list := make([]*Ban, 0, len(bans))
+	now := time.Now()
+	for _, ban := range bans {
+		if !ban.expired(now) {
+			list = append(list, ban)
+		}
+	}
+	banLock.RUnlock()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Created.Before(list[j].Created)
+	})
+	buf := bytes.Buffer{}
+	buf.WriteString("Bans:\n")
+	for _, ban := range list {
+		buf.WriteString(ban.String() + "\n")
+	}
+	return buf.String()
+}
@@ -0,0 +1,114 @@
+package database
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	modelx "github.com/ratel-online/core/model"
+	"github.com/ratel-online/core/network"
+	"github.com/ratel-online/server/consts"
+)
+
+func TestBan(t *testing.T) {
+	admin := &Player{ID: 7201, Name: "Admin", IP: "10.0.0.1", admin: true}
+	alice := &Player{ID: 7202, Name: "Alice", IP: "10.0.0.2", account: loadAccount("id:7202", "Alice")}
+	newTestStore(t, admin, alice)
+	defer func() { bans = map[string]*Ban{} }()
+	defer delete(accounts, "id:7202")
+
+	if _, err := BanPlayer(alice, "7201", false, 0, "abuse"); err != consts.ErrorsAdminRequired {
+		t.Fatalf("only admins can ban, err: %v", err)
+	}
+	if d, err := ParseBanDuration("7d"); err != nil || d != 7*24*time.Hour {
+		t.Fatalf("7d should be 7 days, got %v err %v", d, err)
+	}
+	ban, err := BanPlayer(admin, "7202", false, time.Hour, "abuse")
+	if err != nil || ban.Kind != BanAccount || ban.Target != alice.Account().Key || ban.Name != "Alice" {
+		t.Fatalf("account should be banned, got %+v err %v", ban, err)
+	}
+	if CheckBan(alice.Account().Key, "10.0.0.9") == nil || alice.banned() == nil {
+		t.Fatalf("ban should match the account on any ip")
+	}
+	if err := allowChat(alice); err == nil {
+		t.Fatalf("banned players should not chat")
+	}
+	room := CreateRoom(7201, consts.GameTypeClassic)
+	defer deleteRoom(room)
+	if err := JoinRoom(room.ID, alice.ID); err == nil {
+		t.Fatalf("banned players should not join rooms")
+	}
+	ban.Expire = time.Now().Add(-time.Second)
+	if CheckBan(alice.Account().Key, "") != nil {
+		t.Fatalf("expired ban should not apply")
+	}
+
+	if _, err := BanPlayer(admin, "7202", true, 0, "alt accounts"); err != nil || CheckBan("name:bob", "10.0.0.2") == nil {
+		t.Fatalf("ip should be banned forever, err: %v", err)
+	}
+	if err := Unban(admin, "10.0.0.2"); err != nil || CheckBan("name:bob", "10.0.0.2") != nil {
+		t.Fatalf("ip ban should be lifted, err: %v", err)
+	}
+
+	// 没有账号 ID 的玩家换个昵称就能重新登录，只能封禁 IP，不在线时也不能按昵称封禁
+	dave := Connected(network.Wrapper(&fakeConn{}), &modelx.AuthInfo{Name: "Dave"})
+	dave.IP = "10.0.0.4"
+	if ban, err := BanPlayer(admin, "Dave", false, 0, "spam"); err != nil || ban.Kind != BanIP || CheckBan("", "10.0.0.4") == nil {
+		t.Fatalf("players without an account id should be ip banned, got %+v err %v", ban, err)
+	}
+	dave.online = false
+	store.DelPlayer(dave.ID)
+	if _, err := BanPlayer(admin, "Dave", false, 0, "spam"); err != consts.ErrorsBanInvalid {
+		t.Fatalf("offline nickname should not be banned, err: %v", err)
+	}
+
+	// 账号封禁按登录身份生效，换了昵称也不能登录，同名的其他身份不受影响
+	info := &modelx.AuthInfo{ID: 7203, Name: "Carol"}
+	defer delete(accounts, AccountKey(info))
+	carol := Connected(network.Wrapper(&fakeConn{}), info)
+	carol.online = false
+	store.DelPlayer(carol.ID)
+	if _, err := BanPlayer(admin, "carol", false, 0, "cheating"); err != nil {
+		t.Fatalf("offline account should be banned by name, err: %v", err)
+	}
+	if CheckBan(AccountKey(&modelx.AuthInfo{ID: 7203, Name: "Caroline"}), "") == nil || CheckBan(AccountKey(&modelx.AuthInfo{ID: 7204, Name: "Carol"}), "") != nil {
+		t.Fatalf("ban should follow the login account")
+	}
+	if err := Unban(admin, "Carol"); err != nil || CheckBan(AccountKey(info), "") != nil {
+		t.Fatalf("account ban should be lifted by name, err: %v", err)
+	}
+}
+
+func TestReport(t *testing.T) {
+	alice := &Player{ID: 7211, Name: "Alice"}
+	bob := &Player{ID: 7212, Name: "Bob", account: loadAccount("id:7212", "Bob")}
+	newTestStore(t, alice, bob)
+	defer func() { reports = reports[:0] }()
+	defer delete(accounts, "id:7212")
+	defer delete(chatLogs, "id:7212")
+	if err := ReportPlayer(alice, "7211", "spam"); err != consts.ErrorsReportInvalid {
+		t.Fatalf("should not report yourself, err: %v", err)
+	}
+	if err := ReportPlayer(alice, "7212", "spam"); err != nil {
+		t.Fatalf("report should be accepted, err: %v", err)
+	}
+	if err := ReportPlayer(alice, "7212", "spam again"); err != consts.ErrorsReportTooOften {
+		t.Fatalf("repeated report should be rejected, err: %v", err)
+	}
+
+	// 举报和聊天记录按账号保存，被举报的玩家换了连接也算同一人，不在线时按昵称找账号
+	recordChat(bob, ChannelLobby, 0, 0, "buy gold")
+	bob.online = false
+	again := &Player{ID: 7213, Name: "Bob", online: true, account: loadAccount("id:7212", "Bob")}
+	store.SetPlayer(again)
+	if err := ReportPlayer(alice, "7213", "spam again"); err != consts.ErrorsReportTooOften {
+		t.Fatalf("reconnecting should not reset the cooldown, err: %v", err)
+	}
+	again.online = false
+	if log, err := SprintChatLog("bob"); err != nil || !strings.Contains(log, "buy gold") {
+		t.Fatalf("chat log should follow the account, got %q err %v", log, err)
+	}
+	if err := ReportPlayer(&Player{ID: 7214, Name: "Carol"}, "bob", "spam"); err != nil || reports[len(reports)-1].TargetKey != "id:7212" {
+		t.Fatalf("offline accounts should be reported by name, err: %v", err)
+	}
+}
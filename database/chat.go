@@ -0,0 +1,250 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	stringx "strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ratel-online/core/log"
+	"github.com/ratel-online/core/util/async"
+	"github.com/ratel-online/core/util/strings"
+	"github.com/ratel-online/server/consts"
+)
+
+// 聊天频道
+const (
+	ChannelRoom      = "room"
+	ChannelSpectator = "spectator"
+	ChannelLobby     = "lobby"
+	ChannelWhisper   = "whisper"
+)
+
+// ChatRecord 一条聊天记录，保留原文供管理员核查
+type ChatRecord struct {
+	Time    time.Time `json:"time"`
+	Channel string    `json:"channel"`
+	RoomID  int64     `json:"roomId"`
+	To      int64     `json:"to"`
+	Msg     string    `json:"msg"`
+}
+
+// chatLimiter 玩家的发言频率和禁言状态
+type chatLimiter struct {
+	sent       []time.Time
+	strikes    int
+	lastStrike time.Time
+	mutedUntil time.Time
+}
+
+var (
+	chatLock   sync.Mutex
+	chatLogs   = map[string][]ChatRecord{} // 按账号保存，重新连接后仍然可以查到
+	wordsLock  sync.RWMutex
+	blockWords *regexp.Regexp // 运营配置的屏蔽词，没有配置时为 nil
+)
+
+// SetChatWordsFile 加载运营配置的屏蔽词文件，每行一个词，# 开头为注释，文件修改后自动重新加载
+func SetChatWordsFile(path string) {
+	if path == "" {
+		return
+	}
+	modTime := time.Time{}
+	reload := func() {
+		info, err := os.Stat(path)
+		if err != nil {
+			log.Errorf("stat chat words file %s failed: %v\n", path, err)
+			return
+		}
+		if !info.ModTime().After(modTime) {
+			return
+		}
+		modTime = info.ModTime()
+		if err := loadChatWords(path); err != nil {
+			log.Errorf("load chat words file %s failed: %v\n", path, err)
+		}
+	}
+	reload()
+	async.Async(func() {
+		for {
+			time.Sleep(consts.ChatWordsReloadInterval)
+			reload()
+		}
+	})
+}
+
+func loadChatWords(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	words := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		word := stringx.TrimSpace(scanner.Text())
+		if word == "" || stringx.HasPrefix(word, "#") {
+			continue
+		}
+		words = append(words, regexp.QuoteMeta(word))
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	setChatWords(words)
+	log.Infof("loaded %d chat words from %s\n", len(words), path)
+	return nil
+}
+
+func setChatWords(words []string) {
+	var re *regexp.Regexp
+	if len(words) > 0 {
+		re = regexp.MustCompile("(?i)" + stringx.Join(words, "|"))
+	}
+	wordsLock.Lock()
+	defer wordsLock.Unlock()
+	blockWords = re
+}
+
+// filterChat 先用内置的词表脱敏，再把运营配置的屏蔽词替换成星号
+func filterChat(msg string) string {
+	msg = strings.Desensitize(msg)
+	wordsLock.RLock()
+	re := blockWords
+	wordsLock.RUnlock()
+	if re != nil {
+		msg = re.ReplaceAllStringFunc(msg, func(word string) string {
+			return stringx.Repeat("*", utf8.RuneCountInString(word))
+		})
+	}
+	return msg
+}
+
+// allowChat 检查封禁和发言频率，超过限制后禁言，多次刷屏禁言时间逐级加长，电脑玩家不受限制
+func allowChat(player *Player) error {
+	if player.ai {
+		return nil
+	}
+	if ban := player.banned(); ban != nil {
+		return ban.Err()
+	}
+	chatLock.Lock()
+	defer chatLock.Unlock()
+	now := time.Now()
+	limiter := &player.chat
+	remain := limiter.mutedUntil.Sub(now)
+	if remain <= 0 {
+		if !limiter.lastStrike.IsZero() && now.Sub(limiter.lastStrike) > consts.ChatStrikeReset {
+			limiter.strikes = 0
+		}
+		sent := limiter.sent[:0]
+		for _, t := range limiter.sent {
+			if now.Sub(t) < consts.ChatRateWindow {
+				sent = append(sent, t)
+			}
+		}
+		limiter.sent = append(sent, now)
+		if len(limiter.sent) > consts.ChatRateLimit {
+			mutes := consts.ChatMuteDurations
+			remain = mutes[min(limiter.strikes, len(mutes)-1)]
+			limiter.strikes++
+			limiter.lastStrike = now
+			limiter.mutedUntil = now.Add(remain)
+			limiter.sent = nil
+		}
+	}
+	if remain > 0 {
+		return consts.ErrorsChatFlooding
+	}
+	return nil
+}
+
+// recordChat 保留玩家的聊天原文，超过数量或保留时间的记录会被清理
+func recordChat(player *Player, channel string, roomId, to int64, msg string) {
+	chatLock.Lock()
+	defer chatLock.Unlock()
+	key := player.Account().Key
+	records := append(chatLogs[key], ChatRecord{
+		Time:    time.Now(),
+		Channel: channel,
+		RoomID:  roomId,
+		To:      to,
+		Msg:     stringx.TrimSpace(msg),
+	})
+	if len(records) > consts.ChatLogSize {
+		records = records[len(records)-consts.ChatLogSize:]
+	}
+	chatLogs[key] = records
+}
+
+func cleanChatLogs() {
+	chatLock.Lock()
+	defer chatLock.Unlock()
+	deadline := time.Now().Add(-consts.ChatLogRetention)
+	for key, records := range chatLogs {
+		i := 0
+		for i < len(records) && records[i].Time.Before(deadline) {
+			i++
+		}
+		if i == len(records) {
+			delete(chatLogs, key)
+		} else {
+			chatLogs[key] = records[i:]
+		}
+	}
+}
+
+// ChatLog 账号保留的聊天记录，供管理员核查
+func ChatLog(account string) []ChatRecord {
+	chatLock.Lock()
+	defer chatLock.Unlock()
+	return append([]ChatRecord{}, chatLogs[account]...)
+}
+
+// SprintChatLog 按玩家 ID 或昵称找到账号，格式化账号的聊天记录
+func SprintChatLog(key string) (string, error) {
+	account, _ := lookupAccount(key)
+	if account == nil {
+		return "", consts.ErrorsPlayerNotFound
+	}
+	buf := bytes.Buffer{}
+	buf.WriteString(fmt.Sprintf("Chat log of %s:\n", account.Name))
+	for _, r := range ChatLog(account.Key) {
+		target := ""
+		if r.To != 0 {
+			target = " to " + playerName(r.To)
+		} else if r.RoomID != 0 {
+			target = fmt.Sprintf(" in room %d", r.RoomID)
+		}
+		buf.WriteString(fmt.Sprintf("%s [%s]%s: %s\n", r.Time.Format("01-02 15:04:05"), r.Channel, target, r.Msg))
+	}
+	return buf.String(), nil
+}
+
+// addChatHistory 房间保留最近的聊天，后加入的玩家可以看到
+func addChatHistory(room *Room, msg string) {
+	room.chatHistory = append(room.chatHistory, msg)
+	if len(room.chatHistory) > consts.ChatHistorySize {
+		room.chatHistory = room.chatHistory[len(room.chatHistory)-consts.ChatHistorySize:]
+	}
+}
+
+// ChatHistory 房间最近的聊天记录
+func ChatHistory(room *Room) string {
+	room.Lock()
+	defer room.Unlock()
+	if len(room.chatHistory) == 0 {
+		return ""
+	}
+	buf := bytes.Buffer{}
+	buf.WriteString("Recent chat:\n")
+	for _, msg := range room.chatHistory {
+		buf.WriteString(msg)
+	}
+	return buf.String()
+}
@@ -0,0 +1,54 @@
+package database
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ratel-online/server/consts"
+)
+
+func TestChatFilter(t *testing.T) {
+	setChatWords([]string{"spam"})
+	defer setChatWords(nil)
+	if msg := filterChat("buy SPAM now"); msg != "buy **** now" {
+		t.Fatalf("blocked words should be masked, got %q", msg)
+	}
+}
+
+func TestChatFlooding(t *testing.T) {
+	player := &Player{ID: 7101}
+	defer delete(chatLogs, player.Account().Key)
+	for i := 0; i < consts.ChatRateLimit; i++ {
+		if err := allowChat(player); err != nil {
+			t.Fatalf("message %d should be allowed, err: %v", i, err)
+		}
+	}
+	if err := allowChat(player); err != consts.ErrorsChatFlooding {
+		t.Fatalf("player should be muted for flooding, err: %v", err)
+	}
+	if player.chat.strikes != 1 || player.chat.mutedUntil.IsZero() {
+		t.Fatalf("flooding should count a strike, got %+v", player.chat)
+	}
+	player.chat.mutedUntil = player.chat.mutedUntil.Add(-consts.ChatMuteDurations[0])
+	for i := 0; i <= consts.ChatRateLimit; i++ {
+		_ = allowChat(player)
+	}
+	if remain := player.chat.mutedUntil.Sub(player.chat.lastStrike); remain != consts.ChatMuteDurations[1] {
+		t.Fatalf("second strike should mute longer, got %v", remain)
+	}
+
+	for i := 0; i < consts.ChatLogSize+5; i++ {
+		recordChat(player, ChannelLobby, 0, 0, "hi")
+	}
+	if n := len(ChatLog(player.Account().Key)); n != consts.ChatLogSize {
+		t.Fatalf("chat log should be capped, got %d", n)
+	}
+
+	room := &Room{}
+	for i := 0; i < consts.ChatHistorySize+5; i++ {
+		addChatHistory(room, "hi\n")
+	}
+	if n := strings.Count(ChatHistory(room), "hi\n"); n != consts.ChatHistorySize {
+		t.Fatalf("chat history should be capped, got %d", n)
+	}
+}
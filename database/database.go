@@ -7,7 +7,6 @@ import (
 	"sync/atomic"
 	"time"
 
-	"github.com/awesome-cap/hashmap"
 	"github.com/ratel-online/core/log"
 	modelx "github.com/ratel-online/core/model"
 	"github.com/ratel-online/core/network"
@@ -18,12 +17,6 @@ import (
 )
 
 var roomIds int64 = 0
-var players = hashmap.New() // 存储连接过服务器的全部用户
-var connPlayers = hashmap.New()
-var rooms = hashmap.New()
-var roomPlayers = hashmap.New()
-var roomSpectators = hashmap.New()
-var roomKickedPlayers = hashmap.New()
 var roomPropsSetter = map[string]func(r *Room, v string){
 	consts.RoomPropsSkill: func(r *Room, v string) {
 		r.EnableSkill = v == "on"
@@ -37,9 +30,9 @@ var roomPropsSetter = map[string]func(r *Room, v string){
 	},
 	consts.RoomPropsPassword: func(r *Room, v string) {
 		if v == "off" {
-			r.Password = ""
+			r.ClearPassword()
 		} else {
-			r.Password = v
+			r.SetPassword(v)
 		}
 	},
 	consts.RoomPropsChat: func(r *Room, v string) {
@@ -58,6 +51,69 @@ var roomPropsSetter = map[string]func(r *Room, v string){
 	consts.RoomPropsJokerAsTarget: func(r *Room, v string) {
 		r.EnableJokerAsTarget = v == "on"
 	},
+	consts.RoomPropsCasual: func(r *Room, v string) {
+		r.EnableCasual = v == "on"
+	},
+	consts.RoomPropsWildOnes: func(r *Room, v string) {
+		r.EnableWildOnes = v == "on"
+	},
+	consts.RoomPropsSpotOn: func(r *Room, v string) {
+		r.EnableSpotOn = v == "on"
+	},
+	consts.RoomPropsUnoStacking: func(r *Room, v string) {
+		r.EnableUnoStacking = v == "on"
+	},
+	consts.RoomPropsUnoChallenge: func(r *Room, v string) {
+		r.EnableUnoChallenge = v == "on"
+	},
+	consts.RoomPropsUnoCall: func(r *Room, v string) {
+		r.EnableUnoCall = v == "on"
+	},
+	consts.RoomPropsUnoJumpIn: func(r *Room, v string) {
+		r.EnableUnoJumpIn = v == "on"
+	},
+	consts.RoomPropsSichuan: func(r *Room, v string) {
+		r.EnableSichuan = v == "on"
+	},
+	consts.RoomPropsAutoStart: func(r *Room, v string) {
+		r.EnableAutoStart = v == "on"
+	},
+	consts.RoomPropsUnready: func(r *Room, v string) {
+		switch v {
+		case UnreadyKick, UnreadySpectate:
+			r.UnreadyPolicy = v
+		default:
+			r.UnreadyPolicy = ""
+		}
+	},
+	consts.RoomPropsRematchSeats: func(r *Room, v string) {
+		switch v {
+		case RematchRotate, RematchBanker:
+			r.RematchSeats = v
+		default:
+			r.RematchSeats = RematchKeep
+		}
+	},
+	consts.RoomPropsReveal: func(r *Room, v string) {
+		// on 使用默认延迟，数字为延迟秒数
+		n, err := strconv.Atoi(v)
+		switch {
+		case v == "on":
+			r.EnableReveal, r.RevealDelay = true, consts.RevealDelay
+		case err == nil && n >= 0:
+			r.EnableReveal, r.RevealDelay = true, n
+		default:
+			r.EnableReveal = false
+		}
+	},
+	consts.RoomPropsUnoTarget: func(r *Room, v string) {
+		// off 表示只打一局
+		n, _ := strconv.Atoi(v)
+		if n < 0 {
+			n = 0
+		}
+		r.UnoTargetScore = n
+	},
 }
 
 func init() {
@@ -69,9 +125,12 @@ func init() {
 				log.Infof("[database.init] Room cleanup loop count: %d (running for %d hours)\n", loopCount, loopCount/60)
 			}
 			time.Sleep(1 * time.Minute)
-			rooms.Foreach(func(e *hashmap.Entry) {
-				roomCancel(e.Value().(*Room))
-			})
+			for _, room := range store.Rooms() {
+				roomCancel(room)
+			}
+			cleanInvites()
+			cleanChatLogs()
+			cleanBans()
 		}
 	})
 }
@@ -83,9 +142,13 @@ func Connected(conn *network.Conn, info *modelx.AuthInfo) *Player {
 		Name:   strings.Desensitize(info.Name),
 		Amount: 2000,
 	}
-	player.Conn(conn)                  // 初始化play对象
-	players.Set(conn.ID(), player)     // 写入用户池
-	connPlayers.Set(conn.ID(), player) // 写入连接用户池
+	if key := AccountKey(info); key != "" {
+		player.account = loadAccount(key, player.Name)
+	}
+	player.Conn(conn)       // 初始化play对象
+	store.SetPlayer(player) // 写入用户池
+	renameFriend(player)
+	notifyFriends(player, "[friend] "+player.Name+" is online\n")
 	return player
 }
 
@@ -100,6 +163,7 @@ func CreateRoom(creator int64, t int) *Room {
 		EnableLandlord: true,
 		EnableChat:     true,
 		EnableShowIP:   false,
+		RematchSeats:   RematchKeep,
 	}
 	switch room.Type {
 	case consts.GameTypeLaiZi:
@@ -119,18 +183,37 @@ func CreateRoom(creator int64, t int) *Room {
 	case consts.GameTypeLiar:
 		room.MaxPlayers = 4
 		room.EnableJokerAsTarget = true
+	case consts.GameTypeLiarDice:
+		room.MaxPlayers = 6
+		room.EnableWildOnes = true
+	case consts.GameTypeMahjong:
+		room.MaxPlayers = 4
+	case consts.GameTypeUno:
+		room.MaxPlayers = 4
+		room.EnableUnoStacking = true
+		room.EnableUnoChallenge = true
+		room.EnableUnoCall = true
+		room.UnoTargetScore = consts.UnoTargetScore
 	}
-	roomPlayers.Set(room.ID, map[int64]bool{})
-	roomSpectators.Set(room.ID, map[int64]int{})
-	rooms.Set(room.ID, room)
+	store.SetRoom(room)
 	return room
 }
 
 func deleteRoom(room *Room) {
 	if room != nil {
-		rooms.Del(room.ID)
-		roomPlayers.Del(room.ID)
-		roomSpectators.Del(room.ID)
+		for id := range getRoomPlayers(room.ID) {
+			if p := getPlayer(id); p != nil && p.ai {
+				store.DelPlayer(id)
+			}
+		}
+		revokeInvite(room)
+		store.DelRoom(room.ID)
+		if room.timer != nil {
+			room.timer.stopTurn()
+		}
+		if room.loop != nil {
+			room.loop.end()
+		}
 		if room.Game != nil {
 			room.Game.Clean()
 		}
@@ -138,14 +221,7 @@ func deleteRoom(room *Room) {
 }
 
 func GetRooms() []*Room {
-	list := make([]*Room, 0)
-	rooms.Foreach(func(e *hashmap.Entry) {
-		list = append(list, e.Value().(*Room))
-	})
-	sort.Slice(list, func(i, j int) bool {
-		return list[i].ID < list[j].ID
-	})
-	return list
+	return store.Rooms()
 }
 
 func GetRoom(roomId int64) *Room {
@@ -153,17 +229,11 @@ func GetRoom(roomId int64) *Room {
 }
 
 func getRoom(roomId int64) *Room {
-	if v, ok := rooms.Get(roomId); ok {
-		return v.(*Room)
-	}
-	return nil
+	return store.GetRoom(roomId)
 }
 
 func getPlayer(playerId int64) *Player {
-	if v, ok := players.Get(playerId); ok {
-		return v.(*Player)
-	}
-	return nil
+	return store.GetPlayer(playerId)
 }
 
 func SetRoomProps(room *Room, k, v string) {
@@ -171,7 +241,7 @@ func SetRoomProps(room *Room, k, v string) {
 	allowedProps := getAllowedPropsByGameType(room.Type)
 
 	// 检查属性是否允许设置
-	if !allowedProps[k] {
+	if !allowedProps[k] && !commonRoomProps[k] {
 		return // 不允许的属性直接返回，不执行设置
 	}
 
@@ -180,20 +250,49 @@ func SetRoomProps(room *Room, k, v string) {
 	}
 }
 
+// 所有玩法都能设置的属性
+var commonRoomProps = map[string]bool{
+	consts.RoomPropsAutoStart:    true,
+	consts.RoomPropsUnready:      true,
+	consts.RoomPropsRematchSeats: true,
+	consts.RoomPropsReveal:       true,
+}
+
 // 根据游戏类型返回允许设置的属性列表
 func getAllowedPropsByGameType(gameType int) map[string]bool {
 	switch gameType {
 	case consts.GameTypeLiar:
-		// 对于骗子酒馆，只允许设置指示牌规则和显示IP
+		// 对于骗子酒馆，只允许设置指示牌规则、休闲模式和显示IP
 		return map[string]bool{
 			consts.RoomPropsJokerAsTarget: true,
 			consts.RoomPropsShowIP:        true,
+			consts.RoomPropsCasual:        true,
+		}
+	case consts.GameTypeLiarDice:
+		// 对于大话骰，允许设置一点万能、劈、玩家数量和显示IP
+		return map[string]bool{
+			consts.RoomPropsWildOnes:  true,
+			consts.RoomPropsSpotOn:    true,
+			consts.RoomPropsPlayerNum: true,
+			consts.RoomPropsShowIP:    true,
 		}
-	case consts.GameTypeUno, consts.GameTypeMahjong:
-		// 对于Uno和麻将，允许设置玩家数量和显示IP
+	case consts.GameTypeUno:
+		// 对于Uno，允许设置各项房规、目标分数、玩家数量和显示IP
 		return map[string]bool{
+			consts.RoomPropsUnoStacking:  true,
+			consts.RoomPropsUnoChallenge: true,
+			consts.RoomPropsUnoCall:      true,
+			consts.RoomPropsUnoJumpIn:    true,
+			consts.RoomPropsUnoTarget:    true,
+			consts.RoomPropsPlayerNum:    true,
+			consts.RoomPropsShowIP:       true,
+		}
+	case consts.GameTypeMahjong:
+		// 对于麻将，允许设置血战玩法、玩家数量和显示IP
+		return map[string]bool{
+			consts.RoomPropsSichuan:   true,
 			consts.RoomPropsPlayerNum: true,
-			consts.RoomPropsShowIP: true,
+			consts.RoomPropsShowIP:    true,
 		}
 	case consts.GameTypeTexas:
 		// 对于德州扑克，允许设置玩家数量和显示IP
@@ -217,17 +316,11 @@ func getAllowedPropsByGameType(gameType int) map[string]bool {
 }
 
 func getRoomPlayers(roomId int64) map[int64]bool {
-	if v, ok := roomPlayers.Get(roomId); ok {
-		return v.(map[int64]bool)
-	}
-	return nil
+	return store.RoomPlayers(roomId)
 }
 
 func getRoomSpectators(roomId int64) map[int64]int {
-	if v, ok := roomSpectators.Get(roomId); ok {
-		return v.(map[int64]int)
-	}
-	return nil
+	return store.RoomSpectators(roomId)
 }
 
 func IsValidPlayer(roomId, playerId int64) bool {
@@ -270,6 +363,9 @@ func JoinRoom(roomId, playerId int64) error {
 	room.Lock()
 	defer room.Unlock()
 
+	if ban := player.banned(); ban != nil {
+		return ban.Err()
+	}
 	if hasKicked(roomId, playerId) {
 		return consts.ErrorsJoinFailForKicked
 	}
@@ -278,13 +374,12 @@ func JoinRoom(roomId, playerId int64) error {
 
 	//房间人数及状态检查
 	if room.Players >= room.MaxPlayers || room.State == consts.RoomStateRunning {
-		spectatorsIds := getRoomSpectators(roomId)
-		spectatorsIds[playerId] = len(spectatorsIds)
+		store.AddRoomSpectator(roomId, playerId)
 		player.RoomID = roomId
 		player.Role = RoleSpectator
 	} else {
-		playersIds := getRoomPlayers(roomId)
-		playersIds[playerId] = true
+		store.AddRoomPlayer(roomId, playerId)
+		room.seat(playerId)
 		room.Players++
 		player.RoomID = roomId
 		player.Role = RolePlayer
@@ -319,30 +414,15 @@ func backfill(room *Room) *Player {
 	if room.Players >= room.MaxPlayers {
 		return nil
 	}
-	spectatorsIds := getRoomSpectators(room.ID)
-	if len(spectatorsIds) == 0 {
+	queue := spectatorQueue(room.ID)
+	if len(queue) == 0 {
 		return nil
 	}
-	spectators := make([]struct {
-		id    int64
-		index int
-	}, 0)
-
-	for id, index := range spectatorsIds {
-		spectators = append(spectators, struct {
-			id    int64
-			index int
-		}{id: id, index: index})
-	}
-	sort.Slice(spectators, func(i, j int) bool {
-		return spectators[i].index < spectators[j].index
-	})
-
-	playerId := spectators[0].id
+	playerId := queue[0]
 
-	delete(spectatorsIds, playerId)
-	playersIds := getRoomPlayers(room.ID)
-	playersIds[playerId] = true
+	store.DelRoomSpectator(room.ID, playerId)
+	store.AddRoomPlayer(room.ID, playerId)
+	room.seat(playerId)
 	room.Players++
 	player := getPlayer(playerId)
 	if player != nil {
@@ -351,29 +431,32 @@ func backfill(room *Room) *Player {
 	return player
 }
 
+// spectatorQueue 按排队顺序返回观众
+func spectatorQueue(roomId int64) []int64 {
+	spectatorsIds := getRoomSpectators(roomId)
+	queue := make([]int64, 0, len(spectatorsIds))
+	for id := range spectatorsIds {
+		queue = append(queue, id)
+	}
+	sort.Slice(queue, func(i, j int) bool {
+		return spectatorsIds[queue[i]] < spectatorsIds[queue[j]]
+	})
+	return queue
+}
+
 func Kicking(roomId, playerId int64) {
 	room := getRoom(roomId)
 	if room != nil {
 		room.Lock()
 		defer room.Unlock()
 		leaveRoom(room, getPlayer(playerId))
-
-		kickedPlayers, ok := roomKickedPlayers.Get(roomId)
-		if !ok {
-			kickedPlayers = map[int64]bool{}
-			roomKickedPlayers.Set(roomId, kickedPlayers)
-		}
-		kickedPlayers.(map[int64]bool)[playerId] = true
+		store.KickPlayer(roomId, playerId, time.Now().Add(consts.RoomKickDuration))
 	}
 }
 
+// hasKicked 被踢出的玩家在 RoomKickDuration 内不能重新加入，调用时需持有房间锁
 func hasKicked(roomId, playerId int64) bool {
-	kickedPlayers, ok := roomKickedPlayers.Get(roomId)
-	if !ok {
-		return false
-	}
-	_, exists := kickedPlayers.(map[int64]bool)[playerId]
-	return exists
+	return store.Kicked(roomId, playerId)
 }
 
 func leaveRoom(room *Room, player *Player) {
@@ -381,33 +464,42 @@ func leaveRoom(room *Room, player *Player) {
 		return
 	}
 	room.ActiveTime = time.Now()
-	playersIds := getRoomPlayers(room.ID)
-	if _, ok := playersIds[player.ID]; ok {
+	if _, ok := getRoomPlayers(room.ID)[player.ID]; ok {
 		room.Players--
 		player.RoomID = 0
 		player.Role = ""
-		delete(playersIds, player.ID)
-		if len(playersIds) > 0 && room.Creator == player.ID {
-			for k := range playersIds {
-				room.Creator = k
-				if p := getPlayer(k); p != nil {
-					p.Role = RoleOwner
-				}
-				break
-			}
+		store.DelRoomPlayer(room.ID, player.ID)
+		delete(room.ready, player.ID)
+		room.unseat(player.ID)
+		if player.ai {
+			store.DelPlayer(player.ID)
+		}
+		removeAIs(room)
+		if room.Creator == player.ID {
+			passOwnership(room)
 		}
 	}
-	spectatorsIds := getRoomSpectators(room.ID)
-	if _, ok := spectatorsIds[player.ID]; ok {
+	if _, ok := getRoomSpectators(room.ID)[player.ID]; ok {
 		player.RoomID = 0
 		player.Role = ""
-		delete(spectatorsIds, player.ID)
+		store.DelRoomSpectator(room.ID, player.ID)
 	}
-	if len(playersIds) == 0 && len(spectatorsIds) == 0 {
+	if len(getRoomPlayers(room.ID)) == 0 && len(getRoomSpectators(room.ID)) == 0 {
 		deleteRoom(room)
 	}
 }
 
+// passOwnership 房主离座后按座位顺序由其他入座的玩家接任房主，不会交给电脑玩家
+func passOwnership(room *Room) {
+	for _, k := range room.seats {
+		if p := getPlayer(k); p != nil && !p.ai {
+			room.Creator = k
+			p.Role = RoleOwner
+			return
+		}
+	}
+}
+
 func roomCancel(room *Room) {
 	if room.ActiveTime.Add(24 * time.Hour).Before(time.Now()) {
 		log.Infof("room %d is timeout 24 hours, removed.\n", room.ID)
@@ -459,6 +551,7 @@ func broadcast(room *Room, msg string, exclude ...int64) {
 			_ = player.WriteString(">> " + msg)
 		}
 	}
+	refreshTable(room)
 }
 
 func Broadcast(roomId int64, msg string, exclude ...int64) {
@@ -471,7 +564,44 @@ func Broadcast(roomId int64, msg string, exclude ...int64) {
 
 func BroadcastChat(player *Player, msg string, exclude ...int64) {
 	log.Infof("chat msg, player %s[%d] %s say: %s\n", player.Name, player.ID, player.IP, stringx.TrimSpace(msg))
-	Broadcast(player.RoomID, strings.Desensitize(msg), exclude...)
+	room := getRoom(player.RoomID)
+	if room == nil {
+		return
+	}
+	if err := allowChat(player); err != nil {
+		_ = player.WriteError(err)
+		return
+	}
+	recordChat(player, ChannelRoom, room.ID, 0, msg)
+	msg = filterChat(msg)
+	room.Lock()
+	addChatHistory(room, msg)
+	room.Unlock()
+	broadcast(room, msg, append(exclude, mutedBy(room, player.ID)...)...)
+}
+
+// BroadcastSpectatorChat 游戏中观众的聊天只发给其他观众
+func BroadcastSpectatorChat(player *Player, msg string) {
+	log.Infof("spectator chat msg, player %s[%d] %s say: %s\n", player.Name, player.ID, player.IP, stringx.TrimSpace(msg))
+	room := getRoom(player.RoomID)
+	if room == nil {
+		return
+	}
+	if err := allowChat(player); err != nil {
+		_ = player.WriteError(err)
+		return
+	}
+	recordChat(player, ChannelSpectator, room.ID, 0, msg)
+	muted := map[int64]bool{}
+	for _, id := range mutedBy(room, player.ID) {
+		muted[id] = true
+	}
+	msg = filterChat(msg)
+	for id := range getRoomSpectators(room.ID) {
+		if p := getPlayer(id); p != nil && !muted[id] {
+			_ = p.WriteString(">> " + msg)
+		}
+	}
 }
 
 func BroadcastObject(roomId int64, object interface{}, exclude ...int64) {
@@ -0,0 +1,185 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	stringx "strings"
+	"sync"
+
+	"github.com/ratel-online/server/consts"
+)
+
+// 好友列表按登录身份保存，好友改了昵称或重新连接后仍然有效
+var (
+	friendLock sync.RWMutex
+	friends    = map[string]map[string]string{} // 账号 -> 好友的账号 -> 好友最近的昵称
+)
+
+func friendKey(name string) string {
+	return stringx.ToLower(name)
+}
+
+// AddFriend 按 ID 或昵称添加在线玩家为好友，对方会收到通知
+func AddFriend(player *Player, key string) (*Player, error) {
+	target := FindPlayer(key)
+	if target == nil || target.Account().Key == player.Account().Key {
+		return nil, consts.ErrorsPlayerNotFound
+	}
+	friendLock.Lock()
+	list, ok := friends[player.Account().Key]
+	if !ok {
+		list = map[string]string{}
+		friends[player.Account().Key] = list
+	}
+	if _, exists := list[target.Account().Key]; !exists && len(list) >= consts.MaxFriends {
+		friendLock.Unlock()
+		return nil, consts.ErrorsFriendLimit
+	}
+	list[target.Account().Key] = target.Name
+	friendLock.Unlock()
+	if !target.hasFriend(player) {
+		_ = target.WriteString(fmt.Sprintf("[friend] %s added you as a friend, input /friend add %s to add back\n", player.Name, player.Name))
+	}
+	return target, nil
+}
+
+// findFriend 按昵称找到好友的账号，调用时需持有好友列表的锁
+func (p *Player) findFriend(name string) (string, bool) {
+	for key, friendName := range friends[p.Account().Key] {
+		if friendKey(friendName) == friendKey(name) {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// RemoveFriend 删除好友
+func RemoveFriend(player *Player, name string) error {
+	friendLock.Lock()
+	defer friendLock.Unlock()
+	key, ok := player.findFriend(name)
+	if !ok {
+		return consts.ErrorsNotFriend
+	}
+	delete(friends[player.Account().Key], key)
+	return nil
+}
+
+// IsFriend 玩家的好友列表里是否有该昵称
+func (p *Player) IsFriend(name string) bool {
+	friendLock.RLock()
+	defer friendLock.RUnlock()
+	_, ok := p.findFriend(name)
+	return ok
+}
+
+func (p *Player) hasFriend(other *Player) bool {
+	friendLock.RLock()
+	defer friendLock.RUnlock()
+	_, ok := friends[p.Account().Key][other.Account().Key]
+	return ok
+}
+
+// accountPlayer 账号当前在线的连接
+func accountPlayer(key string) *Player {
+	for _, p := range store.Players() {
+		if p.online && !p.ai && p.Account().Key == key {
+			return p
+		}
+	}
+	return nil
+}
+
+// renameFriend 玩家上线时更新其他人好友列表里的昵称
+func renameFriend(player *Player) {
+	friendLock.Lock()
+	defer friendLock.Unlock()
+	for _, list := range friends {
+		if _, ok := list[player.Account().Key]; ok {
+			list[player.Account().Key] = player.Name
+		}
+	}
+}
+
+// Presence 玩家当前的状态：离线、在线、在大厅或在某个房间
+func (p *Player) Presence() string {
+	if !p.online {
+		return "offline"
+	}
+	if room := getRoom(p.RoomID); room != nil {
+		return fmt.Sprintf("in room %d, %s, %s", room.ID, consts.GameTypes[room.Type], consts.RoomStates[room.State])
+	}
+	switch p.state {
+	case consts.StateHome, consts.StateJoin, consts.StateCreate, consts.StateMatch:
+		return "in lobby"
+	}
+	return "online"
+}
+
+// SprintFriends 好友列表和每位好友的状态，在线的排在前面
+func SprintFriends(player *Player) string {
+	friendLock.RLock()
+	names := map[string]string{}
+	for key, name := range friends[player.Account().Key] {
+		names[key] = name
+	}
+	friendLock.RUnlock()
+	lines := make([]string, 0, len(names))
+	offline := make([]string, 0)
+	for key, name := range names {
+		if p := accountPlayer(key); p != nil {
+			lines = append(lines, fmt.Sprintf("%s (id: %d): %s\n", p.Name, p.ID, p.Presence()))
+		} else {
+			offline = append(offline, fmt.Sprintf("%s: offline\n", name))
+		}
+	}
+	sort.Strings(lines)
+	sort.Strings(offline)
+	buf := bytes.Buffer{}
+	buf.WriteString("Friends:\n")
+	for _, line := range append(lines, offline...) {
+		buf.WriteString(line)
+	}
+	return buf.String()
+}
+
+// FriendRoom 好友所在的房间，用来直接加入或观战
+func FriendRoom(player *Player, name string) (*Room, error) {
+	friendLock.RLock()
+	key, ok := player.findFriend(name)
+	friendLock.RUnlock()
+	if !ok {
+		return nil, consts.ErrorsNotFriend
+	}
+	friend := accountPlayer(key)
+	if friend == nil {
+		return nil, consts.ErrorsPlayerNotFound
+	}
+	room := getRoom(friend.RoomID)
+	if room == nil {
+		return nil, consts.ErrorsFriendNotInRoom
+	}
+	return room, nil
+}
+
+// notifyFriends 通知把该玩家加为好友的在线玩家
+func notifyFriends(player *Player, msg string) {
+	if player.ai {
+		return
+	}
+	for _, p := range store.Players() {
+		if p.online && !p.ai && p.ID != player.ID && p.hasFriend(player) {
+			_ = p.WriteString(msg)
+		}
+	}
+}
+
+// NotifyGameStarted 开局时通知入座玩家的好友
+func NotifyGameStarted(room *Room) {
+	for _, id := range RoomSeats(room.ID) {
+		if p := getPlayer(id); p != nil {
+			notifyFriends(p, fmt.Sprintf("[friend] %s started a %s game in room %d, input /friend join %s to watch\n", p.Name, consts.GameTypes[room.Type], room.ID, p.Name))
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"strings"
+	"testing"
+
+	modelx "github.com/ratel-online/core/model"
+	"github.com/ratel-online/core/network"
+	"github.com/ratel-online/core/protocol"
+	"github.com/ratel-online/server/consts"
+)
+
+// fakeConn 记录写给玩家的消息
+type fakeConn struct {
+	written []string
+}
+
+func (c *fakeConn) Read() (*protocol.Packet, error) { return nil, consts.ErrorsChanClosed }
+func (c *fakeConn) Write(msg protocol.Packet) error {
+	c.written = append(c.written, string(msg.Body))
+	return nil
+}
+func (c *fakeConn) Close() error { return nil }
+func (c *fakeConn) IP() string   { return "127.0.0.1" }
+
+func TestFriends(t *testing.T) {
+	alice := &Player{ID: 7301, Name: "Alice", online: true, state: consts.StateHome, conn: network.Wrapper(&fakeConn{})}
+	bob := &Player{ID: 7302, Name: "Bob", online: true, state: consts.StateHome}
+	conn := &fakeConn{}
+	bob.conn = network.Wrapper(conn)
+	newTestStore(t, alice, bob)
+	defer func() { friends = map[string]map[string]string{} }()
+
+	if _, err := AddFriend(alice, "alice"); err != consts.ErrorsPlayerNotFound {
+		t.Fatalf("should not add yourself, err: %v", err)
+	}
+	if _, err := AddFriend(alice, "7302"); err != nil || !alice.IsFriend("bob") || bob.IsFriend("Alice") {
+		t.Fatalf("friends should be one way, err: %v", err)
+	}
+	if len(conn.written) != 1 || !strings.Contains(conn.written[0], "Alice added you") {
+		t.Fatalf("bob should be notified, got %v", conn.written)
+	}
+	if _, err := FriendRoom(alice, "Bob"); err != consts.ErrorsFriendNotInRoom || bob.Presence() != "in lobby" {
+		t.Fatalf("bob should be in lobby, presence %q err %v", bob.Presence(), err)
+	}
+
+	room := CreateRoom(7302, consts.GameTypeClassic)
+	defer deleteRoom(room)
+	_ = JoinRoom(room.ID, bob.ID)
+	if r, err := FriendRoom(alice, "Bob"); err != nil || r != room {
+		t.Fatalf("should find the friend's room, err: %v", err)
+	}
+	if _, err := FriendRoom(bob, "Alice"); err != consts.ErrorsNotFriend {
+		t.Fatalf("alice is not bob's friend, err: %v", err)
+	}
+	if err := RemoveFriend(alice, "BOB"); err != nil || alice.IsFriend("Bob") {
+		t.Fatalf("friend should be removed, err: %v", err)
+	}
+
+	// 好友按登录身份保存，重新连接换了 ID 和昵称后仍然是好友
+	info := &modelx.AuthInfo{ID: 7303, Name: "Carol"}
+	defer delete(accounts, AccountKey(info))
+	carol := Connected(network.Wrapper(&fakeConn{}), info)
+	if _, err := AddFriend(alice, "Carol"); err != nil {
+		t.Fatalf("should add carol, err: %v", err)
+	}
+	carol.online = false
+	store.DelPlayer(carol.ID)
+	if _, err := FriendRoom(alice, "Carol"); err != consts.ErrorsPlayerNotFound {
+		t.Fatalf("offline friend should not be found, err: %v", err)
+	}
+	info.Name = "Caroline"
+	Connected(network.Wrapper(&fakeConn{}), info)
+	if !alice.IsFriend("Caroline") || alice.IsFriend("Carol") || !strings.Contains(SprintFriends(alice), "Caroline (id: ") {
+		t.Fatalf("friend should follow the account, got %q", SprintFriends(alice))
+	}
+}
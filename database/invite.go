@@ -0,0 +1,164 @@
+package database
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/awesome-cap/hashmap"
+	"github.com/ratel-online/server/consts"
+)
+
+// 邀请码去掉了容易看混的 0 O 1 I
+const inviteAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+type Invite struct {
+	Code     string    `json:"code"`
+	RoomID   int64     `json:"roomId"`
+	ExpireAt time.Time `json:"expireAt"`
+}
+
+var invites = hashmap.New()
+var inviteURL string
+
+// SetInviteURL 设置邀请链接使用的 websocket 地址，为空时只提供邀请码
+func SetInviteURL(url string) {
+	inviteURL = url
+}
+
+// Link 带邀请码的 websocket 地址
+func (i *Invite) Link() string {
+	if inviteURL == "" {
+		return ""
+	}
+	return inviteURL + "?code=" + i.Code
+}
+
+func (i *Invite) Expired() bool {
+	return time.Now().After(i.ExpireAt)
+}
+
+func newInviteCode() string {
+	for {
+		b := make([]byte, consts.InviteCodeLength)
+		_, _ = rand.Read(b)
+		for i := range b {
+			b[i] = inviteAlphabet[int(b[i])%len(inviteAlphabet)]
+		}
+		if _, ok := invites.Get(string(b)); !ok {
+			return string(b)
+		}
+	}
+}
+
+// CreateInvite 为房间生成新的邀请码，旧邀请码同时作废，房间变为私密房间
+func CreateInvite(room *Room) *Invite {
+	revokeInvite(room)
+	invite := &Invite{
+		Code:     newInviteCode(),
+		RoomID:   room.ID,
+		ExpireAt: time.Now().Add(consts.InviteTTL),
+	}
+	invites.Set(invite.Code, invite)
+	room.InviteCode = invite.Code
+	room.Private = true
+	return invite
+}
+
+// RevokeInvite 作废房间的邀请码，房间不再是私密房间
+func RevokeInvite(room *Room) {
+	revokeInvite(room)
+	room.Private = false
+}
+
+func revokeInvite(room *Room) {
+	if room.InviteCode != "" {
+		invites.Del(room.InviteCode)
+		room.InviteCode = ""
+	}
+}
+
+// GetInvite 房间当前有效的邀请码
+func GetInvite(room *Room) *Invite {
+	if v, ok := invites.Get(room.InviteCode); ok && !v.(*Invite).Expired() {
+		return v.(*Invite)
+	}
+	return nil
+}
+
+// GetInviteRoom 根据邀请码查找房间
+func GetInviteRoom(code string) (*Room, error) {
+	v, ok := invites.Get(strings.ToUpper(strings.TrimSpace(code)))
+	if !ok {
+		return nil, consts.ErrorsInviteInvalid
+	}
+	invite := v.(*Invite)
+	if invite.Expired() {
+		invites.Del(invite.Code)
+		return nil, consts.ErrorsInviteExpired
+	}
+	room := getRoom(invite.RoomID)
+	if room == nil {
+		return nil, consts.ErrorsInviteInvalid
+	}
+	return room, nil
+}
+
+// cleanInvites 清理过期的邀请码
+func cleanInvites() {
+	invites.Foreach(func(e *hashmap.Entry) {
+		if invite := e.Value().(*Invite); invite.Expired() {
+			invites.Del(invite.Code)
+		}
+	})
+}
+
+// SetPassword 密码加盐后只保存哈希
+func (r *Room) SetPassword(pwd string) {
+	salt := make([]byte, 8)
+	_, _ = rand.Read(salt)
+	r.passwordSalt = hex.EncodeToString(salt)
+	r.Password = hashPassword(r.passwordSalt, pwd)
+}
+
+func (r *Room) ClearPassword() {
+	r.Password = ""
+	r.passwordSalt = ""
+}
+
+func (r *Room) HasPassword() bool {
+	return r.Password != ""
+}
+
+func (r *Room) CheckPassword(pwd string) bool {
+	return r.HasPassword() && subtle.ConstantTimeCompare([]byte(hashPassword(r.passwordSalt, pwd)), []byte(r.Password)) == 1
+}
+
+// CheckAccess 私密房间或有密码的房间，输入密码或本房间的邀请码才能进入
+func (r *Room) CheckAccess(secret string) bool {
+	if r.CheckPassword(secret) {
+		return true
+	}
+	room, err := GetInviteRoom(secret)
+	return err == nil && room.ID == r.ID
+}
+
+func hashPassword(salt, pwd string) string {
+	sum := sha256.Sum256([]byte(salt + pwd))
+	return hex.EncodeToString(sum[:])
+}
+
+// SetInvite 记录玩家通过邀请链接连接时带的邀请码
+func (p *Player) SetInvite(code string) {
+	p.invite = code
+}
+
+// TakeInvite 取出并清空玩家连接时带的邀请码
+func (p *Player) TakeInvite() string {
+	code := p.invite
+	p.invite = ""
+	return code
+}
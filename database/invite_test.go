@@ -0,0 +1,39 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ratel-online/server/consts"
+)
+
+func TestRoomAccess(t *testing.T) {
+	room := newTestRoom(t, consts.GameTypeClassic, 0)
+
+	room.SetPassword("secret")
+	if room.Password == "secret" || !room.CheckPassword("secret") || room.CheckPassword("wrong") {
+		t.Fatalf("password should be stored hashed and verified")
+	}
+
+	invite := CreateInvite(room)
+	if !room.Private || !room.CheckAccess(invite.Code) {
+		t.Fatalf("invite code should grant access to private room")
+	}
+	if r, err := GetInviteRoom(invite.Code); err != nil || r.ID != room.ID {
+		t.Fatalf("invite code should resolve to room, err: %v", err)
+	}
+
+	next := CreateInvite(room)
+	if _, err := GetInviteRoom(invite.Code); err != consts.ErrorsInviteInvalid {
+		t.Fatalf("old invite code should be revoked, err: %v", err)
+	}
+	next.ExpireAt = time.Now().Add(-time.Second)
+	if _, err := GetInviteRoom(next.Code); err != consts.ErrorsInviteExpired {
+		t.Fatalf("expired invite code should be rejected, err: %v", err)
+	}
+
+	RevokeInvite(room)
+	if room.Private || room.InviteCode != "" {
+		t.Fatalf("revoked room should be public")
+	}
+}
@@ -1,27 +1,124 @@
 package database
 
 import (
+	"bytes"
+	"fmt"
 	"sync"
+	"time"
 
 	"github.com/ratel-online/core/model"
+	"github.com/ratel-online/server/consts"
 )
 
 type Liar struct {
 	sync.Mutex
-	Room         *Room                  `json:"room"`
-	PlayerIDs    []int64                `json:"playerIds"`
-	Bullets      map[int64]int          `json:"bullets"`
-	Bong         map[int64]int          `json:"bong"`
-	Pokers       model.Pokers           `json:"pokers"`
-	States       map[int64]chan int     `json:"states"`
-	Hands        map[int64]model.Pokers `json:"hands"`
-	Target       *model.Poker           `json:"target"`
-	Alive        map[int64]bool         `json:"alive"`
-	LastPlayerID int64                  `json:"lastPlayerId"`
-	LastPokers   model.Pokers           `json:"lastPokers"`
-	Supervisors  map[int64]bool         `json:"supervisors"`
-	AllowJokers  bool                   `json:"allowJokers"`
+	Room         *Room                   `json:"room"`
+	Loop         *GameLoop               `json:"-"` // 本局的事件循环
+	PlayerIDs    []int64                 `json:"playerIds"`
+	Bullets      map[int64]int           `json:"bullets"`
+	Bong         map[int64]int           `json:"bong"`
+	Pokers       model.Pokers            `json:"pokers"`
+	Hands        map[int64]model.Pokers  `json:"hands"`
+	Target       *model.Poker            `json:"target"`
+	Alive        map[int64]bool          `json:"alive"`
+	LastPlayerID int64                   `json:"lastPlayerId"`
+	LastPokers   model.Pokers            `json:"lastPokers"`
+	Supervisors  map[int64]time.Duration `json:"supervisors"` // 观察者及其看到真实手牌的延迟
+	AllowJokers  bool                    `json:"allowJokers"`
+	Eliminated   []int64                 `json:"eliminated"` // 按淘汰先后排列
+	hands        string                  // 事件循环里最近一次记下的存活玩家手牌
 }
 
 func (l *Liar) Clean() {
 }
+
+func (l *Liar) IsPlayer(playerId int64) bool {
+	for _, id := range l.PlayerIDs {
+		if id == playerId {
+			return true
+		}
+	}
+	return false
+}
+
+// SupervisorDelay 判断玩家是否有权开启观察者模式，返回看到真实手牌的延迟
+// 管理员实时可见；休闲房间的房主实时可见；观众延迟可见；其余玩家无权开启
+func (l *Liar) SupervisorDelay(player *Player) (time.Duration, bool) {
+	if player.IsAdmin() {
+		return 0, true
+	}
+	if !l.IsPlayer(player.ID) {
+		return consts.SupervisorSpectatorDelay, true
+	}
+	if l.Room.EnableCasual && l.Room.Creator == player.ID {
+		return 0, true
+	}
+	return 0, false
+}
+
+func (l *Liar) AddSupervisor(playerId int64, delay time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+	l.Supervisors[playerId] = delay
+}
+
+func (l *Liar) IsSupervisor(playerId int64) bool {
+	l.Lock()
+	defer l.Unlock()
+	_, ok := l.Supervisors[playerId]
+	return ok
+}
+
+// SaveHands 在事件循环里发牌、出牌后记下存活玩家的手牌，事件循环之外开启观察者模式时只读这份记录
+func (l *Liar) SaveHands() {
+	buf := bytes.Buffer{}
+	buf.WriteString("[观察者] 当前手牌:\n")
+	for _, id := range l.PlayerIDs {
+		if p := getPlayer(id); p != nil && l.Alive[id] {
+			buf.WriteString(fmt.Sprintf("%s: %s\n", p.Name, l.Hands[id].String()))
+		}
+	}
+	l.Lock()
+	defer l.Unlock()
+	l.hands = buf.String()
+}
+
+// SavedHands 最近一次记下的手牌
+func (l *Liar) SavedHands() string {
+	l.Lock()
+	defer l.Unlock()
+	return l.hands
+}
+
+// NotifySupervisors 向观察者发送真实牌面信息，观众按各自的延迟接收
+func (l *Liar) NotifySupervisors(msg string) {
+	l.Lock()
+	defer l.Unlock()
+	for id, delay := range l.Supervisors {
+		notifySupervisor(id, delay, msg)
+	}
+}
+
+func (l *Liar) NotifySupervisor(playerId int64, msg string) {
+	l.Lock()
+	defer l.Unlock()
+	if delay, ok := l.Supervisors[playerId]; ok {
+		notifySupervisor(playerId, delay, msg)
+	}
+}
+
+func notifySupervisor(playerId int64, delay time.Duration, msg string) {
+	p := getPlayer(playerId)
+	if p == nil {
+		return
+	}
+	if delay <= 0 {
+		_ = p.WriteString(msg)
+		return
+	}
+	time.AfterFunc(delay, func() {
+		if p.IsOnline() {
+			_ = p.WriteString(msg)
+		}
+	})
+}
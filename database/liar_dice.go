@@ -0,0 +1,147 @@
+package database
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ratel-online/core/util/rand"
+)
+
+type LiarDice struct {
+	Room        *Room           `json:"room"`
+	Loop        *GameLoop       `json:"-"` // 本局的事件循环
+	PlayerIDs   []int64         `json:"playerIds"`
+	Dice        map[int64][]int `json:"dice"`
+	BidPlayerID int64           `json:"bidPlayerId"`
+	BidQuantity int             `json:"bidQuantity"`
+	BidFace     int             `json:"bidFace"`
+	WildOnes    bool            `json:"wildOnes"`
+	SpotOn      bool            `json:"spotOn"`
+	Eliminated  []int64         `json:"eliminated"` // 按淘汰先后排列
+}
+
+func (g *LiarDice) Clean() {
+}
+
+// Roll 为每位仍有骰子的玩家重新摇骰，并清空当前叫点
+func (g *LiarDice) Roll() {
+	for id, dice := range g.Dice {
+		rolled := make([]int, len(dice))
+		for i := range rolled {
+			rolled[i] = rand.Intn(6) + 1
+		}
+		sort.Ints(rolled)
+		g.Dice[id] = rolled
+	}
+	g.BidPlayerID = 0
+	g.BidQuantity = 0
+	g.BidFace = 0
+}
+
+// Count 统计场上点数为 face 的骰子数量，开启一点万能时 1 点计入其它点数
+func (g *LiarDice) Count(face int) int {
+	count := 0
+	for _, dice := range g.Dice {
+		for _, d := range dice {
+			if d == face || (g.WildOnes && face != 1 && d == 1) {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+func (g *LiarDice) TotalDice() int {
+	total := 0
+	for _, dice := range g.Dice {
+		total += len(dice)
+	}
+	return total
+}
+
+func (g *LiarDice) Alive(playerId int64) bool {
+	return len(g.Dice[playerId]) > 0
+}
+
+func (g *LiarDice) AliveCount() int {
+	count := 0
+	for _, id := range g.PlayerIDs {
+		if g.Alive(id) {
+			count++
+		}
+	}
+	return count
+}
+
+// NextAlive 返回 curr 之后第一位仍有骰子的玩家
+func (g *LiarDice) NextAlive(curr int64) int64 {
+	idx := 0
+	for i, id := range g.PlayerIDs {
+		if id == curr {
+			idx = i
+			break
+		}
+	}
+	for i := 1; i <= len(g.PlayerIDs); i++ {
+		id := g.PlayerIDs[(idx+i)%len(g.PlayerIDs)]
+		if g.Alive(id) {
+			return id
+		}
+	}
+	return curr
+}
+
+// faceRank 开启一点万能时，叫 1 点的优先级最高
+func (g *LiarDice) faceRank(face int) int {
+	if g.WildOnes && face == 1 {
+		return 7
+	}
+	return face
+}
+
+// IsHigherBid 新的叫点必须数量更多，或数量相同但点数更大
+func (g *LiarDice) IsHigherBid(quantity, face int) bool {
+	if quantity <= 0 || quantity > g.TotalDice() || face < 1 || face > 6 {
+		return false
+	}
+	if g.BidQuantity == 0 {
+		return true
+	}
+	if quantity != g.BidQuantity {
+		return quantity > g.BidQuantity
+	}
+	return g.faceRank(face) > g.faceRank(g.BidFace)
+}
+
+func (g *LiarDice) Bid(playerId int64, quantity, face int) {
+	g.BidPlayerID = playerId
+	g.BidQuantity = quantity
+	g.BidFace = face
+}
+
+// LoseDie 玩家失去一颗骰子，返回是否被淘汰
+func (g *LiarDice) LoseDie(playerId int64) bool {
+	if dice := g.Dice[playerId]; len(dice) > 0 {
+		g.Dice[playerId] = dice[1:]
+		if !g.Alive(playerId) {
+			g.Eliminated = append(g.Eliminated, playerId)
+		}
+	}
+	return !g.Alive(playerId)
+}
+
+// GainDie 玩家找回一颗骰子，最多不超过初始数量
+func (g *LiarDice) GainDie(playerId int64, max int) {
+	if len(g.Dice[playerId]) < max {
+		g.Dice[playerId] = append(g.Dice[playerId], 1)
+	}
+}
+
+func DiceString(dice []int) string {
+	faces := make([]string, 0, len(dice))
+	for _, d := range dice {
+		faces = append(faces, "["+strconv.Itoa(d)+"]")
+	}
+	return strings.Join(faces, " ")
+}
@@ -0,0 +1,71 @@
+package database
+
+import (
+	"strconv"
+	stringx "strings"
+
+	"github.com/ratel-online/core/log"
+	"github.com/ratel-online/server/consts"
+)
+
+// InLobby 玩家在大厅，也就是主页或房间列表
+func (p *Player) InLobby() bool {
+	return p.state == consts.StateHome || p.state == consts.StateJoin
+}
+
+// FindPlayer 按 ID 或昵称查找在线的玩家
+func FindPlayer(key string) *Player {
+	if id, err := strconv.ParseInt(key, 10, 64); err == nil {
+		if p := getPlayer(id); p != nil && p.online && !p.ai {
+			return p
+		}
+	}
+	for _, p := range store.Players() {
+		if p.online && !p.ai && stringx.EqualFold(p.Name, key) {
+			return p
+		}
+	}
+	return nil
+}
+
+// BroadcastLobby 向大厅里所有没有屏蔽发言人的玩家广播
+func BroadcastLobby(player *Player, msg string) {
+	log.Infof("lobby msg, player %s[%d] %s say: %s\n", player.Name, player.ID, player.IP, stringx.TrimSpace(msg))
+	if err := allowChat(player); err != nil {
+		_ = player.WriteError(err)
+		return
+	}
+	recordChat(player, ChannelLobby, 0, 0, msg)
+	msg = filterChat(msg)
+	for _, p := range store.Players() {
+		if p.online && p.InLobby() && !p.HasMuted(player.ID) {
+			_ = p.WriteString(">> " + msg)
+		}
+	}
+}
+
+// Whisper 私聊，对方屏蔽了发送人时消息被丢弃，发送人不会知道
+func Whisper(from, to *Player, msg string) error {
+	if to == nil || !to.online || to.ID == from.ID {
+		return consts.ErrorsPlayerNotFound
+	}
+	log.Infof("whisper msg, player %s[%d] %s to %s[%d]: %s\n", from.Name, from.ID, from.IP, to.Name, to.ID, stringx.TrimSpace(msg))
+	if err := allowChat(from); err != nil {
+		return err
+	}
+	recordChat(from, ChannelWhisper, 0, to.ID, msg)
+	if to.HasMuted(from.ID) {
+		return nil
+	}
+	muteLock.Lock()
+	to.replyTo = from.ID
+	muteLock.Unlock()
+	return to.WriteString(">> " + filterChat(msg))
+}
+
+// ReplyTarget 最近一位私聊自己的玩家
+func (p *Player) ReplyTarget() *Player {
+	muteLock.RLock()
+	defer muteLock.RUnlock()
+	return getPlayer(p.replyTo)
+}
@@ -0,0 +1,28 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/ratel-online/server/consts"
+)
+
+func TestWhisper(t *testing.T) {
+	alice := &Player{ID: 7001, Name: "Alice", online: true}
+	bob := &Player{ID: 7002, Name: "Bob", online: true}
+	offline := &Player{ID: 7003, Name: "Carol"}
+	newTestStore(t, alice, bob, offline)
+
+	if FindPlayer("bob") != bob || FindPlayer("7001") != alice {
+		t.Fatalf("players should be found by name or id")
+	}
+	if FindPlayer("carol") != nil {
+		t.Fatalf("offline players should not be found")
+	}
+	if err := Whisper(alice, alice, "hi"); err != consts.ErrorsPlayerNotFound {
+		t.Fatalf("should not whisper to yourself, err: %v", err)
+	}
+	bob.ToggleMute(alice.ID)
+	if err := Whisper(alice, bob, "hi"); err != nil || bob.ReplyTarget() != nil {
+		t.Fatalf("whisper from a blocked player should be dropped silently, err: %v", err)
+	}
+}
@@ -0,0 +1,305 @@
+package database
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ratel-online/core/log"
+	"github.com/ratel-online/core/util/async"
+	"github.com/ratel-online/server/consts"
+)
+
+// RoomEvent 交给事件循环的事件，由 Player 对应的玩家处理 State
+type RoomEvent struct {
+	Player int64
+	State  int
+}
+
+// GameHandler 在事件循环里处理一个事件，返回的错误交给该玩家的连接
+type GameHandler func(player *Player, state int) error
+
+// roomRoutines 房间的事件循环和计时协程，测试替换存储前等它们都退出
+var roomRoutines sync.WaitGroup
+
+// GameLoop 房间对局的事件循环，对局状态只在这一个协程里推进
+// 轮到谁行动就由事件循环向谁询问，玩家的连接只等待对局结束或自己的错误
+type GameLoop struct {
+	sync.Mutex
+	room     *Room
+	handler  GameHandler
+	events   []RoomEvent
+	wake     chan struct{}
+	done     chan struct{}
+	errs     map[int64]chan error
+	expected []int64        // 开局时入座的玩家，都进入对局后才开始处理事件
+	joined   map[int64]bool // 已经离开等待房间、开始等待对局的玩家
+	table    string         // 事件循环里最近一次生成的牌桌
+	revealed string         // 最近一次发给观众的手牌
+	started  bool
+	ended    bool
+}
+
+// NewGameLoop 开局时为房间创建事件循环，上一局的事件循环随之结束
+func NewGameLoop(room *Room, handler GameHandler) *GameLoop {
+	if room.loop != nil {
+		room.loop.end()
+	}
+	l := &GameLoop{
+		room:    room,
+		handler: handler,
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		errs:    map[int64]chan error{},
+		joined:  map[int64]bool{},
+	}
+	room.loop = l
+	return l
+}
+
+// Loop 房间当前对局的事件循环
+func (r *Room) Loop() *GameLoop {
+	return r.loop
+}
+
+// Running 房间是否在对局中
+func (r *Room) Running() bool {
+	r.Lock()
+	defer r.Unlock()
+	return r.State == consts.RoomStateRunning
+}
+
+// Send 投递事件，不会阻塞，事件按投递的顺序处理，对局结束后投递的事件被丢弃
+func (l *GameLoop) Send(playerId int64, state int) {
+	l.Lock()
+	defer l.Unlock()
+	if l.ended {
+		return
+	}
+	l.events = append(l.events, RoomEvent{Player: playerId, State: state})
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run 开始处理事件，开局的准备做完后调用，重复调用不做处理
+// 入座的玩家还在等待房间里读取输入，事件循环要等他们都进入对局后才向他们询问
+func (l *GameLoop) Run() {
+	l.Lock()
+	defer l.Unlock()
+	if l.started || l.ended {
+		return
+	}
+	l.started = true
+	for id := range getRoomPlayers(l.room.ID) {
+		if p := getPlayer(id); p != nil && !p.ai {
+			l.expected = append(l.expected, id)
+		}
+	}
+	roomRoutines.Add(1)
+	async.Async(l.run)
+}
+
+func (l *GameLoop) run() {
+	defer roomRoutines.Done()
+	if !l.waitJoined() {
+		return
+	}
+	atomic.StoreInt32(&l.room.tableRefresh, 1)
+	l.flushTable()
+	for {
+		event, ok := l.next()
+		if !ok {
+			return
+		}
+		player := getPlayer(event.Player)
+		if player == nil {
+			log.Infof("[GameLoop] room %d dropped event %d of player %d who is gone\n", l.room.ID, event.State, event.Player)
+			continue
+		}
+		if err := l.handle(player, event.State); err != nil {
+			log.Error(err)
+			l.fail(event.Player, err)
+			if l.stalled() {
+				l.abort(fmt.Sprintf("%s left, game over\n", player.Name))
+			}
+		}
+		l.flushTable()
+	}
+}
+
+// handle 处理一个事件，处理时崩溃的对局直接结束，不会让等待中的玩家一直卡住
+func (l *GameLoop) handle(player *Player, state int) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			async.PrintStackTrace(r)
+			l.abort("Game crashed, back to the room\n")
+		}
+	}()
+	return l.handler(player, state)
+}
+
+// stalled 出错的事件没有投递下一个事件时，对局无法继续
+func (l *GameLoop) stalled() bool {
+	l.Lock()
+	defer l.Unlock()
+	return !l.ended && len(l.events) == 0
+}
+
+// abort 中止对局，所有人回到房间
+func (l *GameLoop) abort(msg string) {
+	if l.Ended() {
+		return
+	}
+	Broadcast(l.room.ID, msg)
+	EndGame(l.room, nil)
+}
+
+// waitJoined 等入座的玩家都进入对局，掉线的玩家不等，超过 GameLoopJoinTimeout 后不再等待
+func (l *GameLoop) waitJoined() bool {
+	deadline := time.After(consts.GameLoopJoinTimeout)
+	for {
+		l.Lock()
+		ended, ready := l.ended, true
+		for _, id := range l.expected {
+			if p := getPlayer(id); !l.joined[id] && p != nil && p.IsOnline() {
+				ready = false
+			}
+		}
+		l.Unlock()
+		if ended {
+			return false
+		}
+		if ready {
+			return true
+		}
+		select {
+		case <-l.wake:
+		case <-l.done:
+		case <-deadline:
+			log.Infof("[GameLoop] room %d players did not join in time, start anyway\n", l.room.ID)
+			return true
+		}
+	}
+}
+
+// next 取出下一个事件，没有事件时阻塞，对局结束后返回 false
+func (l *GameLoop) next() (RoomEvent, bool) {
+	for {
+		l.Lock()
+		if l.ended {
+			l.Unlock()
+			return RoomEvent{}, false
+		}
+		if len(l.events) > 0 {
+			event := l.events[0]
+			l.events = l.events[1:]
+			l.Unlock()
+			return event, true
+		}
+		l.Unlock()
+		select {
+		case <-l.wake:
+		case <-l.done:
+		}
+	}
+}
+
+func (l *GameLoop) errChan(playerId int64) chan error {
+	l.Lock()
+	defer l.Unlock()
+	ch, ok := l.errs[playerId]
+	if !ok {
+		ch = make(chan error, 1)
+		l.errs[playerId] = ch
+	}
+	return ch
+}
+
+// fail 把处理事件时的错误交给玩家的连接，没有连接在等待时只保留一个
+func (l *GameLoop) fail(playerId int64, err error) {
+	select {
+	case l.errChan(playerId) <- err:
+	default:
+	}
+}
+
+// Wait 玩家的连接等待对局结束，处理该玩家的事件出错或者玩家掉线时返回错误
+func (l *GameLoop) Wait(player *Player) (consts.StateID, error) {
+	l.join(player.ID)
+	errs := l.errChan(player.ID)
+	select {
+	case err := <-errs:
+		return 0, err
+	case <-l.done:
+		// 对局结束前处理该玩家的事件出了错，先把错误交给玩家
+		select {
+		case err := <-errs:
+			return 0, err
+		default:
+		}
+		return consts.StateWaiting, nil
+	case <-player.closed:
+		return 0, consts.ErrorsChanClosed
+	}
+}
+
+// join 玩家离开等待房间，事件循环可以向他询问了
+func (l *GameLoop) join(playerId int64) {
+	l.Lock()
+	defer l.Unlock()
+	if !l.joined[playerId] {
+		l.joined[playerId] = true
+		select {
+		case l.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Ended 对局是否已经结束
+func (l *GameLoop) Ended() bool {
+	l.Lock()
+	defer l.Unlock()
+	return l.ended
+}
+
+func (l *GameLoop) end() {
+	l.Lock()
+	defer l.Unlock()
+	if !l.ended {
+		l.ended = true
+		l.events = nil
+		close(l.done)
+	}
+}
+
+// EndGame 结束对局，房间回到等待状态，等待中的玩家都回到房间
+// next 为留给下一局继续使用的对局数据，不需要时传 nil
+func EndGame(room *Room, next RoomGame) {
+	room.Lock()
+	room.Game = next
+	room.State = consts.RoomStateWaiting
+	loop := room.loop
+	room.Unlock()
+	if loop != nil {
+		loop.end()
+	}
+}
+
+// WaitGame 进入对局状态的玩家等待对局结束，房间没有对局时直接回到房间
+func WaitGame(player *Player) (consts.StateID, error) {
+	room := getRoom(player.RoomID)
+	if room == nil {
+		return 0, player.WriteError(consts.ErrorsExist)
+	}
+	room.Lock()
+	loop := room.loop
+	room.Unlock()
+	if loop == nil {
+		return consts.StateWaiting, nil
+	}
+	return loop.Wait(player)
+}
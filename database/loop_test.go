@@ -0,0 +1,118 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ratel-online/core/network"
+	"github.com/ratel-online/server/consts"
+)
+
+func TestGameLoop(t *testing.T) {
+	room := newTestRoom(t, consts.GameTypeClassic, 0)
+	alice := &Player{ID: 7601, Name: "Alice", RoomID: room.ID}
+	bob := &Player{ID: 7602, Name: "Bob"}
+	store.SetPlayer(alice)
+	store.SetPlayer(bob)
+
+	handled := make(chan RoomEvent, 10)
+	var loop *GameLoop
+	loop = NewGameLoop(room, func(player *Player, state int) error {
+		handled <- RoomEvent{Player: player.ID, State: state}
+		switch state {
+		case 1:
+			// 事件循环里投递的事件排在已有事件之后
+			loop.Send(bob.ID, 3)
+		case 2:
+			return consts.ErrorsTimeout
+		case 4:
+			EndGame(room, nil)
+			loop.Send(alice.ID, 5)
+		}
+		return nil
+	})
+	// 开局前投递的事件在 Run 之后才处理
+	loop.Send(alice.ID, 1)
+	loop.Send(bob.ID, 2)
+	select {
+	case <-handled:
+		t.Fatalf("events should wait for the loop to run")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	room.State = consts.RoomStateRunning
+	loop.Run()
+	if state, err := loop.Wait(bob); state != 0 || err != consts.ErrorsTimeout {
+		t.Fatalf("handler error should be returned to the player, got %d %v", state, err)
+	}
+	loop.Send(alice.ID, 4)
+	if state, err := WaitGame(alice); state != consts.StateWaiting || err != nil {
+		t.Fatalf("players should return to the room after the game ends, got %d %v", state, err)
+	}
+	if !loop.Ended() || room.Running() || room.Game != nil {
+		t.Fatalf("room should be waiting after the game ends")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	close(handled)
+	order := make([]int, 0)
+	for event := range handled {
+		order = append(order, event.State)
+	}
+	if len(order) != 4 || order[0] != 1 || order[1] != 2 || order[2] != 3 || order[3] != 4 {
+		t.Fatalf("events should be handled in order and dropped after the game ends, got %v", order)
+	}
+}
+
+func TestGameLoopAbort(t *testing.T) {
+	alice := &Player{ID: 7611, Name: "Alice", online: true, conn: network.Wrapper(&fakeConn{})}
+	room := newTestRoom(t, consts.GameTypeClassic, 0, alice)
+
+	handled := make(chan int, 10)
+	loop := NewGameLoop(room, func(player *Player, state int) error {
+		handled <- state
+		if state == 1 {
+			panic("broken handler")
+		}
+		return consts.ErrorsExist
+	})
+	loop.Send(alice.ID, 1)
+	room.State = consts.RoomStateRunning
+	loop.Run()
+	// 玩家还没离开等待房间时不处理事件
+	select {
+	case <-handled:
+		t.Fatalf("events should wait for seated players to join the game")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if state, err := WaitGame(alice); state != consts.StateWaiting || err != nil {
+		t.Fatalf("a crashed handler should end the game, got %d %v", state, err)
+	}
+	if room.Running() || room.Game != nil {
+		t.Fatalf("room should be waiting after the game crashed")
+	}
+
+	// 出错的事件没有投递下一个事件时对局结束
+	loop = NewGameLoop(room, func(player *Player, state int) error {
+		return consts.ErrorsExist
+	})
+	loop.Send(alice.ID, 2)
+	room.State = consts.RoomStateRunning
+	loop.Run()
+	if _, err := WaitGame(alice); err != consts.ErrorsExist {
+		t.Fatalf("handler error should be returned, err: %v", err)
+	}
+	if state, err := WaitGame(alice); state != consts.StateWaiting || err != nil || room.Running() {
+		t.Fatalf("stalled game should end, got %d %v", state, err)
+	}
+
+	// 掉线的玩家不再等待对局
+	loop = NewGameLoop(room, func(player *Player, state int) error { return nil })
+	room.State = consts.RoomStateRunning
+	loop.Run()
+	bob := &Player{ID: 7612, closed: make(chan struct{})}
+	close(bob.closed)
+	if _, err := loop.Wait(bob); err != consts.ErrorsChanClosed {
+		t.Fatalf("disconnected player should stop waiting, err: %v", err)
+	}
+}
@@ -6,29 +6,153 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/feel-easy/mahjong/card"
 	"github.com/feel-easy/mahjong/consts"
 	"github.com/feel-easy/mahjong/event"
 	"github.com/feel-easy/mahjong/game"
 	"github.com/feel-easy/mahjong/tile"
+	"github.com/feel-easy/mahjong/win"
 	"github.com/ratel-online/core/log"
+	"github.com/ratel-online/core/util/rand"
 	rconsts "github.com/ratel-online/server/consts"
 )
 
 type Mahjong struct {
-	Room      *Room            `json:"room"`
-	PlayerIDs []int            `json:"playerIds"`
-	States    map[int]chan int `json:"states"`
-	Game      *game.Game       `json:"game"`
+	Room      *Room                  `json:"room"`
+	Loop      *GameLoop              `json:"-"` // 本局的事件循环
+	PlayerIDs []int                  `json:"playerIds"`
+	Game      *game.Game             `json:"game"`
+	Players   map[int]*MahjongPlayer `json:"players"`
+	// 血战麻将：牌墙不含字牌，由服务端维护；胡牌的玩家退出本局，其余玩家继续
+	Sichuan bool           `json:"sichuan"`
+	Wall    []int          `json:"wall"`
+	Winners []int          `json:"winners"`
+	DingQue sync.WaitGroup `json:"-"`
+	// ClaimedFrom 当前玩家吃碰了谁打出的牌，摸牌后为 0，用来区分点炮和自摸
+	ClaimedFrom int `json:"claimedFrom"`
 }
 
-func (game *Mahjong) Clean() {
-	if game != nil {
-		for _, state := range game.States {
-			close(state)
+// NewSichuanWall 生成只有万条饼的 108 张牌墙
+func NewSichuanWall() []int {
+	wall := make([]int, 0, 108)
+	for _, suit := range []int{tile.WAN, tile.TIAO, tile.BING} {
+		for i := 0; i < 4; i++ {
+			for j := 1; j <= 9; j++ {
+				wall = append(wall, suit*10+j)
+			}
 		}
 	}
+	for i := len(wall) - 1; i > 0; i-- {
+		j := rand.Intn(i + 1)
+		wall[i], wall[j] = wall[j], wall[i]
+	}
+	return wall
+}
+
+func (game *Mahjong) NoTiles() bool {
+	if game.Sichuan {
+		return len(game.Wall) == 0
+	}
+	return game.Game.Deck().NoTiles()
+}
+
+// DrawTiles 血战麻将从服务端牌墙摸牌
+func (game *Mahjong) DrawTiles(amount int) []int {
+	if amount > len(game.Wall) {
+		amount = len(game.Wall)
+	}
+	tiles := append([]int{}, game.Wall[:amount]...)
+	game.Wall = game.Wall[amount:]
+	return tiles
+}
+
+func (game *Mahjong) HasWon(playerId int) bool {
+	for _, id := range game.Winners {
+		if id == playerId {
+			return true
+		}
+	}
+	return false
+}
+
+// GameOver 血战麻将三家胡牌后结束
+func (game *Mahjong) GameOver() bool {
+	return len(game.Winners) >= len(game.PlayerIDs)-1
+}
+
+// CanWin 血战麻将手里还有缺门的牌时不能胡
+func (game *Mahjong) CanWin(playerId int, hand, showTiles []int) bool {
+	if game.HasWon(playerId) || !win.CanWin(hand, showTiles) {
+		return false
+	}
+	if game.Sichuan {
+		if mp := game.Players[playerId]; mp != nil && len(mp.MissingTiles(hand)) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (game *Mahjong) Score(hand []int, showCards []*game.ShowCard, selfDrawn bool) *MahjongScore {
+	if game.Sichuan {
+		return ScoreSichuan(hand, showCards, selfDrawn)
+	}
+	return ScoreMahjong(hand, showCards, selfDrawn)
+}
+
+// TakeSichuan 血战麻将询问当前玩家是否碰杠。库的 Take 在放弃时会从库自带的牌墙摸牌，
+// 那副牌没有发过而且有字牌，所以先问玩家，放弃时只记录放弃，由调用方从服务端牌墙摸牌
+func (game *Mahjong) TakeSichuan(gameState game.State) (int, bool, error) {
+	pc := game.Game.Current()
+	tiles := append(pc.Hand(), game.Game.Pile().Top())
+	op, claimed, err := (*pc.Player()).Take(tiles, gameState)
+	if err != nil {
+		return op, false, err
+	}
+	if len(claimed) == 0 {
+		game.Game.Pile().AddSayNoPlayer(pc)
+		return op, false, nil
+	}
+	game.Players[pc.ID()].claim = &OP{operation: op, tiles: claimed}
+	return pc.Take(gameState, game.Game.Deck(), game.Game.Pile())
+}
+
+// FilterState 按血战规则过滤可胡和吃碰杠：已胡的玩家不再参与，不能吃，不能碰杠缺门的牌
+func (game *Mahjong) FilterState(state *game.State) {
+	canWin := state.CanWin[:0]
+	for _, p := range state.CanWin {
+		if game.CanWin(p.ID(), append(p.Hand(), state.LastPlayedTile), p.GetShowCardTiles()) {
+			canWin = append(canWin, p)
+		}
+	}
+	state.CanWin = canWin
+	for id, pvs := range state.SpecialPrivileges {
+		if game.HasWon(id) {
+			delete(state.SpecialPrivileges, id)
+			continue
+		}
+		if !game.Sichuan {
+			continue
+		}
+		mp := game.Players[id]
+		allowed := make([]int, 0, len(pvs))
+		for _, pv := range pvs {
+			if pv == consts.CHI || (mp != nil && mp.IsMissing(state.LastPlayedTile)) {
+				continue
+			}
+			allowed = append(allowed, pv)
+		}
+		if len(allowed) == 0 {
+			delete(state.SpecialPrivileges, id)
+		} else {
+			state.SpecialPrivileges[id] = allowed
+		}
+	}
+}
+
+func (game *Mahjong) Clean() {
 }
 
 type OP struct {
@@ -46,6 +170,79 @@ func circled(n int) string {
 type MahjongPlayer struct {
 	ID   int64  `json:"id"`
 	Name string `json:"name"`
+	// 血战麻将定缺的花色
+	DingQue bool `json:"dingQue"`
+	Missing int  `json:"missing"`
+	// claim 血战麻将已经问过的吃碰杠，交给库处理时直接返回，不再询问
+	claim *OP
+}
+
+var suitNames = map[int]string{
+	tile.WAN:  "万",
+	tile.TIAO: "条",
+	tile.BING: "饼",
+}
+
+var suitAliases = map[string]int{
+	"w": tile.WAN, "万": tile.WAN,
+	"t": tile.TIAO, "条": tile.TIAO,
+	"b": tile.BING, "饼": tile.BING,
+}
+
+func SuitName(suit int) string {
+	return suitNames[suit]
+}
+
+func (mp *MahjongPlayer) IsMissing(t int) bool {
+	return mp.DingQue && t/10 == mp.Missing
+}
+
+func (mp *MahjongPlayer) MissingTiles(tiles []int) []int {
+	missing := make([]int, 0)
+	for _, t := range tiles {
+		if mp.IsMissing(t) {
+			missing = append(missing, t)
+		}
+	}
+	return missing
+}
+
+// AskMissingSuit 血战麻将开局定缺，超时默认缺手里最少的花色
+func (mp *MahjongPlayer) AskMissingSuit(hand []int) int {
+	counts := map[int]int{}
+	for _, t := range hand {
+		counts[t/10]++
+	}
+	fewest := tile.WAN
+	for _, suit := range []int{tile.TIAO, tile.BING} {
+		if counts[suit] < counts[fewest] {
+			fewest = suit
+		}
+	}
+	p := GetPlayer(mp.ID)
+	if p.IsAI() {
+		mp.DingQue = true
+		mp.Missing = fewest
+		return fewest
+	}
+	timer := playerTimer(p)
+	timer.Begin(p.ID, rconsts.PlayMahjongTimeout)
+	defer timer.Stop(p.ID)
+	for {
+		_ = p.WriteString(fmt.Sprintf("Your hand: %s \nDeclare your missing suit (定缺): w(万), t(条) or b(饼)? \n", tile.ToTileString(hand)))
+		ans, err := timer.Ask(p)
+		if err != nil {
+			ans = suitNames[fewest]
+		}
+		suit, ok := suitAliases[strings.ToLower(strings.TrimSpace(ans))]
+		if !ok {
+			_ = p.WriteError(rconsts.ErrorsInputInvalid)
+			continue
+		}
+		mp.DingQue = true
+		mp.Missing = suit
+		return suit
+	}
 }
 
 func NewPlayer(user *Player) *MahjongPlayer {
@@ -69,7 +266,17 @@ func (mp *MahjongPlayer) OnPlayTile(payload event.PlayTilePayload) {
 	Broadcast(p.RoomID, fmt.Sprintf("%s PlayTile %s !\n", payload.PlayerName, tile.Tile(payload.Tile)), p.ID)
 }
 
+// takeClaim 取出已经问过的吃碰杠
+func (mp *MahjongPlayer) takeClaim() *OP {
+	claim := mp.claim
+	mp.claim = nil
+	return claim
+}
+
 func (mp *MahjongPlayer) Take(tiles []int, gameState game.State) (int, []int, error) {
+	if claim := mp.takeClaim(); claim != nil {
+		return claim.operation, claim.tiles, nil
+	}
 	p := GetPlayer(mp.ID)
 	Broadcast(p.RoomID, fmt.Sprintf("It's %s take mahjong! \n", p.Name), p.ID)
 	buf := bytes.Buffer{}
@@ -122,6 +329,9 @@ func (mp *MahjongPlayer) Take(tiles []int, gameState game.State) (int, []int, er
 		operation: 0,
 		tiles:     []int{},
 	}
+	timer := playerTimer(p)
+	timer.Begin(p.ID, consts.PlayMahjongTimeout)
+	defer timer.Stop(p.ID)
 	loopCount := 0
 	for {
 		loopCount++
@@ -130,7 +340,7 @@ func (mp *MahjongPlayer) Take(tiles []int, gameState game.State) (int, []int, er
 		}
 		p = getPlayer(p.ID)
 		p.WriteString(askBuf.String())
-		selectedLabel, err := p.AskForString(consts.PlayMahjongTimeout)
+		selectedLabel, err := timer.Ask(p)
 		if err != nil {
 			switch err {
 			case rconsts.ErrorsExist:
@@ -163,6 +373,12 @@ func (mp *MahjongPlayer) Play(tiles []int, gameState game.State) (int, error) {
 	askBuf.WriteString("Select a tile to play:\n")
 	tileOptions := make(map[string]int)
 	sort.Ints(tiles)
+	// 定缺后必须先打完缺门的牌
+	if missing := mp.MissingTiles(tiles); len(missing) > 0 {
+		askBuf.Reset()
+		askBuf.WriteString(fmt.Sprintf("Play your missing suit (%s) first:\n", SuitName(mp.Missing)))
+		tiles = missing
+	}
 	for idx, i := range tiles {
 		label := strconv.Itoa(idx + 1)
 		tileOptions[label] = i
@@ -174,6 +390,9 @@ func (mp *MahjongPlayer) Play(tiles []int, gameState game.State) (int, error) {
 		}
 	}
 	askBuf.WriteString("\n")
+	timer := playerTimer(p)
+	timer.Start(p.ID)
+	defer timer.Stop(p.ID)
 	loopCount := 0
 	for {
 		loopCount++
@@ -182,7 +401,7 @@ func (mp *MahjongPlayer) Play(tiles []int, gameState game.State) (int, error) {
 		}
 		p = GetPlayer(p.ID)
 		p.WriteString(askBuf.String())
-		selectedLabel, err := p.AskForString(rconsts.PlayMahjongTimeout)
+		selectedLabel, err := timer.Ask(p)
 		if err != nil {
 			switch err {
 			case rconsts.ErrorsExist:
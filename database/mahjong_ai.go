@@ -0,0 +1,258 @@
+package database
+
+import (
+	"time"
+
+	"github.com/feel-easy/mahjong/card"
+	"github.com/feel-easy/mahjong/consts"
+	"github.com/feel-easy/mahjong/event"
+	"github.com/feel-easy/mahjong/game"
+	"github.com/feel-easy/mahjong/tile"
+	rconsts "github.com/ratel-online/server/consts"
+)
+
+// MahjongAI 电脑玩家，按向听数和进张数出牌，碰杠能减少向听数时才吃碰杠
+type MahjongAI struct {
+	*MahjongPlayer
+}
+
+func NewMahjongAI(user *Player) *MahjongAI {
+	return &MahjongAI{MahjongPlayer: NewPlayer(user)}
+}
+
+func (ai *MahjongAI) Play(tiles []int, gameState game.State) (int, error) {
+	time.Sleep(rconsts.MahjongAIDelay)
+	waitPlayerRoom(ai.ID)
+	candidates := tiles
+	if missing := ai.MissingTiles(tiles); len(missing) > 0 {
+		candidates = missing
+	}
+	melds := meldCount(len(tiles))
+	best, bestShanten, bestUkeire := candidates[0], 99, -1
+	for _, t := range uniqueTiles(candidates) {
+		remain := removeTiles(tiles, t)
+		shanten := Shanten(remain, melds)
+		if shanten > bestShanten {
+			continue
+		}
+		ukeire := ai.ukeire(remain, melds, shanten, gameState.PlayedTiles)
+		if shanten < bestShanten || ukeire > bestUkeire || (ukeire == bestUkeire && isolation(tiles, t) > isolation(tiles, best)) {
+			best, bestShanten, bestUkeire = t, shanten, ukeire
+		}
+	}
+	ai.OnPlayTile(event.PlayTilePayload{
+		PlayerName: ai.Name,
+		Tile:       best,
+	})
+	return best, nil
+}
+
+func (ai *MahjongAI) Take(tiles []int, gameState game.State) (int, []int, error) {
+	if claim := ai.takeClaim(); claim != nil {
+		return claim.operation, claim.tiles, nil
+	}
+	waitPlayerRoom(ai.ID)
+	last := gameState.LastPlayedTile
+	hand := removeTiles(tiles, last)
+	melds := meldCount(len(hand) + 1)
+	current := Shanten(hand, melds)
+	for _, pv := range gameState.SpecialPrivileges[int(ai.ID)] {
+		switch pv {
+		case consts.GANG:
+			if Shanten(removeTiles(hand, last, last, last), melds+1) <= current {
+				return consts.GANG, []int{last, last, last, last}, nil
+			}
+		case consts.PENG:
+			if bestAfterDiscard(removeTiles(hand, last, last), melds+1) < current {
+				return consts.PENG, []int{last, last, last}, nil
+			}
+		case consts.CHI:
+			for _, ts := range card.CanChiTiles(hand, last) {
+				if bestAfterDiscard(removeTiles(hand, ts...), melds+1) < current {
+					return consts.CHI, append(ts, last), nil
+				}
+			}
+		}
+	}
+	return 0, []int{}, nil
+}
+
+// ukeire 能让向听数减少的牌还剩多少张
+func (ai *MahjongAI) ukeire(hand []int, melds, shanten int, played []int) int {
+	seen := countTiles(append(append([]int{}, hand...), played...))
+	count := 0
+	for _, t := range ai.tileKinds() {
+		if seen[t] >= 4 {
+			continue
+		}
+		if Shanten(append(append([]int{}, hand...), t), melds) < shanten {
+			count += 4 - seen[t]
+		}
+	}
+	return count
+}
+
+// tileKinds 血战麻将没有字牌，也不会要缺门的牌
+func (ai *MahjongAI) tileKinds() []int {
+	kinds := make([]int, 0, 34)
+	for _, suit := range []int{tile.WAN, tile.TIAO, tile.BING} {
+		if ai.DingQue && suit == ai.Missing {
+			continue
+		}
+		for j := 1; j <= 9; j++ {
+			kinds = append(kinds, suit*10+j)
+		}
+	}
+	if !ai.DingQue {
+		for j := 1; j <= 4; j++ {
+			kinds = append(kinds, tile.FENG*10+j)
+		}
+		for j := 1; j <= 3; j++ {
+			kinds = append(kinds, tile.DRAGON*10+j)
+		}
+	}
+	return kinds
+}
+
+func meldCount(handLen int) int {
+	return (14 - handLen) / 3
+}
+
+func bestAfterDiscard(hand []int, melds int) int {
+	best := 99
+	for _, t := range uniqueTiles(hand) {
+		if s := Shanten(removeTiles(hand, t), melds); s < best {
+			best = s
+		}
+	}
+	return best
+}
+
+// isolation 孤张程度，字牌和离其它牌越远的牌越先打
+func isolation(hand []int, t int) int {
+	counts := countTiles(hand)
+	if counts[t] > 1 {
+		return 0
+	}
+	if !card.IsSuit(t) {
+		return 3
+	}
+	score := 2
+	for _, d := range []int{-2, -1, 1, 2} {
+		if counts[t+d] > 0 {
+			score--
+		}
+	}
+	return score
+}
+
+func uniqueTiles(tiles []int) []int {
+	seen := map[int]bool{}
+	unique := make([]int, 0, len(tiles))
+	for _, t := range tiles {
+		if !seen[t] {
+			seen[t] = true
+			unique = append(unique, t)
+		}
+	}
+	return unique
+}
+
+func removeTiles(tiles []int, removed ...int) []int {
+	remain := append([]int{}, tiles...)
+	for _, r := range removed {
+		for i, t := range remain {
+			if t == r {
+				remain = append(remain[:i], remain[i+1:]...)
+				break
+			}
+		}
+	}
+	return remain
+}
+
+// Shanten 向听数，0 为听牌，-1 为已胡牌，melds 为已经吃碰杠的组数
+func Shanten(hand []int, melds int) int {
+	counts := make([]int, 50)
+	for _, t := range hand {
+		counts[t]++
+	}
+	best := 8
+	var search func(i, mentsu, taatsu, pair int)
+	search = func(i, mentsu, taatsu, pair int) {
+		for i < len(counts) && counts[i] == 0 {
+			i++
+		}
+		if i >= len(counts) {
+			if mentsu+melds+taatsu > 4 {
+				taatsu = 4 - mentsu - melds
+			}
+			if s := 8 - 2*(mentsu+melds) - taatsu - pair; s < best {
+				best = s
+			}
+			return
+		}
+		suit := card.IsSuit(i)
+		if counts[i] >= 3 {
+			counts[i] -= 3
+			search(i, mentsu+1, taatsu, pair)
+			counts[i] += 3
+		}
+		if suit && i%10 <= 7 && counts[i+1] > 0 && counts[i+2] > 0 {
+			counts[i]--
+			counts[i+1]--
+			counts[i+2]--
+			search(i, mentsu+1, taatsu, pair)
+			counts[i]++
+			counts[i+1]++
+			counts[i+2]++
+		}
+		if counts[i] >= 2 {
+			counts[i] -= 2
+			if pair == 0 {
+				search(i, mentsu, taatsu, 1)
+			}
+			search(i, mentsu, taatsu+1, pair)
+			counts[i] += 2
+		}
+		if suit && i%10 <= 8 && counts[i+1] > 0 {
+			counts[i]--
+			counts[i+1]--
+			search(i, mentsu, taatsu+1, pair)
+			counts[i]++
+			counts[i+1]++
+		}
+		if suit && i%10 <= 7 && counts[i+2] > 0 {
+			counts[i]--
+			counts[i+2]--
+			search(i, mentsu, taatsu+1, pair)
+			counts[i]++
+			counts[i+2]++
+		}
+		counts[i]--
+		search(i, mentsu, taatsu, pair)
+		counts[i]++
+	}
+	search(0, 0, 0, 0)
+
+	// 七对
+	if melds == 0 && len(hand) >= 13 {
+		pairs, kinds := 0, 0
+		for _, n := range counts {
+			if n > 0 {
+				kinds++
+			}
+			if n >= 2 {
+				pairs++
+			}
+		}
+		s := 6 - pairs
+		if kinds < 7 {
+			s += 7 - kinds
+		}
+		if s < best {
+			best = s
+		}
+	}
+	return best
+}
@@ -0,0 +1,25 @@
+package database
+
+import (
+	"testing"
+)
+
+func TestShanten(t *testing.T) {
+	cases := []struct {
+		name    string
+		hand    []int
+		melds   int
+		shanten int
+	}{
+		{"胡牌", []int{1, 2, 3, 14, 15, 16, 22, 23, 24, 31, 31, 31, 9, 9}, 0, -1},
+		{"听牌", []int{1, 2, 3, 14, 15, 16, 22, 23, 24, 31, 31, 31, 9}, 0, 0},
+		{"七对听牌", []int{1, 1, 3, 3, 15, 15, 22, 22, 24, 24, 31, 31, 9}, 0, 0},
+		{"碰后听牌", []int{1, 2, 3, 14, 15, 16, 22, 23, 24, 9}, 1, 0},
+		{"两向听", []int{1, 2, 3, 14, 15, 16, 22, 23, 31, 31, 9, 41, 43}, 0, 2},
+	}
+	for _, c := range cases {
+		if s := Shanten(c.hand, c.melds); s != c.shanten {
+			t.Errorf("%s: shanten %d, want %d", c.name, s, c.shanten)
+		}
+	}
+}
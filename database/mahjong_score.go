@@ -0,0 +1,223 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+
+	mjconsts "github.com/feel-easy/mahjong/consts"
+	"github.com/feel-easy/mahjong/game"
+	"github.com/ratel-online/server/consts"
+)
+
+// MahjongFan 一项番型
+type MahjongFan struct {
+	Name string `json:"name"`
+	Fan  int    `json:"fan"`
+}
+
+// MahjongScore 胡牌的番数和分数
+type MahjongScore struct {
+	Fans   []MahjongFan `json:"fans"`
+	Total  int          `json:"total"`
+	Points uint         `json:"points"`
+}
+
+func (s *MahjongScore) add(name string, fan int) {
+	s.Fans = append(s.Fans, MahjongFan{Name: name, Fan: fan})
+	s.Total += fan
+}
+
+func (s *MahjongScore) String() string {
+	buf := bytes.Buffer{}
+	for _, f := range s.Fans {
+		buf.WriteString(fmt.Sprintf("  %s: %d 番\n", f.Name, f.Fan))
+	}
+	buf.WriteString(fmt.Sprintf("  共 %d 番, %d 分\n", s.Total, s.Points))
+	return buf.String()
+}
+
+// ScoreMahjong 计算胡牌的番数，hand 为包含胡的那张牌在内的暗手牌
+func ScoreMahjong(hand []int, showCards []*game.ShowCard, selfDrawn bool) *MahjongScore {
+	score := &MahjongScore{}
+	tiles := append([]int{}, hand...)
+	kongs := 0
+	for _, sc := range showCards {
+		tiles = append(tiles, sc.GetTiles()...)
+		if sc.GetOpCode() == mjconsts.GANG {
+			kongs++
+		}
+	}
+
+	switch {
+	case isSevenPairs(hand, showCards):
+		score.add("七对", 3)
+	case isAllPungs(hand, showCards):
+		score.add("对对胡", 2)
+	default:
+		score.add("平胡", 1)
+	}
+	switch suitType(tiles) {
+	case suitPure:
+		score.add("清一色", 4)
+	case suitHalf:
+		score.add("混一色", 2)
+	}
+	if selfDrawn {
+		score.add("自摸", 1)
+	}
+	if kongs > 0 {
+		score.add("杠", kongs)
+	}
+
+	fan := score.Total
+	if fan > consts.MahjongMaxFan {
+		fan = consts.MahjongMaxFan
+	}
+	score.Points = consts.MahjongBasePoints << uint(fan-1)
+	return score
+}
+
+func countTiles(tiles []int) map[int]int {
+	counts := map[int]int{}
+	for _, t := range tiles {
+		counts[t]++
+	}
+	return counts
+}
+
+func isSevenPairs(hand []int, showCards []*game.ShowCard) bool {
+	if len(showCards) > 0 || len(hand) != 14 {
+		return false
+	}
+	for _, n := range countTiles(hand) {
+		if n%2 != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func isAllPungs(hand []int, showCards []*game.ShowCard) bool {
+	for _, sc := range showCards {
+		if sc.GetOpCode() == mjconsts.CHI {
+			return false
+		}
+	}
+	counts := countTiles(hand)
+	for pair, n := range counts {
+		if n < 2 {
+			continue
+		}
+		ok := true
+		for t, m := range counts {
+			if t == pair {
+				m -= 2
+			}
+			if m%3 != 0 {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	suitMixed = iota
+	suitHalf
+	suitPure
+)
+
+// suitType 万条饼只有一种时为清一色，再加字牌为混一色
+func suitType(tiles []int) int {
+	suits := map[int]bool{}
+	honors := false
+	for _, t := range tiles {
+		if t/10 > 2 {
+			honors = true
+		} else {
+			suits[t/10] = true
+		}
+	}
+	switch {
+	case len(suits) == 1 && !honors:
+		return suitPure
+	case len(suits) == 1:
+		return suitHalf
+	}
+	return suitMixed
+}
+
+// SettleMahjong 结算胡牌，点炮由放炮的玩家支付，自摸时 discarderId 为 0，由 others 里的玩家各自支付
+// 付款方不足时付清为止，返回实际支付的分数
+func SettleMahjong(winnerId, discarderId int64, others []int64, points uint) map[int64]uint {
+	payerIds := others
+	if discarderId != 0 {
+		payerIds = []int64{discarderId}
+	}
+	paid := map[int64]uint{}
+	winner := GetPlayer(winnerId)
+	if winner == nil {
+		return paid
+	}
+	for _, id := range payerIds {
+		payer := GetPlayer(id)
+		if payer == nil {
+			continue
+		}
+		amount := points
+		if payer.Amount < amount {
+			amount = payer.Amount
+		}
+		payer.Amount -= amount
+		winner.Amount += amount
+		paid[id] = amount
+	}
+	return paid
+}
+
+// ScoreSichuan 血战麻将计番：平胡 0 番，对对胡 1 番，清一色、七对 2 番，龙七对 3 番，每个根（四张相同）和自摸各加 1 番
+func ScoreSichuan(hand []int, showCards []*game.ShowCard, selfDrawn bool) *MahjongScore {
+	score := &MahjongScore{}
+	tiles := append([]int{}, hand...)
+	for _, sc := range showCards {
+		tiles = append(tiles, sc.GetTiles()...)
+	}
+	roots := 0
+	for _, n := range countTiles(tiles) {
+		if n == 4 {
+			roots++
+		}
+	}
+
+	switch {
+	case isSevenPairs(hand, showCards) && roots > 0:
+		score.add("龙七对", 3)
+		roots--
+	case isSevenPairs(hand, showCards):
+		score.add("七对", 2)
+	case isAllPungs(hand, showCards):
+		score.add("对对胡", 1)
+	default:
+		score.add("平胡", 0)
+	}
+	if suitType(tiles) == suitPure {
+		score.add("清一色", 2)
+	}
+	if roots > 0 {
+		score.add("根", roots)
+	}
+	if selfDrawn {
+		score.add("自摸", 1)
+	}
+
+	fan := score.Total
+	if fan > consts.MahjongMaxFan {
+		fan = consts.MahjongMaxFan
+	}
+	score.Points = consts.MahjongBasePoints << uint(fan)
+	return score
+}
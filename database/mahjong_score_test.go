@@ -0,0 +1,68 @@
+package database
+
+import (
+	"testing"
+
+	mjconsts "github.com/feel-easy/mahjong/consts"
+	"github.com/feel-easy/mahjong/game"
+)
+
+func TestScoreMahjong(t *testing.T) {
+	cases := []struct {
+		name      string
+		hand      []int
+		showCards []*game.ShowCard
+		selfDrawn bool
+		total     int
+	}{
+		{"平胡", []int{1, 2, 3, 14, 15, 16, 22, 23, 24, 31, 31, 31, 9, 9}, nil, false, 1},
+		{"七对", []int{1, 1, 3, 3, 15, 15, 22, 22, 24, 24, 31, 31, 9, 9}, nil, false, 3},
+		{"清一色七对自摸", []int{1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6, 9, 9}, nil, true, 8},
+		{"对对胡带杠", []int{1, 1, 1, 15, 15, 15, 9, 9, 9, 22, 22},
+			[]*game.ShowCard{game.NewShowCard(mjconsts.GANG, 0, []int{41, 41, 41, 41}, true, false)}, false, 3},
+		{"混一色", []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 31, 31, 31, 42, 42}, nil, false, 3},
+	}
+	for _, c := range cases {
+		score := ScoreMahjong(c.hand, c.showCards, c.selfDrawn)
+		if score.Total != c.total {
+			t.Errorf("%s: total fan %d, want %d (%v)", c.name, score.Total, c.total, score.Fans)
+		}
+	}
+}
+
+func TestScoreSichuan(t *testing.T) {
+	cases := []struct {
+		name      string
+		hand      []int
+		selfDrawn bool
+		total     int
+	}{
+		{"平胡", []int{1, 2, 3, 14, 15, 16, 22, 23, 24, 25, 25, 25, 9, 9}, false, 0},
+		{"龙七对", []int{1, 1, 1, 1, 15, 15, 22, 22, 24, 24, 25, 25, 9, 9}, false, 3},
+		{"清一色对对胡自摸", []int{1, 1, 1, 3, 3, 3, 5, 5, 5, 7, 7, 7, 9, 9}, true, 4},
+	}
+	for _, c := range cases {
+		score := ScoreSichuan(c.hand, nil, c.selfDrawn)
+		if score.Total != c.total {
+			t.Errorf("%s: total fan %d, want %d (%v)", c.name, score.Total, c.total, score.Fans)
+		}
+	}
+}
+
+func TestSettleMahjong(t *testing.T) {
+	newTestStore(t)
+	for id := int64(8101); id <= 8104; id++ {
+		store.SetPlayer(&Player{ID: id, Amount: 10})
+	}
+	// 自摸时其他玩家各自支付，不足时付清为止
+	GetPlayer(8104).Amount = 3
+	paid := SettleMahjong(8101, 0, []int64{8102, 8103, 8104}, 5)
+	if paid[8102] != 5 || paid[8103] != 5 || paid[8104] != 3 || GetPlayer(8101).Amount != 23 {
+		t.Fatalf("self-drawn payments %v, winner has %d", paid, GetPlayer(8101).Amount)
+	}
+	// 点炮只由放炮的玩家支付
+	paid = SettleMahjong(8102, 8103, []int64{8101, 8103, 8104}, 4)
+	if len(paid) != 1 || paid[8103] != 4 || GetPlayer(8101).Amount != 23 || GetPlayer(8102).Amount != 9 {
+		t.Fatalf("discard payments %v", paid)
+	}
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"testing"
+
+	mjconsts "github.com/feel-easy/mahjong/consts"
+	"github.com/feel-easy/mahjong/game"
+	"github.com/feel-easy/mahjong/tile"
+	"github.com/ratel-online/core/network"
+	"github.com/ratel-online/core/protocol"
+)
+
+func TestTakeSichuan(t *testing.T) {
+	alice := &Player{ID: 8201, Name: "Alice", online: true, conn: network.Wrapper(&fakeConn{})}
+	bob := &Player{ID: 8202, Name: "Bob", online: true, conn: network.Wrapper(&fakeConn{}), data: make(chan *protocol.Packet, 1)}
+	newTestStore(t, alice, bob)
+	players := map[int]*MahjongPlayer{8201: NewPlayer(alice), 8202: NewPlayer(bob)}
+	mj := &Mahjong{
+		PlayerIDs: []int{8201, 8202},
+		Game:      game.New([]game.Player{players[8201], players[8202]}),
+		Players:   players,
+		Sichuan:   true,
+		Wall:      NewSichuanWall(),
+	}
+	alicePC := mj.Game.Players().GetPlayerController(8201)
+	bobPC := mj.Game.Players().GetPlayerController(8202)
+	alicePC.AddTiles(mj.DrawTiles(13))
+	bobPC.AddTiles([]int{1, 1, 12, 13, 14, 22, 23, 24, 25, 26, 27, 28, 29})
+	for mj.Game.Current().ID() != 8202 {
+		mj.Game.Next()
+	}
+	// Alice 打出一万，Bob 可以碰
+	claim := func(answer string) (bool, error) {
+		mj.Game.Pile().Add(1)
+		mj.Game.Pile().SetLastPlayer(alicePC)
+		mj.Game.Pile().SetOriginallyPlayer(bobPC)
+		state := mj.Game.ExtractState(bobPC)
+		mj.FilterState(&state)
+		bob.data <- &protocol.Packet{Body: []byte(answer)}
+		_, ok, err := mj.TakeSichuan(state)
+		return ok, err
+	}
+
+	// 放弃时不从库自带的牌墙摸牌，手里不会出现字牌
+	if ok, err := claim("2"); ok || err != nil {
+		t.Fatalf("bob should decline, ok %v err %v", ok, err)
+	}
+	if hand := bobPC.Hand(); len(hand) != 13 {
+		t.Fatalf("declining should not draw, got %s", tile.ToTileString(hand))
+	}
+	for _, tl := range bobPC.Hand() {
+		if tl/10 >= tile.FENG {
+			t.Fatalf("sichuan hands should not hold honors, got %s", tile.ToTileString(bobPC.Hand()))
+		}
+	}
+
+	if ok, err := claim("1"); !ok || err != nil {
+		t.Fatalf("bob should pung, ok %v err %v", ok, err)
+	}
+	if shows := bobPC.GetShowCard(); len(shows) != 1 || shows[0].GetOpCode() != mjconsts.PENG {
+		t.Fatalf("pung should be shown, got %v", shows)
+	}
+}
@@ -0,0 +1,147 @@
+package database
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ratel-online/core/log"
+	"github.com/ratel-online/server/consts"
+)
+
+type matchEntry struct {
+	player *Player
+	rating int
+	joined time.Time
+}
+
+// window 等待越久，能接受的分差越大
+func (e *matchEntry) window(now time.Time) int {
+	steps := int(now.Sub(e.joined) / consts.MatchWidenInterval)
+	return consts.MatchRatingWindow + steps*consts.MatchWindowStep
+}
+
+var matchLock sync.Mutex
+var matchQueues = map[int][]*matchEntry{}
+
+// EnqueueMatch 加入某种玩法的快速匹配队列
+func EnqueueMatch(player *Player, gameType int) {
+	matchLock.Lock()
+	defer matchLock.Unlock()
+	dequeueMatch(player.ID)
+	matchQueues[gameType] = append(matchQueues[gameType], &matchEntry{
+		player: player,
+		rating: player.Rating(gameType),
+		joined: time.Now(),
+	})
+}
+
+// DequeueMatch 退出快速匹配队列
+func DequeueMatch(playerId int64) {
+	matchLock.Lock()
+	defer matchLock.Unlock()
+	dequeueMatch(playerId)
+}
+
+func dequeueMatch(playerId int64) {
+	for gameType, queue := range matchQueues {
+		for i, e := range queue {
+			if e.player.ID == playerId {
+				matchQueues[gameType] = append(queue[:i], queue[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// MatchWindow 玩家当前可接受的分差和队列人数
+func MatchWindow(playerId int64, gameType int) (window, queued int) {
+	matchLock.Lock()
+	defer matchLock.Unlock()
+	queue := matchQueues[gameType]
+	for _, e := range queue {
+		if e.player.ID == playerId {
+			window = e.window(time.Now())
+		}
+	}
+	return window, len(queue)
+}
+
+// Match 队列里凑够一桌分差合适的玩家时，创建房间并让他们入座，返回新房间
+// 已经掉线的玩家移出队列，新房间开启自动开局并替所有人准备好，由房间倒计时后开局
+// 有玩家加入失败时不开房，其他玩家按原来的排队时间回到队列
+func Match(gameType int) *Room {
+	matchLock.Lock()
+	defer matchLock.Unlock()
+	queue := make([]*matchEntry, 0, len(matchQueues[gameType]))
+	for _, e := range matchQueues[gameType] {
+		if e.player.IsOnline() {
+			queue = append(queue, e)
+		}
+	}
+	matchQueues[gameType] = queue
+	group := matchGroup(queue, consts.MatchTableSizes[gameType], time.Now())
+	if group == nil {
+		return nil
+	}
+	for _, e := range group {
+		dequeueMatch(e.player.ID)
+	}
+	room := CreateRoom(group[0].player.ID, gameType)
+	room.MaxPlayers = len(group)
+	room.EnableAutoStart = true
+	for i, e := range group {
+		if err := JoinRoom(room.ID, e.player.ID); err != nil {
+			log.Infof("[match] player %d failed to join room %d: %v\n", e.player.ID, room.ID, err)
+			for _, joined := range group[:i] {
+				LeaveRoom(room.ID, joined.player.ID)
+			}
+			deleteRoom(room)
+			requeue := append(group[:i:i], group[i+1:]...)
+			matchQueues[gameType] = append(requeue, matchQueues[gameType]...)
+			return nil
+		}
+	}
+	for _, e := range group {
+		ToggleReady(room, e.player.ID)
+	}
+	return room
+}
+
+// matchGroup 从等待最久的玩家开始，挑选分差同时在双方范围内、分数最接近的 size-1 名玩家
+func matchGroup(queue []*matchEntry, size int, now time.Time) []*matchEntry {
+	if size <= 0 || len(queue) < size {
+		return nil
+	}
+	entries := append([]*matchEntry{}, queue...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].joined.Before(entries[j].joined)
+	})
+	for i, anchor := range entries {
+		candidates := make([]*matchEntry, 0, len(entries))
+		for j, e := range entries {
+			if i == j {
+				continue
+			}
+			diff := abs(e.rating - anchor.rating)
+			if diff <= anchor.window(now) && diff <= e.window(now) {
+				candidates = append(candidates, e)
+			}
+		}
+		if len(candidates) < size-1 {
+			continue
+		}
+		sort.SliceStable(candidates, func(a, b int) bool {
+			return abs(candidates[a].rating-anchor.rating) < abs(candidates[b].rating-anchor.rating)
+		})
+		return append([]*matchEntry{anchor}, candidates[:size-1]...)
+	}
+	return nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
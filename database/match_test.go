@@ -0,0 +1,85 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ratel-online/core/network"
+	"github.com/ratel-online/server/consts"
+)
+
+func TestMatchGroup(t *testing.T) {
+	now := time.Now()
+	entry := func(id int64, rating int, waited time.Duration) *matchEntry {
+		return &matchEntry{player: &Player{ID: id}, rating: rating, joined: now.Add(-waited)}
+	}
+	queue := []*matchEntry{
+		entry(1, 1500, 0),
+		entry(2, 1560, 0),
+		entry(3, 1900, 0),
+	}
+	if group := matchGroup(queue, 3, now); group != nil {
+		t.Fatalf("rating 1900 should be out of window, got %d players", len(group))
+	}
+	if group := matchGroup(queue, 2, now); len(group) != 2 || group[1].player.ID != 2 {
+		t.Fatalf("expected players 1 and 2 to be matched")
+	}
+
+	// 等待足够久后分差范围放宽
+	waited := time.Duration((400-consts.MatchRatingWindow)/consts.MatchWindowStep) * consts.MatchWidenInterval
+	queue = []*matchEntry{
+		entry(1, 1500, waited),
+		entry(2, 1560, waited),
+		entry(3, 1900, waited),
+	}
+	if group := matchGroup(queue, 3, now); len(group) != 3 {
+		t.Fatalf("expected widened window to match all players")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	newTestStore(t)
+	players := make([]*Player, 0)
+	for id := int64(7901); id <= 7904; id++ {
+		p := &Player{ID: id, Name: fmt.Sprintf("p%d", id), online: id != 7902, conn: network.Wrapper(&fakeConn{})}
+		players = append(players, p)
+		store.SetPlayer(p)
+		EnqueueMatch(p, consts.GameTypeClassic)
+		defer DequeueMatch(id)
+	}
+	room := Match(consts.GameTypeClassic)
+	if room == nil {
+		t.Fatalf("three online players should be matched")
+	}
+	defer deleteRoom(room)
+	if players[1].RoomID != 0 || room.Players != 3 || !room.EnableAutoStart {
+		t.Fatalf("offline players should not be matched, room has %d players", room.Players)
+	}
+	for _, p := range players {
+		if p.RoomID == room.ID && !room.IsReady(p.ID) {
+			t.Fatalf("matched players should be ready")
+		}
+	}
+	if _, queued := MatchWindow(7902, consts.GameTypeClassic); queued != 0 {
+		t.Fatalf("offline players should leave the queue, %d queued", queued)
+	}
+
+	// 有玩家加入失败时不开房，其他玩家回到队列
+	for _, p := range players[2:] {
+		LeaveRoom(room.ID, p.ID)
+		EnqueueMatch(p, consts.GameTypeClassic)
+	}
+	LeaveRoom(room.ID, players[0].ID)
+	players[0].IP = "10.0.0.3"
+	bans[banKey(BanIP, "10.0.0.3")] = &Ban{Kind: BanIP, Target: "10.0.0.3"}
+	defer delete(bans, banKey(BanIP, "10.0.0.3"))
+	EnqueueMatch(players[0], consts.GameTypeClassic)
+	rooms := len(GetRooms())
+	if room := Match(consts.GameTypeClassic); room != nil || len(GetRooms()) != rooms {
+		t.Fatalf("no room should be left when a player fails to join")
+	}
+	if _, queued := MatchWindow(7903, consts.GameTypeClassic); queued != 2 || players[2].RoomID != 0 || players[3].RoomID != 0 {
+		t.Fatalf("other players should be requeued, %d queued", queued)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ratel-online/core/log"
@@ -51,16 +52,48 @@ type Player struct {
 	Role   Role   `json:"role"`
 
 	conn   *network.Conn
+	out    *outbox // 连接的发送队列
 	data   chan *protocol.Packet
-	read   bool
+	read   int32         // 是否把客户端的输入交给 data，连接读取协程和状态机都会访问
+	closed chan struct{} // 掉线时关闭
 	state  consts.StateID
 	online bool
+	admin  bool
+	ai     bool
+	invite string
+	muted  map[int64]bool // 屏蔽了聊天的玩家
+	// 最近一位私聊自己的玩家，用来回复
+	replyTo int64
+	chat    chatLimiter
+	// 房间列表的筛选条件，只在玩家自己的状态机里使用
+	roomFilter *RoomFilter
+
+	account *Account // 登录身份对应的账号
 }
 
 func (p *Player) Write(bytes []byte) error {
-	return p.conn.Write(protocol.Packet{
-		Body: bytes,
-	})
+	if p.ai {
+		return nil
+	}
+	return p.send(bytes, false)
+}
+
+// send 消息放进连接的发送队列，没有发送队列时直接写出
+func (p *Player) send(body []byte, text bool) error {
+	if p.out == nil {
+		return p.conn.Write(protocol.Packet{
+			Body: body,
+		})
+	}
+	return p.out.push(body, text)
+}
+
+// disconnect 等发送队列里剩下的消息写出后断开连接
+func (p *Player) disconnect() {
+	if p.out != nil {
+		p.out.flush(consts.OutboxFlushTimeout)
+	}
+	_ = p.conn.Close()
 }
 
 func (p *Player) IsOnline() bool {
@@ -70,7 +103,11 @@ func (p *Player) IsOnline() bool {
 func (p *Player) Offline() {
 	p.online = false
 	_ = p.conn.Close()
+	if p.out != nil {
+		p.out.drop()
+	}
 	close(p.data)
+	close(p.closed)
 	room := getRoom(p.RoomID)
 	if room != nil {
 		room.Lock()
@@ -95,7 +132,10 @@ func (p *Player) Listening() error {
 			log.Error(err)
 			return err
 		}
-		if p.read {
+		if p.handlePause(pack.String()) {
+			continue
+		}
+		if atomic.LoadInt32(&p.read) == 1 {
 			p.data <- pack
 		}
 	}
@@ -103,25 +143,24 @@ func (p *Player) Listening() error {
 
 // 向客户端发生消息
 func (p *Player) WriteString(data string) error {
-	time.Sleep(30 * time.Millisecond)
-	return p.conn.Write(protocol.Packet{
-		Body: []byte(data),
-	})
+	if p.ai {
+		return nil
+	}
+	return p.send([]byte(data), true)
 }
 
 func (p *Player) WriteObject(data interface{}) error {
-	return p.conn.Write(protocol.Packet{
-		Body: json.Marshal(data),
-	})
+	if p.ai {
+		return nil
+	}
+	return p.send(json.Marshal(data), false)
 }
 
 func (p *Player) WriteError(err error) error {
-	if err == consts.ErrorsExist {
+	if err == consts.ErrorsExist || p.ai {
 		return err
 	}
-	return p.conn.Write(protocol.Packet{
-		Body: []byte(err.Error() + "\n"),
-	})
+	return p.send([]byte(err.Error()+"\n"), true)
 }
 
 func (p *Player) AskForPacket(timeout ...time.Duration) (*protocol.Packet, error) {
@@ -131,6 +170,9 @@ func (p *Player) AskForPacket(timeout ...time.Duration) (*protocol.Packet, error
 }
 
 func (p *Player) askForPacket(timeout ...time.Duration) (*protocol.Packet, error) {
+	if p.ai {
+		return nil, consts.ErrorsTimeout
+	}
 	var packet *protocol.Packet
 	if len(timeout) > 0 {
 		select {
@@ -184,13 +226,21 @@ func (p *Player) AskForStringWithoutTransaction(timeout ...time.Duration) (strin
 }
 
 func (p *Player) StartTransaction() {
-	p.read = true
-	_ = p.WriteString(consts.IsStart)
+	atomic.StoreInt32(&p.read, 1)
+	_ = p.signal(consts.IsStart)
 }
 
 func (p *Player) StopTransaction() {
-	p.read = false
-	_ = p.WriteString(consts.IsStop)
+	atomic.StoreInt32(&p.read, 0)
+	_ = p.signal(consts.IsStop)
+}
+
+// signal 交互信号单独成包，不和其他文本合并
+func (p *Player) signal(s string) error {
+	if p.ai {
+		return nil
+	}
+	return p.send([]byte(s), false)
 }
 
 func (p *Player) State(s consts.StateID) {
@@ -203,7 +253,9 @@ func (p *Player) GetState() consts.StateID {
 
 func (p *Player) Conn(conn *network.Conn) {
 	p.conn = conn
+	p.out = newOutbox(conn)
 	p.data = make(chan *protocol.Packet, 8)
+	p.closed = make(chan struct{})
 	p.online = true
 }
 
@@ -242,7 +294,9 @@ type Room struct {
 	Creator             int64     `json:"creator"`
 	ActiveTime          time.Time `json:"activeTime"`
 	MaxPlayers          int       `json:"maxPlayers"`
-	Password            string    `json:"password"`
+	Password            string    `json:"-"` // 加盐哈希
+	Private             bool      `json:"private"`
+	InviteCode          string    `json:"-"`
 	EnableChat          bool      `json:"enableChat"`
 	EnableLaiZi         bool      `json:"enableLaiZi"`
 	EnableSkill         bool      `json:"enableSkill"`
@@ -250,6 +304,37 @@ type Room struct {
 	EnableDontShuffle   bool      `json:"enableDontShuffle"`
 	EnableShowIP        bool      `json:"enableShowIP"`
 	EnableJokerAsTarget bool      `json:"enableJokerAsTarget"`
+	EnableCasual        bool      `json:"enableCasual"`
+	EnableWildOnes      bool      `json:"enableWildOnes"`
+	EnableSpotOn        bool      `json:"enableSpotOn"`
+	EnableUnoStacking   bool      `json:"enableUnoStacking"`
+	EnableUnoChallenge  bool      `json:"enableUnoChallenge"`
+	EnableUnoCall       bool      `json:"enableUnoCall"`
+	EnableUnoJumpIn     bool      `json:"enableUnoJumpIn"`
+	UnoTargetScore      int       `json:"unoTargetScore"`
+	EnableSichuan       bool      `json:"enableSichuan"`
+
+	EnableAutoStart bool   `json:"enableAutoStart"`
+	UnreadyPolicy   string `json:"unreadyPolicy"`
+	RematchSeats    string `json:"rematchSeats"`
+	EnableReveal    bool   `json:"enableReveal"`
+	RevealDelay     int    `json:"revealDelay"` // 观众看到所有手牌的延迟秒数
+
+	passwordSalt string
+	ready        map[int64]bool
+	fullSince    time.Time // 房间坐满的时间，用来判断准备超时
+	startAt      time.Time // 自动开局的时间
+	countdown    int       // 最近一次广播的倒计时
+	kickVote     *KickVote
+	seats        []int64         // 每个座位上的玩家，0 为空座，开局按座位顺序排列玩家
+	swaps        map[int64]int64 // 换座请求，发起人 -> 对方
+	rematch      *Rematch
+	tableRefresh int32      // 有新的广播，牌桌等待事件循环刷新
+	timer        *TurnTimer // 当前对局的回合计时器
+	loop         *GameLoop  // 当前对局的事件循环
+	pauseVote    *PauseVote
+	resumed      chan struct{} // 对局暂停时不为空，恢复时关闭
+	chatHistory  []string      // 最近的聊天，展示给后加入的玩家
 }
 
 func (r *Room) Model() model.Room {
@@ -265,37 +350,31 @@ func (r *Room) Model() model.Room {
 }
 
 type Game struct {
-	Room        *Room                   `json:"room"`
-	Players     []int64                 `json:"players"`
-	Groups      map[int64]int           `json:"groups"`
-	States      map[int64]chan int      `json:"states"`
-	Pokers      map[int64]model.Pokers  `json:"pokers"`
-	Universals  []int                   `json:"universals"`
-	Decks       int                     `json:"decks"`
-	Additional  model.Pokers            `json:"pocket"`
-	Multiple    int                     `json:"multiple"`
-	FirstPlayer int64                   `json:"firstPlayer"`
-	LastPlayer  int64                   `json:"lastPlayer"`
-	Robs        []int64                 `json:"robs"`
-	FirstRob    int64                   `json:"firstRob"`
-	LastRob     int64                   `json:"lastRob"`
-	FinalRob    bool                    `json:"finalRob"`
-	LastFaces   *model.Faces            `json:"lastFaces"`
-	LastPokers  model.Pokers            `json:"lastPokers"`
-	Mnemonic    map[int]int             `json:"mnemonic"`
-	Skills      map[int64]int           `json:"skills"`
-	PlayTimes   map[int64]int           `json:"playTimes"`
-	PlayTimeOut map[int64]time.Duration `json:"playTimeOut"`
-	Rules       poker.Rules             `json:"rules"`
-	Discards    model.Pokers            `json:"discards"`
+	Room        *Room                  `json:"room"`
+	Loop        *GameLoop              `json:"-"` // 本局的事件循环
+	Players     []int64                `json:"players"`
+	Groups      map[int64]int          `json:"groups"`
+	Pokers      map[int64]model.Pokers `json:"pokers"`
+	Universals  []int                  `json:"universals"`
+	Decks       int                    `json:"decks"`
+	Additional  model.Pokers           `json:"pocket"`
+	Multiple    int                    `json:"multiple"`
+	FirstPlayer int64                  `json:"firstPlayer"`
+	LastPlayer  int64                  `json:"lastPlayer"`
+	Robs        []int64                `json:"robs"`
+	FirstRob    int64                  `json:"firstRob"`
+	LastRob     int64                  `json:"lastRob"`
+	FinalRob    bool                   `json:"finalRob"`
+	LastFaces   *model.Faces           `json:"lastFaces"`
+	LastPokers  model.Pokers           `json:"lastPokers"`
+	Mnemonic    map[int]int            `json:"mnemonic"`
+	Skills      map[int64]int          `json:"skills"`
+	PlayTimes   map[int64]int          `json:"playTimes"`
+	Rules       poker.Rules            `json:"rules"`
+	Discards    model.Pokers           `json:"discards"`
 }
 
 func (game *Game) Clean() {
-	if game != nil {
-		for _, state := range game.States {
-			close(state)
-		}
-	}
 }
 
 func (game *Game) Start() {
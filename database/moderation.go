@@ -0,0 +1,167 @@
+package database
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ratel-online/server/consts"
+)
+
+// 投票踢人的结果
+const (
+	VotePending = iota
+	VotePassed
+	VoteRejected
+)
+
+// KickVote 投票踢人，入座的玩家（被投票的玩家除外）超过半数同意即踢出
+type KickVote struct {
+	Initiator int64          `json:"initiator"`
+	Target    int64          `json:"target"`
+	Votes     map[int64]bool `json:"votes"`
+	Deadline  time.Time      `json:"deadline"`
+}
+
+// Count 同意和反对的票数，以及有投票权的人数
+func (v *KickVote) Count(room *Room) (yes, no, voters int) {
+	for id := range getRoomPlayers(room.ID) {
+		if p := getPlayer(id); p == nil || p.ai || id == v.Target {
+			continue
+		}
+		voters++
+		if agree, ok := v.Votes[id]; ok {
+			if agree {
+				yes++
+			} else {
+				no++
+			}
+		}
+	}
+	return
+}
+
+func (v *KickVote) result(room *Room) int {
+	yes, no, voters := v.Count(room)
+	switch {
+	case yes*2 > voters:
+		return VotePassed
+	case no*2 >= voters || time.Now().After(v.Deadline):
+		return VoteRejected
+	}
+	return VotePending
+}
+
+// StartKickVote 发起投票踢人，发起人默认同意
+func StartKickVote(room *Room, initiator, target int64) (*KickVote, int, error) {
+	room.Lock()
+	defer room.Unlock()
+	if room.kickVote != nil {
+		return nil, VotePending, consts.ErrorsVoteInProgress
+	}
+	if initiator == target {
+		return nil, VotePending, consts.ErrorsCannotKickYourself
+	}
+	if _, ok := getRoomPlayers(room.ID)[target]; !ok {
+		return nil, VotePending, consts.ErrorsPlayerNotInRoom
+	}
+	if _, ok := getRoomPlayers(room.ID)[initiator]; !ok {
+		return nil, VotePending, consts.ErrorsVoteDenied
+	}
+	vote := &KickVote{
+		Initiator: initiator,
+		Target:    target,
+		Votes:     map[int64]bool{initiator: true},
+		Deadline:  time.Now().Add(consts.KickVoteTimeout),
+	}
+	room.kickVote = vote
+	return vote, settleKickVote(room), nil
+}
+
+// CastKickVote 入座的玩家投票
+func CastKickVote(room *Room, voter int64, agree bool) (*KickVote, int, error) {
+	room.Lock()
+	defer room.Unlock()
+	vote := room.kickVote
+	if vote == nil {
+		return nil, VotePending, consts.ErrorsNoVote
+	}
+	if _, ok := getRoomPlayers(room.ID)[voter]; !ok || voter == vote.Target {
+		return nil, VotePending, consts.ErrorsVoteDenied
+	}
+	vote.Votes[voter] = agree
+	return vote, settleKickVote(room), nil
+}
+
+// KickVoteTick 检查投票是否超时，超时的投票只会返回一次
+func KickVoteTick(room *Room) (*KickVote, int) {
+	room.Lock()
+	defer room.Unlock()
+	vote := room.kickVote
+	if vote == nil {
+		return nil, VotePending
+	}
+	return vote, settleKickVote(room)
+}
+
+func settleKickVote(room *Room) int {
+	result := room.kickVote.result(room)
+	if result != VotePending {
+		room.kickVote = nil
+	}
+	return result
+}
+
+// TransferOwner 房主把房主转让给其他入座的玩家
+func TransferOwner(room *Room, playerId int64) error {
+	room.Lock()
+	defer room.Unlock()
+	target := getPlayer(playerId)
+	if _, ok := getRoomPlayers(room.ID)[playerId]; !ok || target == nil || target.ai {
+		return consts.ErrorsPlayerNotInRoom
+	}
+	if owner := getPlayer(room.Creator); owner != nil {
+		owner.Role = RolePlayer
+	}
+	room.Creator = playerId
+	target.Role = RoleOwner
+	return nil
+}
+
+var muteLock sync.RWMutex
+
+// ToggleMute 屏蔽或取消屏蔽某位玩家的聊天，只对自己生效，返回切换后是否屏蔽
+func (p *Player) ToggleMute(playerId int64) bool {
+	muteLock.Lock()
+	defer muteLock.Unlock()
+	if p.muted == nil {
+		p.muted = map[int64]bool{}
+	}
+	if p.muted[playerId] {
+		delete(p.muted, playerId)
+		return false
+	}
+	p.muted[playerId] = true
+	return true
+}
+
+func (p *Player) HasMuted(playerId int64) bool {
+	muteLock.RLock()
+	defer muteLock.RUnlock()
+	return p.muted[playerId]
+}
+
+// mutedBy 房间里屏蔽了发言玩家的人
+func mutedBy(room *Room, speaker int64) []int64 {
+	ids := make([]int64, 0)
+	for id := range getRoomPlayers(room.ID) {
+		if p := getPlayer(id); p != nil && p.HasMuted(speaker) {
+			ids = append(ids, id)
+		}
+	}
+	for id := range getRoomSpectators(room.ID) {
+		if p := getPlayer(id); p != nil && p.HasMuted(speaker) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,35 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/ratel-online/server/consts"
+)
+
+func TestKickVote(t *testing.T) {
+	room := newTestRoom(t, consts.GameTypeClassic, 4, &Player{ID: 3001}, &Player{ID: 3002}, &Player{ID: 3003}, &Player{ID: 3004})
+
+	if _, _, err := StartKickVote(room, 3001, 3001); err != consts.ErrorsCannotKickYourself {
+		t.Fatalf("should not vote to kick yourself, err: %v", err)
+	}
+	_, result, err := StartKickVote(room, 3001, 3004)
+	if err != nil || result != VotePending {
+		t.Fatalf("vote should be pending, result %d err %v", result, err)
+	}
+	if _, _, err := CastKickVote(room, 3004, false); err != consts.ErrorsVoteDenied {
+		t.Fatalf("target should not vote, err: %v", err)
+	}
+	if _, result, _ := CastKickVote(room, 3002, true); result != VotePassed {
+		t.Fatalf("2 of 3 voters should pass, result %d", result)
+	}
+	if _, _, err := CastKickVote(room, 3003, true); err != consts.ErrorsNoVote {
+		t.Fatalf("vote should be closed, err: %v", err)
+	}
+
+	if err := TransferOwner(room, 3002); err != nil || room.Creator != 3002 || GetPlayer(3001).Role != RolePlayer {
+		t.Fatalf("ownership should be transferred, err: %v", err)
+	}
+	if !GetPlayer(3001).ToggleMute(3002) || !GetPlayer(3001).HasMuted(3002) || GetPlayer(3001).ToggleMute(3002) {
+		t.Fatalf("mute should toggle")
+	}
+}
@@ -0,0 +1,172 @@
+package database
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/ratel-online/core/log"
+	"github.com/ratel-online/core/network"
+	"github.com/ratel-online/core/protocol"
+	"github.com/ratel-online/core/util/async"
+	"github.com/ratel-online/server/consts"
+)
+
+// outbox 连接的发送队列，消息由单独的协程按顺序写出，每个包完整写出后才写下一个
+// 广播只把消息放进队列，慢的客户端不会拖慢房间里的其他人
+type outbox struct {
+	sync.Mutex
+	conn   *network.Conn
+	queue  []outPacket
+	size   int       // 队列里还没写出的字节数
+	since  time.Time // 最早一条还没写出的消息入队的时间，没有积压时为零
+	closed bool
+	wake   chan struct{}
+	done   chan struct{} // 写出协程退出时关闭
+}
+
+type outPacket struct {
+	body []byte
+	text bool // 文本消息可以和相邻的文本合并成一个包
+}
+
+func newOutbox(conn *network.Conn) *outbox {
+	o := &outbox{
+		conn: conn,
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	async.Async(o.run)
+	return o
+}
+
+// push 消息入队，队列积压过多或太久没有写出时判定为慢客户端并断开连接
+func (o *outbox) push(body []byte, text bool) error {
+	o.Lock()
+	if o.closed {
+		o.Unlock()
+		return consts.ErrorsChanClosed
+	}
+	if o.size+len(body) > consts.OutboxMaxBytes || (!o.since.IsZero() && time.Since(o.since) > consts.OutboxStallTimeout) {
+		o.Unlock()
+		o.slow()
+		return consts.ErrorsSlowConsumer
+	}
+	if o.since.IsZero() {
+		o.since = time.Now()
+	}
+	o.queue = append(o.queue, outPacket{body: body, text: text})
+	o.size += len(body)
+	o.Unlock()
+	o.notify()
+	return nil
+}
+
+func (o *outbox) notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (o *outbox) run() {
+	defer close(o.done)
+	for {
+		packets, ok := o.take()
+		if !ok {
+			return
+		}
+		for _, packet := range packets {
+			if err := o.conn.Write(packet); err != nil {
+				log.Error(err)
+				o.drop()
+				return
+			}
+		}
+		o.Lock()
+		o.since = time.Time{}
+		if len(o.queue) > 0 {
+			o.since = time.Now()
+		}
+		o.Unlock()
+	}
+}
+
+// take 取出队列里的全部消息，队列为空时阻塞，关闭并写完后返回 false
+func (o *outbox) take() ([]protocol.Packet, bool) {
+	for {
+		o.Lock()
+		if len(o.queue) > 0 {
+			queue := o.queue
+			o.queue = nil
+			o.size = 0
+			o.Unlock()
+			return coalesce(queue), true
+		}
+		closed := o.closed
+		o.Unlock()
+		if closed {
+			return nil, false
+		}
+		<-o.wake
+	}
+}
+
+// coalesce 把相邻的文本合并成一个包，只在整行结束的地方合并，交互信号和对象消息单独成包
+func coalesce(queue []outPacket) []protocol.Packet {
+	packets := make([]protocol.Packet, 0, len(queue))
+	merging := false
+	for _, p := range queue {
+		last := len(packets) - 1
+		if merging && p.text && len(packets[last].Body)+len(p.body) <= consts.OutboxCoalesceSize {
+			packets[last].Body = append(packets[last].Body, p.body...)
+		} else {
+			packets = append(packets, protocol.Packet{Body: append([]byte(nil), p.body...)})
+		}
+		merging = p.text && bytes.HasSuffix(p.body, []byte("\n"))
+	}
+	return packets
+}
+
+// close 不再接收新消息，已经入队的消息继续写出
+func (o *outbox) close() {
+	o.Lock()
+	o.closed = true
+	o.Unlock()
+	o.notify()
+}
+
+// drop 丢弃还没写出的消息
+func (o *outbox) drop() {
+	o.Lock()
+	o.closed = true
+	o.queue = nil
+	o.size = 0
+	o.Unlock()
+	o.notify()
+}
+
+// slow 慢客户端丢弃积压的消息并断开连接，读取失败后按掉线处理
+func (o *outbox) slow() {
+	o.Lock()
+	if o.closed {
+		o.Unlock()
+		return
+	}
+	o.closed = true
+	o.queue = nil
+	o.size = 0
+	o.Unlock()
+	o.notify()
+	log.Infof("connection %d is too slow to receive messages, disconnected\n", o.conn.ID())
+	_ = o.conn.Close()
+}
+
+// flush 关闭队列并等待剩下的消息写完，最多等待 timeout
+func (o *outbox) flush(timeout time.Duration) {
+	o.close()
+	select {
+	case <-o.done:
+	case <-time.After(timeout):
+	}
+}
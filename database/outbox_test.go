@@ -0,0 +1,121 @@
+package database
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ratel-online/core/network"
+	"github.com/ratel-online/core/protocol"
+	"github.com/ratel-online/server/consts"
+)
+
+// blockingConn 每次写出都要等测试放行
+type blockingConn struct {
+	written chan string
+	release chan struct{}
+	closed  chan struct{}
+}
+
+func newBlockingConn() *blockingConn {
+	return &blockingConn{written: make(chan string, 100), release: make(chan struct{}), closed: make(chan struct{})}
+}
+
+func (c *blockingConn) Read() (*protocol.Packet, error) { return nil, consts.ErrorsChanClosed }
+func (c *blockingConn) Write(msg protocol.Packet) error {
+	select {
+	case <-c.release:
+	case <-c.closed:
+		return consts.ErrorsChanClosed
+	}
+	c.written <- string(msg.Body)
+	return nil
+}
+func (c *blockingConn) Close() error {
+	select {
+	case <-c.closed:
+	default:
+		close(c.closed)
+	}
+	return nil
+}
+func (c *blockingConn) IP() string { return "127.0.0.1" }
+
+// waitTaken 等写出协程取走队列里的消息
+func waitTaken(o *outbox) {
+	for {
+		o.Lock()
+		n := len(o.queue)
+		o.Unlock()
+		if n == 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	packets := coalesce([]outPacket{
+		{body: []byte("a\n"), text: true},
+		{body: []byte("b\n"), text: true},
+		{body: []byte(consts.IsStart)},
+		{body: []byte("c"), text: true},
+		{body: []byte("d\n"), text: true},
+		{body: []byte("e\n"), text: true},
+		{body: []byte(strings.Repeat("f", consts.OutboxCoalesceSize)), text: true},
+	})
+	got := make([]string, 0, len(packets))
+	for _, p := range packets {
+		got = append(got, p.String())
+	}
+	want := []string{"a\nb\n", consts.IsStart, "c", "d\ne\n", strings.Repeat("f", consts.OutboxCoalesceSize)}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("unexpected packets %q", got)
+	}
+}
+
+func TestOutbox(t *testing.T) {
+	conn := newBlockingConn()
+	player := &Player{ID: 7701, Name: "Alice"}
+	player.Conn(network.Wrapper(conn))
+
+	// 写出协程卡在第一条消息时，后面入队的文本合并成一个包
+	_ = player.WriteString("first\n")
+	waitTaken(player.out)
+	_ = player.WriteString("hello\n")
+	_ = player.WriteString("world\n")
+	for _, want := range []string{"first\n", "hello\nworld\n"} {
+		conn.release <- struct{}{}
+		if msg := <-conn.written; msg != want {
+			t.Fatalf("queued messages should be coalesced, want %q, got %q", want, msg)
+		}
+	}
+
+	// 写出被卡住时广播不会阻塞，积压过多后断开连接
+	_ = player.WriteString("stuck\n")
+	big := strings.Repeat("x", consts.OutboxMaxBytes/4)
+	done := make(chan error)
+	go func() {
+		var err error
+		for i := 0; i < 8 && err == nil; i++ {
+			err = player.WriteString(big)
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != consts.ErrorsSlowConsumer {
+			t.Fatalf("slow consumer should be detected, err: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("writes should not block on a slow connection")
+	}
+	select {
+	case <-conn.closed:
+	case <-time.After(time.Second):
+		t.Fatalf("slow connection should be closed")
+	}
+	if err := player.WriteString("bye\n"); err != consts.ErrorsChanClosed {
+		t.Fatalf("writes after disconnect should fail, err: %v", err)
+	}
+}
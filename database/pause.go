@@ -0,0 +1,162 @@
+package database
+
+import (
+	"fmt"
+	stringx "strings"
+	"time"
+
+	"github.com/ratel-online/server/consts"
+)
+
+// PauseVote 暂停或继续对局的投票，入座的在线玩家超过半数同意即通过
+type PauseVote struct {
+	Resume   bool           `json:"resume"`
+	Votes    map[int64]bool `json:"votes"`
+	Deadline time.Time      `json:"deadline"`
+}
+
+// Count 同意的票数和有投票权的人数，掉线的玩家不计入
+func (v *PauseVote) Count(room *Room) (yes, voters int) {
+	for id := range getRoomPlayers(room.ID) {
+		if p := getPlayer(id); p == nil || p.ai || !p.online {
+			continue
+		}
+		voters++
+		if v.Votes[id] {
+			yes++
+		}
+	}
+	return
+}
+
+// Paused 对局是否处于暂停中
+func (r *Room) Paused() bool {
+	r.Lock()
+	defer r.Unlock()
+	return r.resumed != nil
+}
+
+// waitResume 对局暂停时阻塞直到恢复
+func (r *Room) waitResume() {
+	r.Lock()
+	resumed := r.resumed
+	r.Unlock()
+	if resumed != nil {
+		<-resumed
+	}
+}
+
+// waitPlayerRoom 电脑玩家行动前等待所在房间的对局恢复
+func waitPlayerRoom(playerId int64) {
+	if p := getPlayer(playerId); p != nil {
+		if room := getRoom(p.RoomID); room != nil {
+			room.waitResume()
+		}
+	}
+}
+
+// VotePause 入座的玩家投票暂停或继续对局，没有进行中的投票时发起投票
+func VotePause(room *Room, player *Player, resume bool) error {
+	room.Lock()
+	defer room.Unlock()
+	if room.State != consts.RoomStateRunning {
+		return consts.ErrorsNoGame
+	}
+	if _, ok := getRoomPlayers(room.ID)[player.ID]; !ok {
+		return consts.ErrorsVoteDenied
+	}
+	if resume != (room.resumed != nil) {
+		if resume {
+			return consts.ErrorsGameNotPaused
+		}
+		return consts.ErrorsGamePaused
+	}
+	vote := room.pauseVote
+	if vote != nil && vote.Resume != resume {
+		return consts.ErrorsVoteInProgress
+	}
+	if vote == nil {
+		vote = &PauseVote{
+			Resume:   resume,
+			Votes:    map[int64]bool{},
+			Deadline: time.Now().Add(consts.PauseVoteTimeout),
+		}
+		room.pauseVote = vote
+		time.AfterFunc(consts.PauseVoteTimeout, func() {
+			room.Lock()
+			defer room.Unlock()
+			if room.pauseVote == vote {
+				room.pauseVote = nil
+				broadcast(room, fmt.Sprintf("Vote to %s failed\n", vote.action()))
+			}
+		})
+	}
+	vote.Votes[player.ID] = true
+	yes, voters := vote.Count(room)
+	if yes*2 <= voters {
+		broadcast(room, fmt.Sprintf("%s votes to %s the game (%d/%d), input %s to agree within %ds\n", player.Name, vote.action(), yes, voters, vote.action(), int(time.Until(vote.Deadline).Seconds())))
+		return nil
+	}
+	room.pauseVote = nil
+	if resume {
+		resumeGame(room)
+		broadcast(room, "Game resumed\n")
+	} else {
+		pauseGame(room)
+		broadcast(room, fmt.Sprintf("Game paused, input resume to vote for resuming, it resumes automatically in %d minutes\n", int(consts.MaxPauseDuration.Minutes())))
+	}
+	return nil
+}
+
+func (v *PauseVote) action() string {
+	if v.Resume {
+		return "resume"
+	}
+	return "pause"
+}
+
+// pauseGame 冻结回合计时，超过最长暂停时间后自动恢复，调用时需持有房间锁
+func pauseGame(room *Room) {
+	resumed := make(chan struct{})
+	room.resumed = resumed
+	if room.timer != nil {
+		room.timer.pause()
+	}
+	time.AfterFunc(consts.MaxPauseDuration, func() {
+		room.Lock()
+		defer room.Unlock()
+		if room.resumed == resumed {
+			room.pauseVote = nil
+			resumeGame(room)
+			broadcast(room, fmt.Sprintf("Game resumed after the maximum pause of %d minutes\n", int(consts.MaxPauseDuration.Minutes())))
+		}
+	})
+}
+
+// resumeGame 恢复回合计时，调用时需持有房间锁
+func resumeGame(room *Room) {
+	if room.resumed == nil {
+		return
+	}
+	close(room.resumed)
+	room.resumed = nil
+	if room.timer != nil {
+		room.timer.resume()
+	}
+}
+
+// handlePause 在读取连接时拦截对局中的 pause 和 resume，玩家不在自己的回合也能投票
+func (p *Player) handlePause(msg string) bool {
+	msg = stringx.ToLower(stringx.TrimSpace(msg))
+	if msg != "pause" && msg != "resume" {
+		return false
+	}
+	room := getRoom(p.RoomID)
+	if room == nil || !room.Running() {
+		return false
+	}
+	if err := VotePause(room, p, msg == "resume"); err != nil {
+		_ = p.WriteError(err)
+	}
+	return true
+}
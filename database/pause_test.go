@@ -0,0 +1,66 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ratel-online/core/network"
+	"github.com/ratel-online/server/consts"
+)
+
+func TestPauseVote(t *testing.T) {
+	alice := &Player{ID: 7501, Name: "Alice", online: true, conn: network.Wrapper(&fakeConn{})}
+	bob := &Player{ID: 7502, Name: "Bob", online: true, conn: network.Wrapper(&fakeConn{})}
+	room := newTestRoom(t, consts.GameTypeClassic, 0, alice, bob)
+	if alice.handlePause("pause") {
+		t.Fatalf("pause should only be handled in running games")
+	}
+
+	room.State = consts.RoomStateRunning
+	timer := NewTurnTimer(room, time.Minute)
+	timer.Start(alice.ID)
+	defer timer.Stop(alice.ID)
+	if !alice.handlePause("Pause") || room.Paused() {
+		t.Fatalf("one of two votes should not pause the game")
+	}
+	if err := VotePause(room, bob, true); err != consts.ErrorsGameNotPaused {
+		t.Fatalf("should not resume a running game, err: %v", err)
+	}
+	if err := VotePause(room, bob, false); err != nil || !room.Paused() {
+		t.Fatalf("game should be paused, err: %v", err)
+	}
+	frozen := timer.Remaining()
+	time.Sleep(20 * time.Millisecond)
+	if timer.Remaining() != frozen {
+		t.Fatalf("turn timer should freeze while paused")
+	}
+	// 回合之外的询问同样不会在暂停时超时
+	carol := &Player{ID: 7503, Name: "Carol", online: true, conn: network.Wrapper(&fakeConn{})}
+	asked := make(chan error, 1)
+	go func() {
+		_, err := timer.Offer(carol, 10*time.Millisecond)
+		asked <- err
+	}()
+	select {
+	case err := <-asked:
+		t.Fatalf("prompt should not time out while paused, err: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	bob.online = false
+	if err := VotePause(room, alice, true); err != nil || room.Paused() {
+		t.Fatalf("disconnected players should not block resuming, err: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if remain := timer.Remaining(); remain >= frozen || remain < frozen-time.Second {
+		t.Fatalf("turn timer should continue from where it paused, got %v of %v", remain, frozen)
+	}
+	select {
+	case err := <-asked:
+		if err != consts.ErrorsTimeout {
+			t.Fatalf("prompt should time out after resuming, err: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("prompt should continue after resuming")
+	}
+}
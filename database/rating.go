@@ -0,0 +1,224 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ratel-online/server/consts"
+)
+
+// RatingRecord 一局结束后的积分记录
+type RatingRecord struct {
+	GameType int       `json:"gameType"`
+	Rating   int       `json:"rating"`
+	Delta    int       `json:"delta"`
+	Time     time.Time `json:"time"`
+}
+
+// RatingChange 一局结束后玩家的积分变化
+type RatingChange struct {
+	PlayerID int64  `json:"playerId"`
+	Name     string `json:"name"`
+	Rating   int    `json:"rating"`
+	Delta    int    `json:"delta"`
+}
+
+var ratingLock sync.RWMutex
+
+// Rating 玩家在某种玩法下的积分，没玩过时为默认分
+func (p *Player) Rating(gameType int) int {
+	return p.Account().Rating(gameType)
+}
+
+func (p *Player) rating(gameType int) int {
+	return p.Account().rating(gameType)
+}
+
+// Rating 账号在某种玩法下的积分，没玩过时为默认分
+func (a *Account) Rating(gameType int) int {
+	ratingLock.RLock()
+	defer ratingLock.RUnlock()
+	return a.rating(gameType)
+}
+
+func (a *Account) rating(gameType int) int {
+	if r, ok := a.ratings[gameType]; ok {
+		return r
+	}
+	return consts.DefaultRating
+}
+
+// RatingHistory 玩家在某种玩法下最近的积分记录，最新的在最后
+func (p *Player) RatingHistory(gameType int) []RatingRecord {
+	a := p.Account()
+	ratingLock.RLock()
+	defer ratingLock.RUnlock()
+	history := make([]RatingRecord, 0)
+	for _, r := range a.ratingHistory {
+		if r.GameType == gameType {
+			history = append(history, r)
+		}
+	}
+	return history
+}
+
+// expected Elo 预期得分
+func expected(rating, opponent float64) float64 {
+	return 1 / (1 + math.Pow(10, (opponent-rating)/400))
+}
+
+// RatePlacement 按名次更新积分，placements 从第一名开始，同一组内为并列，每两名玩家之间按 Elo 比较一次
+func RatePlacement(gameType int, placements [][]int64) []RatingChange {
+	ratingLock.Lock()
+	defer ratingLock.Unlock()
+	ranked := make([]*Player, 0)
+	ranks := map[int64]int{}
+	for rank, group := range placements {
+		for _, id := range group {
+			if p := getPlayer(id); p != nil {
+				ranked = append(ranked, p)
+				ranks[id] = rank
+			}
+		}
+	}
+	if len(ranked) < 2 {
+		return nil
+	}
+	deltas := map[int64]float64{}
+	for _, p := range ranked {
+		for _, o := range ranked {
+			if p == o {
+				continue
+			}
+			score := 0.5
+			if ranks[p.ID] < ranks[o.ID] {
+				score = 1
+			} else if ranks[p.ID] > ranks[o.ID] {
+				score = 0
+			}
+			e := expected(float64(p.rating(gameType)), float64(o.rating(gameType)))
+			deltas[p.ID] += consts.RatingK * (score - e) / float64(len(ranked)-1)
+		}
+	}
+	return applyRatings(gameType, ranked, deltas)
+}
+
+// RateResult 按每位玩家的输赢结果（例如筹码变化）排名后更新积分
+func RateResult(gameType int, results map[int64]int) []RatingChange {
+	ids := make([]int64, 0, len(results))
+	for id := range results {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return results[ids[i]] > results[ids[j]]
+	})
+	placements := make([][]int64, 0)
+	for i, id := range ids {
+		if i > 0 && results[id] == results[ids[i-1]] {
+			placements[len(placements)-1] = append(placements[len(placements)-1], id)
+			continue
+		}
+		placements = append(placements, []int64{id})
+	}
+	return RatePlacement(gameType, placements)
+}
+
+// RateTeams 按队伍胜负更新积分，双方用平均分比较，人少的一方按人数比例加倍结算，例如地主一人对两个农民
+func RateTeams(gameType int, winners, losers []int64) []RatingChange {
+	ratingLock.Lock()
+	defer ratingLock.Unlock()
+	winnerPlayers, losersPlayers := teamPlayers(winners), teamPlayers(losers)
+	if len(winnerPlayers) == 0 || len(losersPlayers) == 0 {
+		return nil
+	}
+	winnerAvg, loserAvg := teamRating(winnerPlayers, gameType), teamRating(losersPlayers, gameType)
+	delta := consts.RatingK * (1 - expected(winnerAvg, loserAvg))
+	deltas := map[int64]float64{}
+	for _, p := range winnerPlayers {
+		deltas[p.ID] = delta * float64(len(losersPlayers)) / float64(len(winnerPlayers))
+	}
+	for _, p := range losersPlayers {
+		deltas[p.ID] = -delta
+	}
+	return applyRatings(gameType, append(winnerPlayers, losersPlayers...), deltas)
+}
+
+func teamPlayers(ids []int64) []*Player {
+	team := make([]*Player, 0, len(ids))
+	for _, id := range ids {
+		if p := getPlayer(id); p != nil {
+			team = append(team, p)
+		}
+	}
+	return team
+}
+
+func teamRating(team []*Player, gameType int) float64 {
+	total := 0
+	for _, p := range team {
+		total += p.rating(gameType)
+	}
+	return float64(total) / float64(len(team))
+}
+
+// applyRatings 写入积分变化，电脑玩家只参与计算，不记录积分
+func applyRatings(gameType int, players []*Player, deltas map[int64]float64) []RatingChange {
+	now := time.Now()
+	changes := make([]RatingChange, 0, len(players))
+	for _, p := range players {
+		if p.ai {
+			continue
+		}
+		a := p.Account()
+		delta := int(math.Round(deltas[p.ID]))
+		rating := a.rating(gameType) + delta
+		if a.ratings == nil {
+			a.ratings = map[int]int{}
+		}
+		a.ratings[gameType] = rating
+		a.ratingHistory = append(a.ratingHistory, RatingRecord{GameType: gameType, Rating: rating, Delta: delta, Time: now})
+		if len(a.ratingHistory) > consts.RatingHistorySize {
+			a.ratingHistory = a.ratingHistory[len(a.ratingHistory)-consts.RatingHistorySize:]
+		}
+		changes = append(changes, RatingChange{PlayerID: p.ID, Name: p.Name, Rating: rating, Delta: delta})
+	}
+	return changes
+}
+
+// BroadcastRatings 向房间广播一局结束后的积分变化
+func BroadcastRatings(roomId int64, changes []RatingChange) {
+	if len(changes) == 0 {
+		return
+	}
+	buf := bytes.Buffer{}
+	buf.WriteString("Rating changes:\n")
+	for _, c := range changes {
+		buf.WriteString(fmt.Sprintf("  %s: %d (%+d)\n", c.Name, c.Rating, c.Delta))
+	}
+	Broadcast(roomId, buf.String())
+}
+
+// Leaderboard 某种玩法积分最高的账号，只统计打过这种玩法的账号，包括已经离线的
+func Leaderboard(gameType, limit int) []*Account {
+	ratingLock.RLock()
+	defer ratingLock.RUnlock()
+	list := make([]*Account, 0)
+	accountLock.Lock()
+	for _, a := range accounts {
+		if _, ok := a.ratings[gameType]; ok {
+			list = append(list, a)
+		}
+	}
+	accountLock.Unlock()
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].rating(gameType) > list[j].rating(gameType)
+	})
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list
+}
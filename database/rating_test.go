@@ -0,0 +1,52 @@
+package database
+
+import (
+	"testing"
+
+	modelx "github.com/ratel-online/core/model"
+	"github.com/ratel-online/core/network"
+)
+
+func TestRating(t *testing.T) {
+	newTestStore(t, &Player{ID: 1001}, &Player{ID: 1002}, &Player{ID: 1003}, &Player{ID: 1004})
+	deltas := func(changes []RatingChange) map[int64]int {
+		m := map[int64]int{}
+		for _, c := range changes {
+			m[c.PlayerID] = c.Delta
+		}
+		return m
+	}
+
+	// 地主一人赢两个农民，农民各扣的分都加给地主
+	d := deltas(RateTeams(1, []int64{1001}, []int64{1002, 1003}))
+	if d[1001] != 32 || d[1002] != -16 || d[1003] != -16 {
+		t.Fatalf("team deltas %v", d)
+	}
+
+	d = deltas(RatePlacement(2, [][]int64{{1001}, {1002, 1003}, {1004}}))
+	if d[1001] != 16 || d[1004] != -16 || d[1002] != 0 || d[1003] != 0 {
+		t.Fatalf("placement deltas %v", d)
+	}
+	if r := GetPlayer(1001).Rating(2); r != 1516 {
+		t.Fatalf("rating %d, want 1516", r)
+	}
+
+	d = deltas(RateResult(5, map[int64]int{1001: -100, 1002: 100}))
+	if d[1002] <= 0 || d[1001] >= 0 {
+		t.Fatalf("result deltas %v", d)
+	}
+
+	// 同一身份重新连接后沿用积分和积分记录，排行榜也包括离线的账号
+	info := &modelx.AuthInfo{ID: 1005, Name: "Alice"}
+	defer delete(accounts, AccountKey(info))
+	alice := Connected(network.Wrapper(&fakeConn{}), info)
+	RateTeams(3, []int64{alice.ID}, []int64{1002})
+	store.DelPlayer(alice.ID)
+	again := Connected(network.Wrapper(&fakeConn{}), info)
+	if again.ID == alice.ID || again.Rating(3) != alice.Rating(3) || len(again.RatingHistory(3)) != 1 {
+		t.Fatalf("rating should survive reconnecting, got %d", again.Rating(3))
+	}
+	if top := Leaderboard(3, 1); len(top) != 1 || top[0] != again.Account() {
+		t.Fatalf("leaderboard should list accounts, got %v", top)
+	}
+}
@@ -0,0 +1,127 @@
+package database
+
+import (
+	"time"
+
+	"github.com/ratel-online/server/consts"
+)
+
+// 超时未准备的玩家的处理方式
+const (
+	UnreadyKick     = "kick"
+	UnreadySpectate = "spectate"
+)
+
+// ReadyState 一次准备检查的结果
+type ReadyState struct {
+	Countdown int     // 大于 0 时广播开局倒计时
+	Cancelled bool    // 倒计时被取消
+	Start     bool    // 倒计时结束，应当开局
+	Idle      []int64 // 超时未准备的玩家
+}
+
+// ToggleReady 切换玩家的准备状态，返回切换后的状态
+func ToggleReady(room *Room, playerId int64) bool {
+	room.Lock()
+	defer room.Unlock()
+	if room.ready == nil {
+		room.ready = map[int64]bool{}
+	}
+	room.ready[playerId] = !room.ready[playerId]
+	return room.ready[playerId]
+}
+
+// IsReady 电脑玩家总是准备好的
+func (r *Room) IsReady(playerId int64) bool {
+	if p := getPlayer(playerId); p != nil && p.ai {
+		return true
+	}
+	return r.ready[playerId]
+}
+
+// ResetReady 开局后清空准备状态、再来一局投票和换座请求
+func ResetReady(room *Room) {
+	room.ready = map[int64]bool{}
+	room.rematch = nil
+	room.swaps = nil
+	room.startAt = time.Time{}
+	room.fullSince = time.Time{}
+	room.pauseVote = nil
+	resumeGame(room)
+}
+
+// ReadyTick 等待中的玩家每秒调用一次，同一事件只会返回给其中一位调用者
+func ReadyTick(room *Room) ReadyState {
+	room.Lock()
+	defer room.Unlock()
+	state := ReadyState{}
+	if room.State != consts.RoomStateWaiting || room.Players < room.MaxPlayers {
+		state.Cancelled = !room.startAt.IsZero()
+		room.startAt = time.Time{}
+		room.fullSince = time.Time{}
+		return state
+	}
+	now := time.Now()
+	if room.fullSince.IsZero() {
+		room.fullSince = now
+	}
+	unready := make([]int64, 0)
+	for id := range getRoomPlayers(room.ID) {
+		if !room.IsReady(id) {
+			unready = append(unready, id)
+		}
+	}
+
+	if len(unready) == 0 && room.EnableAutoStart {
+		if room.startAt.IsZero() {
+			room.startAt = now.Add(consts.AutoStartCountdown)
+			room.countdown = 0
+		}
+		remain := int((room.startAt.Sub(now) + time.Second - 1) / time.Second)
+		if remain <= 0 {
+			room.startAt = time.Time{}
+			state.Start = true
+		} else if remain != room.countdown {
+			room.countdown = remain
+			state.Countdown = remain
+		}
+		return state
+	}
+	if !room.startAt.IsZero() {
+		room.startAt = time.Time{}
+		state.Cancelled = true
+	}
+	if room.UnreadyPolicy != "" && len(unready) > 0 && now.Sub(room.fullSince) >= consts.ReadyTimeout {
+		room.fullSince = now
+		state.Idle = unready
+	}
+	return state
+}
+
+// MoveToSpectator 把入座的玩家移到观众席
+func MoveToSpectator(roomId, playerId int64) {
+	room := getRoom(roomId)
+	if room == nil {
+		return
+	}
+	room.Lock()
+	defer room.Unlock()
+	moveToSpectator(room, playerId)
+}
+
+func moveToSpectator(room *Room, playerId int64) {
+	if _, ok := getRoomPlayers(room.ID)[playerId]; !ok {
+		return
+	}
+	store.DelRoomPlayer(room.ID, playerId)
+	delete(room.ready, playerId)
+	room.unseat(playerId)
+	room.Players--
+	store.AddRoomSpectator(room.ID, playerId)
+	if p := getPlayer(playerId); p != nil {
+		p.Role = RoleSpectator
+	}
+	if room.Creator == playerId {
+		passOwnership(room)
+	}
+}
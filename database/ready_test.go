@@ -0,0 +1,46 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ratel-online/server/consts"
+)
+
+func TestReadyTick(t *testing.T) {
+	room := newTestRoom(t, consts.GameTypeClassic, 2, &Player{ID: 2001}, &Player{ID: 2002})
+
+	room.UnreadyPolicy = UnreadySpectate
+	ToggleReady(room, 2001)
+	if state := ReadyTick(room); state.Countdown != 0 || state.Start || len(state.Idle) != 0 {
+		t.Fatalf("unexpected ready state %+v", state)
+	}
+	room.fullSince = time.Now().Add(-consts.ReadyTimeout)
+	if state := ReadyTick(room); len(state.Idle) != 1 || state.Idle[0] != 2002 {
+		t.Fatalf("player 2002 should be idle, got %+v", state)
+	}
+
+	room.EnableAutoStart = true
+	ToggleReady(room, 2002)
+	if state := ReadyTick(room); state.Countdown != int(consts.AutoStartCountdown/time.Second) {
+		t.Fatalf("countdown should start, got %+v", state)
+	}
+	if state := ReadyTick(room); state.Countdown != 0 {
+		t.Fatalf("same second should not be broadcast twice, got %+v", state)
+	}
+	ToggleReady(room, 2002)
+	if state := ReadyTick(room); !state.Cancelled {
+		t.Fatalf("countdown should be cancelled, got %+v", state)
+	}
+	ToggleReady(room, 2002)
+	ReadyTick(room)
+	room.startAt = time.Now()
+	if state := ReadyTick(room); !state.Start {
+		t.Fatalf("game should start, got %+v", state)
+	}
+
+	MoveToSpectator(room.ID, 2001)
+	if room.Players != 1 || room.Creator != 2002 || GetPlayer(2001).Role != RoleSpectator {
+		t.Fatalf("player 2001 should be moved to spectators")
+	}
+}
@@ -0,0 +1,183 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/ratel-online/server/consts"
+)
+
+// 再来一局时的座位安排
+const (
+	RematchKeep   = "keep"   // 保持座位
+	RematchRotate = "rotate" // 所有人顺移一个座位
+	RematchBanker = "banker" // 座位不变，麻将由下一位坐庄
+)
+
+// Rematch 一局结束后的再来一局投票，入座的玩家全部同意后自动开局
+type Rematch struct {
+	GameType int            `json:"gameType"`
+	Players  []int64        `json:"players"` // 上一局的玩家，按座位顺序
+	Winners  []int64        `json:"winners"`
+	Accepted map[int64]bool `json:"accepted"`
+	Deadline time.Time      `json:"deadline"`
+}
+
+// RematchState 一次再来一局检查的结果
+type RematchState struct {
+	Start   bool // 全部同意，应当开局
+	Expired bool // 投票超时
+}
+
+// Count 同意的人数和需要同意的人数，电脑玩家总是同意的
+func (r *Rematch) Count(room *Room) (accepted, seated int) {
+	for _, id := range room.seats {
+		if p := getPlayer(id); p == nil || p.ai {
+			continue
+		}
+		seated++
+		if r.Accepted[id] {
+			accepted++
+		}
+	}
+	return
+}
+
+// OpenRematch 一局结束时广播本局总结并发起再来一局投票
+func OpenRematch(room *Room, players, winners []int64) {
+	room.Lock()
+	defer room.Unlock()
+	room.rematch = &Rematch{
+		GameType: room.Type,
+		Players:  players,
+		Winners:  winners,
+		Accepted: map[int64]bool{},
+		Deadline: time.Now().Add(consts.RematchTimeout),
+	}
+	broadcast(room, sprintRematch(room))
+}
+
+// AcceptRematch 入座的玩家同意再来一局
+func AcceptRematch(room *Room, playerId int64) (*Rematch, error) {
+	room.Lock()
+	defer room.Unlock()
+	if room.rematch == nil {
+		return nil, consts.ErrorsNoRematch
+	}
+	if _, ok := getRoomPlayers(room.ID)[playerId]; !ok {
+		return nil, consts.ErrorsRematchDenied
+	}
+	room.rematch.Accepted[playerId] = true
+	return room.rematch, nil
+}
+
+// DeclineRematch 入座的玩家不再继续，让出座位给排队最久的观众，返回补位的玩家
+func DeclineRematch(room *Room, playerId int64) (*Player, error) {
+	room.Lock()
+	defer room.Unlock()
+	if room.rematch == nil {
+		return nil, consts.ErrorsNoRematch
+	}
+	if _, ok := getRoomPlayers(room.ID)[playerId]; !ok {
+		return nil, consts.ErrorsRematchDenied
+	}
+	delete(room.rematch.Accepted, playerId)
+	moveToSpectator(room, playerId)
+	return backfill(room), nil
+}
+
+// RematchTick 等待中的玩家每秒调用一次，同一事件只会返回给其中一位调用者
+func RematchTick(room *Room) RematchState {
+	room.Lock()
+	defer room.Unlock()
+	state := RematchState{}
+	vote := room.rematch
+	if vote == nil || room.State != consts.RoomStateWaiting {
+		return state
+	}
+	accepted, seated := vote.Count(room)
+	if seated > 0 && accepted == seated && room.Players >= len(vote.Players) {
+		if room.RematchSeats == RematchBanker && room.Type == consts.GameTypeMahjong {
+			room.Banker = nextBanker(room)
+		}
+		room.seats = nextSeats(room)
+		room.rematch = nil
+		state.Start = true
+	} else if time.Now().After(vote.Deadline) {
+		room.rematch = nil
+		state.Expired = true
+	}
+	return state
+}
+
+// nextSeats 按房间的座位安排得到下一局的座位，顺移时空座保持不动
+func nextSeats(room *Room) []int64 {
+	seats := append([]int64{}, room.seats...)
+	ids := room.occupied()
+	if room.RematchSeats == RematchRotate && len(ids) > 1 {
+		ids = append(ids[1:], ids[0])
+		for i, j := 0, 0; i < len(seats); i++ {
+			if seats[i] != 0 {
+				seats[i] = ids[j]
+				j++
+			}
+		}
+	}
+	return seats
+}
+
+// nextBanker 庄家的下一个座位坐庄
+func nextBanker(room *Room) int {
+	ids := room.occupied()
+	for i, id := range ids {
+		if int(id) == room.Banker {
+			return int(ids[(i+1)%len(ids)])
+		}
+	}
+	return room.Banker
+}
+
+func sprintRematch(room *Room) string {
+	vote := room.rematch
+	winners := map[int64]bool{}
+	for _, id := range vote.Winners {
+		winners[id] = true
+	}
+	buf := bytes.Buffer{}
+	buf.WriteString("Game over! Summary:\n")
+	for i, id := range vote.Players {
+		p := getPlayer(id)
+		if p == nil {
+			continue
+		}
+		result := "lost"
+		if winners[id] {
+			result = "won"
+		}
+		buf.WriteString(fmt.Sprintf("%d. %s %s, score: %d, rating: %d\n", i+1, p.Name, result, p.Amount, p.Rating(vote.GameType)))
+	}
+	buf.WriteString(fmt.Sprintf("Next game (%s):", room.RematchSeats))
+	for i, id := range nextSeats(room) {
+		if p := getPlayer(id); p != nil {
+			buf.WriteString(fmt.Sprintf(" %d.%s", i+1, p.Name))
+		}
+	}
+	buf.WriteString("\n")
+	if room.RematchSeats == RematchBanker && room.Type == consts.GameTypeMahjong {
+		if banker := getPlayer(int64(nextBanker(room))); banker != nil {
+			buf.WriteString(fmt.Sprintf("Next banker: %s\n", banker.Name))
+		}
+	}
+	if queue := spectatorQueue(room.ID); len(queue) > 0 {
+		buf.WriteString("Spectators in queue:")
+		for _, id := range queue {
+			if p := getPlayer(id); p != nil {
+				buf.WriteString(" " + p.Name)
+			}
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString(fmt.Sprintf("Input rematch to play again or decline to give your seat to a spectator, within %ds\n", int(consts.RematchTimeout.Seconds())))
+	return buf.String()
+}
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ratel-online/server/consts"
+)
+
+func TestRematch(t *testing.T) {
+	room := newTestRoom(t, consts.GameTypeClassic, 0, &Player{ID: 4001}, &Player{ID: 4002}, &Player{ID: 4003}, &Player{ID: 4004})
+	room.RematchSeats = RematchRotate
+	if seats := RoomSeats(room.ID); len(seats) != 3 || seats[0] != 4001 || seats[2] != 4003 {
+		t.Fatalf("seats should follow join order, got %v", seats)
+	}
+	if _, err := AcceptRematch(room, 4001); err != consts.ErrorsNoRematch {
+		t.Fatalf("no rematch should be open, err: %v", err)
+	}
+
+	room.rematch = &Rematch{Players: RoomSeats(room.ID), Accepted: map[int64]bool{}, Deadline: time.Now().Add(consts.RematchTimeout)}
+	if _, err := AcceptRematch(room, 4004); err != consts.ErrorsRematchDenied {
+		t.Fatalf("spectator should not vote, err: %v", err)
+	}
+	promoted, err := DeclineRematch(room, 4002)
+	if err != nil || promoted == nil || promoted.ID != 4004 {
+		t.Fatalf("queued spectator should take the seat, got %v err %v", promoted, err)
+	}
+	for _, id := range []int64{4001, 4003} {
+		_, _ = AcceptRematch(room, id)
+	}
+	if state := RematchTick(room); state.Start {
+		t.Fatalf("promoted player has not accepted yet")
+	}
+	_, _ = AcceptRematch(room, 4004)
+	if state := RematchTick(room); !state.Start {
+		t.Fatalf("rematch should start, got %+v", state)
+	}
+	if seats := RoomSeats(room.ID); len(seats) != 3 || seats[0] != 4004 || seats[1] != 4003 || seats[2] != 4001 {
+		t.Fatalf("promoted player should take the free seat and seats should rotate, got %v", seats)
+	}
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ratel-online/core/log"
+	"github.com/ratel-online/server/consts"
+)
+
+// Report 玩家举报，管理员可以结合聊天记录核查，举报双方按账号区分，重新连接后仍然有效
+type Report struct {
+	Reporter    int64     `json:"reporter"`
+	ReporterKey string    `json:"reporterKey"`
+	Target      int64     `json:"target"` // 举报时被举报玩家的连接，不在线时为 0
+	TargetKey   string    `json:"targetKey"`
+	TargetName  string    `json:"targetName"`
+	TargetIP    string    `json:"targetIp"`
+	RoomID      int64     `json:"roomId"`
+	Reason      string    `json:"reason"`
+	Time        time.Time `json:"time"`
+}
+
+var (
+	reportLock sync.Mutex
+	reports    = make([]Report, 0)
+)
+
+// ReportPlayer 按玩家 ID 或昵称举报玩家，不在线的玩家按账号举报，同一人短时间内不能重复举报同一账号，在线的管理员会收到通知
+func ReportPlayer(reporter *Player, key, reason string) error {
+	account, target := lookupAccount(key)
+	if account == nil || account.Key == reporter.Account().Key || reason == "" {
+		return consts.ErrorsReportInvalid
+	}
+	now := time.Now()
+	reportLock.Lock()
+	for _, r := range reports {
+		if r.ReporterKey == reporter.Account().Key && r.TargetKey == account.Key && now.Sub(r.Time) < consts.ReportCooldown {
+			reportLock.Unlock()
+			return consts.ErrorsReportTooOften
+		}
+	}
+	report := Report{
+		Reporter:    reporter.ID,
+		ReporterKey: reporter.Account().Key,
+		TargetKey:   account.Key,
+		TargetName:  account.Name,
+		RoomID:      reporter.RoomID,
+		Reason:      reason,
+		Time:        now,
+	}
+	if target != nil {
+		report.Target, report.TargetName, report.TargetIP = target.ID, target.Name, target.IP
+	}
+	reports = append(reports, report)
+	if len(reports) > consts.ReportLogSize {
+		reports = reports[len(reports)-consts.ReportLogSize:]
+	}
+	reportLock.Unlock()
+
+	log.Infof("player %s[%d] reported %s[%s]: %s\n", reporter.Name, reporter.ID, report.TargetName, report.TargetKey, reason)
+	for _, p := range store.Players() {
+		if p.online && p.IsAdmin() {
+			_ = p.WriteString("[report] " + report.String())
+		}
+	}
+	return nil
+}
+
+func (r Report) String() string {
+	return fmt.Sprintf("%s %s reported %s(%d, %s) in room %d: %s\n", r.Time.Format("01-02 15:04:05"), playerName(r.Reporter), r.TargetName, r.Target, r.TargetIP, r.RoomID, r.Reason)
+}
+
+// SprintReports 最近的举报，管理员用 /chatlog <id|昵称> 查看被举报玩家的聊天记录
+func SprintReports() string {
+	reportLock.Lock()
+	defer reportLock.Unlock()
+	buf := bytes.Buffer{}
+	buf.WriteString("Reports:\n")
+	for _, r := range reports {
+		buf.WriteString(r.String())
+	}
+	return buf.String()
+}
@@ -0,0 +1,158 @@
+package database
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ratel-online/server/consts"
+)
+
+// RoomFilter 房间列表的筛选、排序和分页条件
+type RoomFilter struct {
+	Type    int  `json:"type"` // 0 为全部玩法
+	Waiting bool `json:"waiting"`
+	Free    bool `json:"free"` // 有空座位
+	Open    bool `json:"open"` // 无密码且不是私密房间
+	Chat    bool `json:"chat"`
+	SortID  bool `json:"sortId"` // 默认按最近活跃排序
+	Page    int  `json:"page"`   // 从 1 开始
+}
+
+// RoomFilter 玩家当前的房间筛选条件，第一次查看房间列表时为空条件
+func (p *Player) RoomFilter() *RoomFilter {
+	if p.roomFilter == nil {
+		p.roomFilter = &RoomFilter{Page: 1}
+	}
+	return p.roomFilter
+}
+
+// ResetRoomFilter 离开房间列表时清空筛选条件
+func (p *Player) ResetRoomFilter() {
+	p.roomFilter = nil
+}
+
+// ParseRoomFilter 解析筛选条件，例如 t=1 w f open chat sort=id p=2
+func ParseRoomFilter(args []string) (RoomFilter, error) {
+	filter := RoomFilter{Page: 1}
+	for _, arg := range args {
+		key, value := strings.ToLower(arg), ""
+		if i := strings.Index(key, "="); i >= 0 {
+			key, value = key[:i], key[i+1:]
+		}
+		switch key {
+		case "t", "type":
+			t, err := strconv.Atoi(value)
+			if _, ok := consts.GameTypes[t]; err != nil || !ok {
+				return filter, consts.ErrorsGameTypeInvalid
+			}
+			filter.Type = t
+		case "w", "waiting":
+			filter.Waiting = true
+		case "f", "free":
+			filter.Free = true
+		case "o", "open":
+			filter.Open = true
+		case "c", "chat":
+			filter.Chat = true
+		case "sort":
+			switch value {
+			case "id":
+				filter.SortID = true
+			case "active":
+				filter.SortID = false
+			default:
+				return filter, consts.ErrorsRoomFilterInvalid
+			}
+		case "p", "page":
+			page, err := strconv.Atoi(value)
+			if err != nil || page < 1 {
+				return filter, consts.ErrorsRoomFilterInvalid
+			}
+			filter.Page = page
+		default:
+			return filter, consts.ErrorsRoomFilterInvalid
+		}
+	}
+	return filter, nil
+}
+
+func (f RoomFilter) match(room *Room) bool {
+	switch {
+	case f.Type != 0 && room.Type != f.Type:
+		return false
+	case f.Waiting && room.State != consts.RoomStateWaiting:
+		return false
+	case f.Free && room.Players >= room.MaxPlayers:
+		return false
+	case f.Open && (room.HasPassword() || room.Private):
+		return false
+	case f.Chat && !room.EnableChat:
+		return false
+	}
+	return true
+}
+
+// FilterRooms 返回筛选后当前页的房间和总页数，页码超出范围时取最后一页
+func FilterRooms(filter *RoomFilter) ([]*Room, int) {
+	list := make([]*Room, 0)
+	for _, room := range GetRooms() {
+		if filter.match(room) {
+			list = append(list, room)
+		}
+	}
+	if !filter.SortID {
+		sort.SliceStable(list, func(i, j int) bool {
+			return list[i].ActiveTime.After(list[j].ActiveTime)
+		})
+	}
+	pages := (len(list) + consts.RoomPageSize - 1) / consts.RoomPageSize
+	if pages == 0 {
+		pages = 1
+	}
+	if filter.Page > pages {
+		filter.Page = pages
+	}
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	start := (filter.Page - 1) * consts.RoomPageSize
+	end := start + consts.RoomPageSize
+	if end > len(list) {
+		end = len(list)
+	}
+	return list[start:end], pages
+}
+
+// Props 房间主要设置的摘要
+func (r *Room) Props() []string {
+	props := make([]string, 0)
+	add := func(on bool, name string) {
+		if on {
+			props = append(props, name)
+		}
+	}
+	switch r.Type {
+	case consts.GameTypeClassic, consts.GameTypeLaiZi, consts.GameTypeSkill, consts.GameTypeRunFast:
+		add(r.EnableLaiZi, consts.RoomPropsLaiZi)
+		add(r.EnableSkill, consts.RoomPropsSkill)
+		add(r.EnableDontShuffle, consts.RoomPropsDotShuffle)
+	case consts.GameTypeLiar:
+		add(r.EnableJokerAsTarget, consts.RoomPropsJokerAsTarget)
+		add(r.EnableCasual, consts.RoomPropsCasual)
+	case consts.GameTypeLiarDice:
+		add(r.EnableWildOnes, consts.RoomPropsWildOnes)
+		add(r.EnableSpotOn, consts.RoomPropsSpotOn)
+	case consts.GameTypeMahjong:
+		add(r.EnableSichuan, consts.RoomPropsSichuan)
+	case consts.GameTypeUno:
+		add(r.EnableUnoStacking, consts.RoomPropsUnoStacking)
+		add(r.EnableUnoChallenge, consts.RoomPropsUnoChallenge)
+		add(r.EnableUnoCall, consts.RoomPropsUnoCall)
+		add(r.EnableUnoJumpIn, consts.RoomPropsUnoJumpIn)
+	}
+	add(r.EnableChat, consts.RoomPropsChat)
+	add(r.HasPassword(), consts.RoomPropsPassword)
+	add(r.Private, "invite")
+	return props
+}
@@ -0,0 +1,42 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ratel-online/server/consts"
+)
+
+func TestFilterRooms(t *testing.T) {
+	if _, err := ParseRoomFilter([]string{"t=99"}); err == nil {
+		t.Fatalf("invalid game type should be rejected")
+	}
+	if _, err := ParseRoomFilter([]string{"unknown"}); err == nil {
+		t.Fatalf("unknown filter should be rejected")
+	}
+
+	newTestStore(t)
+	classic := CreateRoom(0, consts.GameTypeClassic)
+	locked := CreateRoom(0, consts.GameTypeClassic)
+	uno := CreateRoom(0, consts.GameTypeUno)
+	for _, room := range []*Room{classic, locked, uno} {
+		defer deleteRoom(room)
+	}
+	locked.SetPassword("secret")
+	uno.ActiveTime = time.Now().Add(time.Minute)
+
+	filter, err := ParseRoomFilter([]string{"t=1", "o", "w", "f"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rooms, pages := FilterRooms(&filter)
+	if len(rooms) != 1 || rooms[0].ID != classic.ID || pages != 1 {
+		t.Fatalf("expected only the open classic room, got %d rooms", len(rooms))
+	}
+
+	filter, _ = ParseRoomFilter(nil)
+	rooms, _ = FilterRooms(&filter)
+	if len(rooms) == 0 || rooms[0].ID != uno.ID {
+		t.Fatalf("most recently active room should be listed first")
+	}
+}
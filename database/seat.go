@@ -0,0 +1,149 @@
+package database
+
+import (
+	"github.com/ratel-online/server/consts"
+)
+
+// 换座的结果
+const (
+	SwapRequested = iota
+	SwapDone
+)
+
+// RoomSeats 按座位顺序返回入座的玩家
+func RoomSeats(roomId int64) []int64 {
+	room := getRoom(roomId)
+	if room == nil {
+		return nil
+	}
+	return room.occupied()
+}
+
+// Seat 玩家的座位号，从 1 开始，没有入座返回 0
+func (r *Room) Seat(playerId int64) int {
+	for i, id := range r.seats {
+		if id == playerId {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// SeatInfo 入座玩家的座位号和准备状态
+type SeatInfo struct {
+	Seat     int   `json:"seat"`
+	PlayerID int64 `json:"playerId"`
+	Ready    bool  `json:"ready"`
+}
+
+// SeatSnapshot 在房间锁内按座位顺序读取入座玩家和准备状态
+func SeatSnapshot(room *Room) []SeatInfo {
+	room.Lock()
+	defer room.Unlock()
+	seats := make([]SeatInfo, 0, len(room.seats))
+	for i, id := range room.seats {
+		if id != 0 {
+			seats = append(seats, SeatInfo{Seat: i + 1, PlayerID: id, Ready: room.IsReady(id)})
+		}
+	}
+	return seats
+}
+
+// Seated 玩家是否在房间里入座
+func (r *Room) Seated(playerId int64) bool {
+	r.Lock()
+	defer r.Unlock()
+	return r.Seat(playerId) > 0
+}
+
+// occupied 按座位顺序返回玩家，跳过空座
+func (r *Room) occupied() []int64 {
+	ids := make([]int64, 0, len(r.seats))
+	for _, id := range r.seats {
+		if id != 0 {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// seat 玩家坐到第一个空座
+func (r *Room) seat(playerId int64) {
+	if r.Seat(playerId) > 0 {
+		return
+	}
+	for i, id := range r.seats {
+		if id == 0 {
+			r.seats[i] = playerId
+			return
+		}
+	}
+	r.seats = append(r.seats, playerId)
+}
+
+// unseat 玩家离座，其他玩家的座位号不变
+func (r *Room) unseat(playerId int64) {
+	if n := r.Seat(playerId); n > 0 {
+		r.seats[n-1] = 0
+	}
+	r.trimSeats()
+	delete(r.swaps, playerId)
+	for id, target := range r.swaps {
+		if target == playerId {
+			delete(r.swaps, id)
+		}
+	}
+}
+
+func (r *Room) trimSeats() {
+	for len(r.seats) > 0 && r.seats[len(r.seats)-1] == 0 {
+		r.seats = r.seats[:len(r.seats)-1]
+	}
+}
+
+// Sit 入座的玩家换到第 n 个空座
+func Sit(room *Room, playerId int64, n int) error {
+	room.Lock()
+	defer room.Unlock()
+	current := room.Seat(playerId)
+	if current == 0 || room.State != consts.RoomStateWaiting {
+		return consts.ErrorsSeatDenied
+	}
+	if n < 1 || n > room.MaxPlayers {
+		return consts.ErrorsSeatInvalid
+	}
+	if n <= len(room.seats) && room.seats[n-1] != 0 && room.seats[n-1] != playerId {
+		return consts.ErrorsSeatTaken
+	}
+	for len(room.seats) < n {
+		room.seats = append(room.seats, 0)
+	}
+	room.seats[current-1] = 0
+	room.seats[n-1] = playerId
+	room.trimSeats()
+	return nil
+}
+
+// Swap 请求和另一位入座的玩家交换座位，对方也请求和自己交换时才交换，电脑玩家直接交换
+func Swap(room *Room, playerId, target int64) (int, error) {
+	room.Lock()
+	defer room.Unlock()
+	from, to := room.Seat(playerId), room.Seat(target)
+	if from == 0 || room.State != consts.RoomStateWaiting {
+		return SwapRequested, consts.ErrorsSeatDenied
+	}
+	if to == 0 || target == playerId {
+		return SwapRequested, consts.ErrorsPlayerNotFound
+	}
+	if p := getPlayer(target); room.swaps[target] != playerId && (p == nil || !p.ai) {
+		if room.swaps == nil {
+			room.swaps = map[int64]int64{}
+		}
+		room.swaps[playerId] = target
+		return SwapRequested, nil
+	}
+	room.seats[from-1], room.seats[to-1] = target, playerId
+	delete(room.swaps, playerId)
+	delete(room.swaps, target)
+	return SwapDone, nil
+}
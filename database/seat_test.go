@@ -0,0 +1,42 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/ratel-online/server/consts"
+)
+
+func TestSeats(t *testing.T) {
+	room := newTestRoom(t, consts.GameTypeClassic, 4, &Player{ID: 5001}, &Player{ID: 5002}, &Player{ID: 5003})
+
+	if err := Sit(room, 5001, 2); err != consts.ErrorsSeatTaken {
+		t.Fatalf("seat 2 should be taken, err: %v", err)
+	}
+	if err := Sit(room, 5001, 5); err != consts.ErrorsSeatInvalid {
+		t.Fatalf("seat 5 should be invalid, err: %v", err)
+	}
+	if err := Sit(room, 5001, 4); err != nil || room.Seat(5001) != 4 {
+		t.Fatalf("player 5001 should sit at seat 4, err: %v", err)
+	}
+	LeaveRoom(room.ID, 5002)
+	if room.Seat(5003) != 3 {
+		t.Fatalf("other players should keep their seats, got %d", room.Seat(5003))
+	}
+
+	if result, err := Swap(room, 5003, 5001); err != nil || result != SwapRequested {
+		t.Fatalf("swap should wait for confirmation, result %d err %v", result, err)
+	}
+	if room.Seat(5003) != 3 {
+		t.Fatalf("seats should not change before confirmation")
+	}
+	if result, err := Swap(room, 5001, 5003); err != nil || result != SwapDone {
+		t.Fatalf("swap should be done, result %d err %v", result, err)
+	}
+	if seats := RoomSeats(room.ID); len(seats) != 2 || seats[0] != 5001 || seats[1] != 5003 {
+		t.Fatalf("seats should be swapped, got %v", seats)
+	}
+	ToggleReady(room, 5003)
+	if seats := SeatSnapshot(room); len(seats) != 2 || seats[0].Seat != 3 || seats[0].Ready || seats[1].Seat != 4 || !seats[1].Ready {
+		t.Fatalf("snapshot should list seat numbers and ready states, got %+v", seats)
+	}
+}
@@ -0,0 +1,163 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ratel-online/server/consts"
+)
+
+// GameStats 玩家在某种玩法下的对局数和胜场
+type GameStats struct {
+	Played int `json:"played"`
+	Won    int `json:"won"`
+}
+
+// Stats 玩家的生涯统计
+type Stats struct {
+	Games          map[int]*GameStats `json:"games"`
+	LandlordPlayed int                `json:"landlordPlayed"`
+	LandlordWon    int                `json:"landlordWon"`
+	BiggestPot     uint               `json:"biggestPot"`
+	Bombs          int                `json:"bombs"`
+	LiarSurvivals  int                `json:"liarSurvivals"` // 骗子酒馆扣动扳机后活下来的次数
+	Turns          int                `json:"turns"`
+	TurnTime       time.Duration      `json:"turnTime"`
+}
+
+var statsLock sync.RWMutex
+
+func (p *Player) updateStats(update func(s *Stats)) {
+	if p == nil || p.ai {
+		return
+	}
+	a := p.Account()
+	statsLock.Lock()
+	defer statsLock.Unlock()
+	if a.stats.Games == nil {
+		a.stats.Games = map[int]*GameStats{}
+	}
+	update(&a.stats)
+}
+
+// RecordGame 记录一局结束，winners 为获胜的玩家
+func RecordGame(gameType int, players, winners []int64) {
+	won := map[int64]bool{}
+	for _, id := range winners {
+		won[id] = true
+	}
+	for _, id := range players {
+		getPlayer(id).updateStats(func(s *Stats) {
+			g, ok := s.Games[gameType]
+			if !ok {
+				g = &GameStats{}
+				s.Games[gameType] = g
+			}
+			g.Played++
+			if won[id] {
+				g.Won++
+			}
+		})
+	}
+}
+
+func (p *Player) RecordLandlord(won bool) {
+	p.updateStats(func(s *Stats) {
+		s.LandlordPlayed++
+		if won {
+			s.LandlordWon++
+		}
+	})
+}
+
+// RecordPot 记录赢下的德州扑克底池，平分底池时也按整个底池记录
+func (p *Player) RecordPot(pot uint) {
+	p.updateStats(func(s *Stats) {
+		if pot > s.BiggestPot {
+			s.BiggestPot = pot
+		}
+	})
+}
+
+func (p *Player) RecordBomb() {
+	p.updateStats(func(s *Stats) {
+		s.Bombs++
+	})
+}
+
+func (p *Player) RecordSurvival() {
+	p.updateStats(func(s *Stats) {
+		s.LiarSurvivals++
+	})
+}
+
+// RecordTurn 记录一回合出牌的用时，由计时器在回合结束时调用
+func (p *Player) RecordTurn(d time.Duration) {
+	p.updateStats(func(s *Stats) {
+		s.Turns++
+		s.TurnTime += d
+	})
+}
+
+// Profile 玩家资料，包含积分和生涯统计
+type Profile struct {
+	ID      int64       `json:"id"`
+	Name    string      `json:"name"`
+	Amount  uint        `json:"amount"`
+	Ratings map[int]int `json:"ratings"`
+	Stats   Stats       `json:"stats"`
+}
+
+func (p *Player) Profile() Profile {
+	profile := Profile{
+		ID:      p.ID,
+		Name:    p.Name,
+		Amount:  p.Amount,
+		Ratings: map[int]int{},
+	}
+	a := p.Account()
+	ratingLock.RLock()
+	for t, r := range a.ratings {
+		profile.Ratings[t] = r
+	}
+	ratingLock.RUnlock()
+
+	statsLock.RLock()
+	defer statsLock.RUnlock()
+	profile.Stats = a.stats
+	profile.Stats.Games = map[int]*GameStats{}
+	for t, g := range a.stats.Games {
+		copied := *g
+		profile.Stats.Games[t] = &copied
+	}
+	return profile
+}
+
+func (p Profile) String() string {
+	buf := bytes.Buffer{}
+	buf.WriteString(fmt.Sprintf("Profile of %s[%d], amount: %d\n", p.Name, p.ID, p.Amount))
+	buf.WriteString(fmt.Sprintf("%-20s%-10s%-10s%-10s\n", "Game", "Played", "Won", "Rating"))
+	for _, t := range consts.GameTypesIds {
+		g, ok := p.Stats.Games[t]
+		if !ok {
+			continue
+		}
+		rating := consts.DefaultRating
+		if r, ok := p.Ratings[t]; ok {
+			rating = r
+		}
+		buf.WriteString(fmt.Sprintf("%-20s%-10d%-10d%-10d\n", consts.GameTypes[t], g.Played, g.Won, rating))
+	}
+	if p.Stats.LandlordPlayed > 0 {
+		buf.WriteString(fmt.Sprintf("Landlord win rate: %d/%d (%.0f%%)\n", p.Stats.LandlordWon, p.Stats.LandlordPlayed, float64(p.Stats.LandlordWon)*100/float64(p.Stats.LandlordPlayed)))
+	}
+	buf.WriteString(fmt.Sprintf("Bombs played: %d\n", p.Stats.Bombs))
+	buf.WriteString(fmt.Sprintf("Biggest Texas pot: %d\n", p.Stats.BiggestPot))
+	buf.WriteString(fmt.Sprintf("Liar's bar survivals: %d\n", p.Stats.LiarSurvivals))
+	if p.Stats.Turns > 0 {
+		buf.WriteString(fmt.Sprintf("Average turn time: %.1fs\n", (p.Stats.TurnTime / time.Duration(p.Stats.Turns)).Seconds()))
+	}
+	return buf.String()
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ratel-online/server/consts"
+)
+
+func TestStats(t *testing.T) {
+	alice := &Player{ID: 7601, Name: "Alice"}
+	bob := &Player{ID: 7602, Name: "Bob"}
+	robot := &Player{ID: 7603, Name: "Robot", ai: true}
+	newTestStore(t, alice, bob, robot)
+
+	RecordGame(consts.GameTypeClassic, []int64{alice.ID, bob.ID, robot.ID}, []int64{alice.ID})
+	RecordGame(consts.GameTypeClassic, []int64{alice.ID, bob.ID}, []int64{bob.ID})
+	alice.RecordLandlord(true)
+	alice.RecordLandlord(false)
+	alice.RecordBomb()
+	alice.RecordPot(100)
+	alice.RecordPot(50)
+	alice.RecordTurn(2 * time.Second)
+	alice.RecordTurn(4 * time.Second)
+	robot.RecordBomb()
+
+	profile := alice.Profile()
+	if g := profile.Stats.Games[consts.GameTypeClassic]; g == nil || g.Played != 2 || g.Won != 1 {
+		t.Fatalf("alice should have played 2 and won 1, got %+v", g)
+	}
+	if profile.Stats.LandlordPlayed != 2 || profile.Stats.LandlordWon != 1 || profile.Stats.Bombs != 1 || profile.Stats.BiggestPot != 100 {
+		t.Fatalf("unexpected stats %+v", profile.Stats)
+	}
+	if stats := robot.Profile().Stats; len(stats.Games) != 0 || stats.Bombs != 0 {
+		t.Fatalf("robots should not record stats")
+	}
+
+	// 资料是副本，之后的对局不会改到已经取出的资料
+	RecordGame(consts.GameTypeClassic, []int64{alice.ID}, nil)
+	if profile.Stats.Games[consts.GameTypeClassic].Played != 2 {
+		t.Fatalf("profile should be a copy")
+	}
+	text := profile.String()
+	if !strings.Contains(text, "Landlord win rate: 1/2 (50%)") || !strings.Contains(text, "Average turn time: 3.0s") {
+		t.Fatalf("unexpected profile text %q", text)
+	}
+
+	// 回合用时由计时器在回合结束时记一次，回合之外的询问和重复结束都不算
+	timer := NewTurnTimer(&Room{ID: 7601}, time.Minute)
+	timer.Start(bob.ID)
+	timer.Begin(alice.ID, time.Minute)
+	timer.Stop(alice.ID)
+	timer.Stop(bob.ID)
+	timer.Stop(bob.ID)
+	if alice.Profile().Stats.Turns != 2 || bob.Profile().Stats.Turns != 1 {
+		t.Fatalf("only finished turns should be recorded, got %d and %d", alice.Profile().Stats.Turns, bob.Profile().Stats.Turns)
+	}
+}
@@ -0,0 +1,278 @@
+package database
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Store 玩家和房间的存储，实现需要并发安全
+// 返回的列表和成员集合都是副本，修改成员要通过对应的方法
+type Store interface {
+	GetPlayer(id int64) *Player
+	SetPlayer(player *Player)
+	DelPlayer(id int64)
+	// Players 连接过服务器的全部用户
+	Players() []*Player
+
+	GetRoom(id int64) *Room
+	// SetRoom 保存房间，新房间没有成员
+	SetRoom(room *Room)
+	// DelRoom 删除房间以及房间的成员和踢出记录
+	DelRoom(id int64)
+	// Rooms 全部房间，按 ID 排序
+	Rooms() []*Room
+
+	// RoomPlayers 房间里入座的玩家，房间不存在时为 nil
+	RoomPlayers(roomId int64) map[int64]bool
+	AddRoomPlayer(roomId, playerId int64)
+	DelRoomPlayer(roomId, playerId int64)
+
+	// RoomSpectators 房间里的观众以及排队的序号，房间不存在时为 nil
+	RoomSpectators(roomId int64) map[int64]int
+	// AddRoomSpectator 观众排在队尾，补位时按排队顺序入座
+	AddRoomSpectator(roomId, playerId int64)
+	DelRoomSpectator(roomId, playerId int64)
+
+	// KickPlayer 记录玩家被踢出房间，until 之前不能重新加入
+	KickPlayer(roomId, playerId int64, until time.Time)
+	// Kicked 玩家是否还在踢出期限内，过期的记录会被清除
+	Kicked(roomId, playerId int64) bool
+}
+
+var store = newSharedStore(NewMemoryStore())
+
+// SetStore 替换存储，需要在服务启动前调用
+func SetStore(s Store) {
+	store.current.Store(&s)
+}
+
+// sharedStore 把调用转给当前的存储，替换存储时不和其他协程的读写竞争
+type sharedStore struct {
+	current atomic.Pointer[Store]
+}
+
+func newSharedStore(s Store) *sharedStore {
+	shared := &sharedStore{}
+	shared.current.Store(&s)
+	return shared
+}
+
+func (s *sharedStore) get() Store {
+	return *s.current.Load()
+}
+
+func (s *sharedStore) GetPlayer(id int64) *Player { return s.get().GetPlayer(id) }
+func (s *sharedStore) SetPlayer(player *Player)   { s.get().SetPlayer(player) }
+func (s *sharedStore) DelPlayer(id int64)         { s.get().DelPlayer(id) }
+func (s *sharedStore) Players() []*Player         { return s.get().Players() }
+func (s *sharedStore) GetRoom(id int64) *Room     { return s.get().GetRoom(id) }
+func (s *sharedStore) SetRoom(room *Room)         { s.get().SetRoom(room) }
+func (s *sharedStore) DelRoom(id int64)           { s.get().DelRoom(id) }
+func (s *sharedStore) Rooms() []*Room             { return s.get().Rooms() }
+
+func (s *sharedStore) RoomPlayers(roomId int64) map[int64]bool {
+	return s.get().RoomPlayers(roomId)
+}
+
+func (s *sharedStore) AddRoomPlayer(roomId, playerId int64) {
+	s.get().AddRoomPlayer(roomId, playerId)
+}
+
+func (s *sharedStore) DelRoomPlayer(roomId, playerId int64) {
+	s.get().DelRoomPlayer(roomId, playerId)
+}
+
+func (s *sharedStore) RoomSpectators(roomId int64) map[int64]int {
+	return s.get().RoomSpectators(roomId)
+}
+
+func (s *sharedStore) AddRoomSpectator(roomId, playerId int64) {
+	s.get().AddRoomSpectator(roomId, playerId)
+}
+
+func (s *sharedStore) DelRoomSpectator(roomId, playerId int64) {
+	s.get().DelRoomSpectator(roomId, playerId)
+}
+
+func (s *sharedStore) KickPlayer(roomId, playerId int64, until time.Time) {
+	s.get().KickPlayer(roomId, playerId, until)
+}
+
+func (s *sharedStore) Kicked(roomId, playerId int64) bool {
+	return s.get().Kicked(roomId, playerId)
+}
+
+// memoryStore 内存存储，服务重启后数据丢失
+type memoryStore struct {
+	sync.RWMutex
+	players    map[int64]*Player
+	rooms      map[int64]*Room
+	members    map[int64]map[int64]bool
+	spectators map[int64]map[int64]int
+	kicked     map[int64]map[int64]time.Time
+}
+
+// NewMemoryStore 创建内存存储，测试可以用它得到互不影响的实例
+func NewMemoryStore() Store {
+	return &memoryStore{
+		players:    map[int64]*Player{},
+		rooms:      map[int64]*Room{},
+		members:    map[int64]map[int64]bool{},
+		spectators: map[int64]map[int64]int{},
+		kicked:     map[int64]map[int64]time.Time{},
+	}
+}
+
+func (s *memoryStore) GetPlayer(id int64) *Player {
+	s.RLock()
+	defer s.RUnlock()
+	return s.players[id]
+}
+
+func (s *memoryStore) SetPlayer(player *Player) {
+	s.Lock()
+	defer s.Unlock()
+	s.players[player.ID] = player
+}
+
+func (s *memoryStore) DelPlayer(id int64) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.players, id)
+}
+
+func (s *memoryStore) Players() []*Player {
+	s.RLock()
+	defer s.RUnlock()
+	list := make([]*Player, 0, len(s.players))
+	for _, p := range s.players {
+		list = append(list, p)
+	}
+	return list
+}
+
+func (s *memoryStore) GetRoom(id int64) *Room {
+	s.RLock()
+	defer s.RUnlock()
+	return s.rooms[id]
+}
+
+func (s *memoryStore) SetRoom(room *Room) {
+	s.Lock()
+	defer s.Unlock()
+	s.rooms[room.ID] = room
+	if _, ok := s.members[room.ID]; !ok {
+		s.members[room.ID] = map[int64]bool{}
+		s.spectators[room.ID] = map[int64]int{}
+	}
+}
+
+func (s *memoryStore) DelRoom(id int64) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.rooms, id)
+	delete(s.members, id)
+	delete(s.spectators, id)
+	delete(s.kicked, id)
+}
+
+func (s *memoryStore) Rooms() []*Room {
+	s.RLock()
+	list := make([]*Room, 0, len(s.rooms))
+	for _, r := range s.rooms {
+		list = append(list, r)
+	}
+	s.RUnlock()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+func (s *memoryStore) RoomPlayers(roomId int64) map[int64]bool {
+	s.RLock()
+	defer s.RUnlock()
+	members, ok := s.members[roomId]
+	if !ok {
+		return nil
+	}
+	copied := make(map[int64]bool, len(members))
+	for id, v := range members {
+		copied[id] = v
+	}
+	return copied
+}
+
+func (s *memoryStore) AddRoomPlayer(roomId, playerId int64) {
+	s.Lock()
+	defer s.Unlock()
+	if members, ok := s.members[roomId]; ok {
+		members[playerId] = true
+	}
+}
+
+func (s *memoryStore) DelRoomPlayer(roomId, playerId int64) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.members[roomId], playerId)
+}
+
+func (s *memoryStore) RoomSpectators(roomId int64) map[int64]int {
+	s.RLock()
+	defer s.RUnlock()
+	spectators, ok := s.spectators[roomId]
+	if !ok {
+		return nil
+	}
+	copied := make(map[int64]int, len(spectators))
+	for id, v := range spectators {
+		copied[id] = v
+	}
+	return copied
+}
+
+func (s *memoryStore) AddRoomSpectator(roomId, playerId int64) {
+	s.Lock()
+	defer s.Unlock()
+	spectators, ok := s.spectators[roomId]
+	if !ok {
+		return
+	}
+	index := 0
+	for _, i := range spectators {
+		if i >= index {
+			index = i + 1
+		}
+	}
+	spectators[playerId] = index
+}
+
+func (s *memoryStore) DelRoomSpectator(roomId, playerId int64) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.spectators[roomId], playerId)
+}
+
+func (s *memoryStore) KickPlayer(roomId, playerId int64, until time.Time) {
+	s.Lock()
+	defer s.Unlock()
+	kicked, ok := s.kicked[roomId]
+	if !ok {
+		kicked = map[int64]time.Time{}
+		s.kicked[roomId] = kicked
+	}
+	kicked[playerId] = until
+}
+
+func (s *memoryStore) Kicked(roomId, playerId int64) bool {
+	s.Lock()
+	defer s.Unlock()
+	until, exists := s.kicked[roomId][playerId]
+	if exists && time.Now().After(until) {
+		delete(s.kicked[roomId], playerId)
+		return false
+	}
+	return exists
+}
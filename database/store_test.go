@@ -0,0 +1,87 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	s := NewMemoryStore()
+	room := &Room{ID: 7801}
+	s.SetRoom(room)
+	s.SetPlayer(&Player{ID: 7801})
+	if s.GetRoom(room.ID) != room || s.GetPlayer(7801) == nil || len(s.Players()) != 1 {
+		t.Fatalf("saved room and player should be found")
+	}
+	if store.GetRoom(room.ID) != nil {
+		t.Fatalf("stores should not share data")
+	}
+
+	// 返回的成员集合是副本
+	s.AddRoomPlayer(room.ID, 7801)
+	s.RoomPlayers(room.ID)[7802] = true
+	if members := s.RoomPlayers(room.ID); len(members) != 1 || !members[7801] {
+		t.Fatalf("room players should only change through the store, got %v", members)
+	}
+	s.AddRoomSpectator(room.ID, 7803)
+	s.AddRoomSpectator(room.ID, 7804)
+	s.DelRoomSpectator(room.ID, 7803)
+	s.AddRoomSpectator(room.ID, 7803)
+	if spectators := s.RoomSpectators(room.ID); spectators[7804] >= spectators[7803] {
+		t.Fatalf("spectators should queue in order, got %v", spectators)
+	}
+
+	s.KickPlayer(room.ID, 7805, time.Now().Add(time.Minute))
+	s.KickPlayer(room.ID, 7806, time.Now().Add(-time.Second))
+	if !s.Kicked(room.ID, 7805) || s.Kicked(room.ID, 7806) {
+		t.Fatalf("kicks should expire")
+	}
+
+	s.DelRoom(room.ID)
+	if s.GetRoom(room.ID) != nil || s.RoomPlayers(room.ID) != nil || s.RoomSpectators(room.ID) != nil || s.Kicked(room.ID, 7805) {
+		t.Fatalf("deleting a room should remove its members and kicks")
+	}
+	s.AddRoomPlayer(room.ID, 7801)
+	if s.RoomPlayers(room.ID) != nil {
+		t.Fatalf("members should not be added to a deleted room")
+	}
+}
+
+// newTestStore 换上独立的内存存储并登记玩家，测试结束后恢复原来的存储
+func newTestStore(t *testing.T, players ...*Player) {
+	t.Helper()
+	old := store.get()
+	SetStore(NewMemoryStore())
+	// 先结束留下的房间，等事件循环和计时协程退出后再换回原来的存储
+	t.Cleanup(func() {
+		for _, room := range store.Rooms() {
+			deleteRoom(room)
+		}
+		roomRoutines.Wait()
+		SetStore(old)
+	})
+	for _, p := range players {
+		store.SetPlayer(p)
+	}
+}
+
+// newTestRoom 在独立的存储里创建房间，玩家按顺序加入，第一个玩家是房主，maxPlayers 为 0 时用默认人数
+func newTestRoom(t *testing.T, gameType, maxPlayers int, players ...*Player) *Room {
+	t.Helper()
+	newTestStore(t, players...)
+	creator := int64(0)
+	if len(players) > 0 {
+		creator = players[0].ID
+	}
+	room := CreateRoom(creator, gameType)
+	t.Cleanup(func() { deleteRoom(room) })
+	if maxPlayers > 0 {
+		room.MaxPlayers = maxPlayers
+	}
+	for _, p := range players {
+		if err := JoinRoom(room.ID, p.ID); err != nil {
+			t.Fatalf("player %d should join the room, err: %v", p.ID, err)
+		}
+	}
+	return room
+}
@@ -0,0 +1,250 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/feel-easy/mahjong/tile"
+	"github.com/ratel-online/core/util/poker"
+	"github.com/ratel-online/server/consts"
+)
+
+// TableGame 能向观众展示牌桌的游戏
+type TableGame interface {
+	// Table 公开的牌桌信息：各家剩余牌数、上一手牌、公共牌和底池
+	Table() string
+	// Reveal 所有玩家的手牌，房主开启亮牌后延迟发给观众
+	Reveal() string
+}
+
+// Table 房间当前的牌桌，由对局的事件循环生成，没有进行中的游戏时返回空
+func Table(room *Room) string {
+	l := room.Loop()
+	if l == nil || !room.Running() {
+		return ""
+	}
+	l.Lock()
+	defer l.Unlock()
+	return l.table
+}
+
+// refreshTable 每次广播后标记牌桌需要刷新，由事件循环处理完当前事件后统一刷新
+// 广播可能来自事件循环之外，这里只设置标记，不读取对局
+func refreshTable(room *Room) {
+	atomic.StoreInt32(&room.tableRefresh, 1)
+}
+
+// flushTable 在事件循环里生成牌桌发给观众，一个事件里的多条广播合并为一次刷新
+// 手牌和上次亮牌相同时不再重复亮牌，每个事件最多向观众亮一次牌
+func (l *GameLoop) flushTable() {
+	room := l.room
+	if !atomic.CompareAndSwapInt32(&room.tableRefresh, 1, 0) {
+		return
+	}
+	room.Lock()
+	game, ok := room.Game.(TableGame)
+	running, reveal := room.State == consts.RoomStateRunning, room.EnableReveal
+	room.Unlock()
+	if !ok || !running {
+		return
+	}
+	table, hands := game.Table(), ""
+	if reveal {
+		hands = game.Reveal()
+	}
+	l.Lock()
+	l.table = table
+	if hands == l.revealed {
+		hands = ""
+	} else {
+		l.revealed = hands
+	}
+	l.Unlock()
+	for id := range getRoomSpectators(room.ID) {
+		p := getPlayer(id)
+		if p == nil || !p.IsOnline() {
+			continue
+		}
+		_ = p.WriteString(table)
+		if hands != "" {
+			notifySupervisor(id, time.Duration(room.RevealDelay)*time.Second, hands)
+		}
+	}
+}
+
+func playerName(id int64) string {
+	if p := getPlayer(id); p != nil {
+		return p.Name
+	}
+	return fmt.Sprintf("%d", id)
+}
+
+func (g *Game) Table() string {
+	buf := bytes.Buffer{}
+	buf.WriteString("[Table]\n")
+	for _, id := range g.Players {
+		if g.Room.Type == consts.GameTypeRunFast {
+			buf.WriteString(fmt.Sprintf("%s: %d cards\n", playerName(id), len(g.Pokers[id])))
+		} else {
+			buf.WriteString(fmt.Sprintf("%s [%s]: %d cards\n", playerName(id), g.Team(id), len(g.Pokers[id])))
+		}
+	}
+	if len(g.LastPokers) > 0 {
+		buf.WriteString(fmt.Sprintf("Last play: %s %s\n", playerName(g.LastPlayer), g.LastPokers.OaaString()))
+	}
+	return buf.String()
+}
+
+func (g *Game) Reveal() string {
+	buf := bytes.Buffer{}
+	buf.WriteString("[Hands]\n")
+	for _, id := range g.Players {
+		buf.WriteString(fmt.Sprintf("%s: %s\n", playerName(id), g.Pokers[id].OaaString()))
+	}
+	return buf.String()
+}
+
+func (g *Texas) Table() string {
+	buf := bytes.Buffer{}
+	buf.WriteString(fmt.Sprintf("[Table] round: %s, pot: %d\n", g.Round, g.Pot))
+	if len(g.Board) > 0 {
+		buf.WriteString(fmt.Sprintf("Board: %s\n", g.Board.TexasString()))
+	}
+	for _, p := range g.Players {
+		state := ""
+		if p.Folded {
+			state = " [folded]"
+		} else if p.AllIn {
+			state = " [all-in]"
+		}
+		buf.WriteString(fmt.Sprintf("%s: bets %d%s\n", p.Name, p.Bets, state))
+	}
+	return buf.String()
+}
+
+func (g *Texas) Reveal() string {
+	buf := bytes.Buffer{}
+	buf.WriteString("[Hands]\n")
+	for _, p := range g.Players {
+		buf.WriteString(fmt.Sprintf("%s: %s\n", p.Name, p.Hand.TexasString()))
+	}
+	return buf.String()
+}
+
+func (game *Mahjong) Table() string {
+	buf := bytes.Buffer{}
+	buf.WriteString("[Table]\n")
+	for _, id := range game.PlayerIDs {
+		pc := game.Game.Players().GetPlayerController(id)
+		buf.WriteString(fmt.Sprintf("%s: %d tiles", pc.Name(), len(pc.Hand())))
+		if shown := pc.GetShowCardTiles(); len(shown) > 0 {
+			buf.WriteString(fmt.Sprintf(", shown: %s", tile.ToTileString(shown)))
+		}
+		if game.HasWon(id) {
+			buf.WriteString(" [won]")
+		}
+		buf.WriteString("\n")
+	}
+	if top := game.Game.Pile().Top(); top > 0 {
+		buf.WriteString(fmt.Sprintf("Last discard: %s\n", tile.ToTileString([]int{top})))
+	}
+	return buf.String()
+}
+
+func (game *Mahjong) Reveal() string {
+	buf := bytes.Buffer{}
+	buf.WriteString("[Hands]\n")
+	for _, id := range game.PlayerIDs {
+		pc := game.Game.Players().GetPlayerController(id)
+		buf.WriteString(fmt.Sprintf("%s: %s\n", pc.Name(), tile.ToTileString(pc.Hand())))
+	}
+	return buf.String()
+}
+
+func (l *Liar) Table() string {
+	buf := bytes.Buffer{}
+	buf.WriteString("[牌桌]\n")
+	if l.Target != nil {
+		buf.WriteString(fmt.Sprintf("当前指示牌: %s\n", poker.GetDesc(l.Target.Key)))
+	}
+	for _, id := range l.PlayerIDs {
+		if l.Alive[id] {
+			buf.WriteString(fmt.Sprintf("%s: %d 张牌\n", playerName(id), len(l.Hands[id])))
+		} else {
+			buf.WriteString(fmt.Sprintf("%s: 已出局\n", playerName(id)))
+		}
+	}
+	if len(l.LastPokers) > 0 {
+		buf.WriteString(fmt.Sprintf("上一手: %s 出了 %d 张牌\n", playerName(l.LastPlayerID), len(l.LastPokers)))
+	}
+	return buf.String()
+}
+
+func (l *Liar) Reveal() string {
+	buf := bytes.Buffer{}
+	buf.WriteString("[手牌]\n")
+	for _, id := range l.PlayerIDs {
+		if l.Alive[id] {
+			buf.WriteString(fmt.Sprintf("%s: %s\n", playerName(id), l.Hands[id].String()))
+		}
+	}
+	if len(l.LastPokers) > 0 {
+		buf.WriteString(fmt.Sprintf("上一手: %s\n", l.LastPokers.String()))
+	}
+	return buf.String()
+}
+
+func (g *LiarDice) Table() string {
+	buf := bytes.Buffer{}
+	buf.WriteString("[牌桌]\n")
+	for _, id := range g.PlayerIDs {
+		if g.Alive(id) {
+			buf.WriteString(fmt.Sprintf("%s: %d 颗骰子\n", playerName(id), len(g.Dice[id])))
+		}
+	}
+	if g.BidQuantity > 0 {
+		buf.WriteString(fmt.Sprintf("当前叫点: %s 叫了 %d 个 %d\n", playerName(g.BidPlayerID), g.BidQuantity, g.BidFace))
+	}
+	return buf.String()
+}
+
+func (g *LiarDice) Reveal() string {
+	buf := bytes.Buffer{}
+	buf.WriteString("[骰子]\n")
+	for _, id := range g.PlayerIDs {
+		if g.Alive(id) {
+			buf.WriteString(fmt.Sprintf("%s: %s\n", playerName(id), DiceString(g.Dice[id])))
+		}
+	}
+	return buf.String()
+}
+
+func (ug *UnoGame) Table() string {
+	buf := bytes.Buffer{}
+	buf.WriteString("[Table]\n")
+	for _, id := range ug.Players {
+		buf.WriteString(fmt.Sprintf("%s: %d cards", ug.UnoPlayers[id].Name, len(ug.Game.GetPlayerCards(id))))
+		if ug.Rules.TargetScore > 0 {
+			buf.WriteString(fmt.Sprintf(", score: %d", ug.Scores[id]))
+		}
+		buf.WriteString("\n")
+	}
+	if top := ug.Game.Pile().Top(); top != nil {
+		buf.WriteString(fmt.Sprintf("Top card: %s\n", top))
+	}
+	if ug.PendingDraw > 0 {
+		buf.WriteString(fmt.Sprintf("Pending draw: %d\n", ug.PendingDraw))
+	}
+	return buf.String()
+}
+
+func (ug *UnoGame) Reveal() string {
+	buf := bytes.Buffer{}
+	buf.WriteString("[Hands]\n")
+	for _, id := range ug.Players {
+		buf.WriteString(fmt.Sprintf("%s: %s\n", ug.UnoPlayers[id].Name, ug.Game.GetPlayerCards(id)))
+	}
+	return buf.String()
+}
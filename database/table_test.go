@@ -0,0 +1,58 @@
+package database
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ratel-online/core/model"
+	"github.com/ratel-online/core/network"
+	"github.com/ratel-online/server/consts"
+)
+
+func TestTable(t *testing.T) {
+	room := newTestRoom(t, consts.GameTypeRunFast, 0)
+	game := &Game{
+		Room:    room,
+		Players: []int64{6001, 6002},
+		Pokers:  map[int64]model.Pokers{6001: {{Key: 3}}, 6002: {{Key: 4}, {Key: 5}}},
+	}
+	room.Game = game
+	if Table(room) != "" {
+		t.Fatalf("table should be hidden before the game starts")
+	}
+	room.State = consts.RoomStateRunning
+	loop := NewGameLoop(room, nil)
+	defer loop.end()
+	refreshTable(room)
+	loop.flushTable()
+	if table := Table(room); !strings.Contains(table, "6002: 2 cards") {
+		t.Fatalf("table should show card counts, got %q", table)
+	}
+
+	SetRoomProps(room, consts.RoomPropsReveal, "on")
+	if !room.EnableReveal || room.RevealDelay != consts.RevealDelay {
+		t.Fatalf("reveal should use the default delay, got %v %d", room.EnableReveal, room.RevealDelay)
+	}
+	SetRoomProps(room, consts.RoomPropsReveal, "10")
+	if room.RevealDelay != 10 {
+		t.Fatalf("reveal delay should be 10, got %d", room.RevealDelay)
+	}
+	// 观众每次刷新都收到牌桌，手牌没有变化时不重复亮牌
+	conn := &fakeConn{}
+	spectator := &Player{ID: 6003, Name: "Carol", online: true, conn: network.Wrapper(conn)}
+	store.SetPlayer(spectator)
+	store.AddRoomSpectator(room.ID, spectator.ID)
+	room.RevealDelay = 0
+	for i := 0; i < 2; i++ {
+		refreshTable(room)
+		loop.flushTable()
+	}
+	if len(conn.written) != 3 || !strings.Contains(conn.written[1], "[Hands]") {
+		t.Fatalf("spectator should get two tables and one reveal, got %q", conn.written)
+	}
+	SetRoomProps(room, consts.RoomPropsReveal, "off")
+	if room.EnableReveal {
+		t.Fatalf("reveal should be off")
+	}
+	room.Game = nil
+}
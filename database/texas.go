@@ -6,6 +6,7 @@ import (
 
 type Texas struct {
 	Room         *Room          `json:"room"`
+	Loop         *GameLoop      `json:"-"` // 本局的事件循环
 	Players      []*TexasPlayer `json:"players"`
 	Pot          uint           `json:"pot"`
 	BB           int            `json:"bb"`
@@ -20,11 +21,6 @@ type Texas struct {
 }
 
 func (g *Texas) Clean() {
-	if g != nil {
-		for _, p := range g.Players {
-			close(p.State)
-		}
-	}
 }
 
 func (g *Texas) NextPlayer(id int64) *TexasPlayer {
@@ -105,7 +101,6 @@ func (g *Texas) RoundEnd(currentPlayerId int64) bool {
 type TexasPlayer struct {
 	ID     int64        `json:"id"`
 	Name   string       `json:"name"`
-	State  chan int     `json:"state"`
 	Hand   model.Pokers `json:"hand"`
 	Bets   uint         `json:"bets"`
 	Folded bool         `json:"folded"`
@@ -117,7 +112,6 @@ func (p *TexasPlayer) Reset() {
 	p.Folded = false
 	p.AllIn = false
 	p.Hand = nil
-	p.State = make(chan int, 1)
 }
 
 func (p *TexasPlayer) Amount() uint {
@@ -0,0 +1,331 @@
+package database
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ratel-online/core/util/async"
+	"github.com/ratel-online/server/consts"
+)
+
+// TurnTimer 房间共用的回合计时器，定时向房间广播当前玩家的剩余时间
+// 回合时间用完后自动动用玩家本局的时间银行，时间银行也用完才算超时
+// 抢地主、定缺这类回合之外的询问也由计时器计时，可以有多位玩家同时在计时
+type TurnTimer struct {
+	sync.Mutex
+	room     *Room
+	base     time.Duration
+	turns    map[int64]time.Duration // 玩家每回合的时间，技能可以修改
+	banks    map[int64]time.Duration // 玩家本局剩余的时间银行
+	active   map[int64]*turn         // 正在计时的玩家
+	current  int64                   // 当前回合的玩家
+	pausedAt time.Time               // 对局暂停的时间，没有暂停时为零
+}
+
+// turn 一位玩家正在进行的计时
+type turn struct {
+	started  time.Time // 开始计时的时间，暂停的时间不算在内
+	deadline time.Time
+	bankFrom time.Time // 开始动用时间银行的时间，没有动用时为零
+	noBank   bool      // 不回应就算放弃的询问不动用时间银行
+	private  bool      // 私下的询问不向房间广播剩余时间
+	stop     chan struct{}
+}
+
+// NewTurnTimer 开局时为房间创建计时器，base 为每回合的默认时间
+func NewTurnTimer(room *Room, base time.Duration) *TurnTimer {
+	if room.timer != nil {
+		room.timer.stopTurn()
+	}
+	t := newTurnTimer(room, base)
+	room.timer = t
+	return t
+}
+
+func newTurnTimer(room *Room, base time.Duration) *TurnTimer {
+	return &TurnTimer{
+		room:   room,
+		base:   base,
+		turns:  map[int64]time.Duration{},
+		banks:  map[int64]time.Duration{},
+		active: map[int64]*turn{},
+	}
+}
+
+// Timer 房间当前对局的计时器
+func (r *Room) Timer() *TurnTimer {
+	return r.timer
+}
+
+// playerTimer 玩家所在房间的计时器，玩家已经离开房间时用一个不属于任何房间的计时器，询问照常超时
+func playerTimer(p *Player) *TurnTimer {
+	if room := getRoom(p.RoomID); room != nil && room.timer != nil {
+		return room.timer
+	}
+	return newTurnTimer(&Room{}, 0)
+}
+
+func (t *TurnTimer) turnTime(id int64) time.Duration {
+	if d, ok := t.turns[id]; ok {
+		return d
+	}
+	return t.base
+}
+
+func (t *TurnTimer) bank(id int64) time.Duration {
+	if d, ok := t.banks[id]; ok {
+		return d
+	}
+	return consts.TimeBank
+}
+
+// TurnTime 玩家每回合的时间
+func (t *TurnTimer) TurnTime(id int64) time.Duration {
+	t.Lock()
+	defer t.Unlock()
+	return t.turnTime(id)
+}
+
+// SetTurnTime 修改玩家每回合的时间，从下一回合开始生效
+func (t *TurnTimer) SetTurnTime(id int64, d time.Duration) {
+	t.Lock()
+	defer t.Unlock()
+	t.turns[id] = d
+}
+
+// Bank 玩家本局剩余的时间银行
+func (t *TurnTimer) Bank(id int64) time.Duration {
+	t.Lock()
+	defer t.Unlock()
+	return t.bank(id)
+}
+
+// Start 开始玩家的回合，上一位玩家的回合随之结束
+func (t *TurnTimer) Start(id int64) {
+	t.Lock()
+	prev := t.current
+	used, ok := t.used(prev)
+	if prev != 0 {
+		t.endTurn(prev)
+	}
+	t.begin(id, t.turnTime(id))
+	t.current = id
+	t.Unlock()
+	if ok {
+		getPlayer(prev).RecordTurn(used)
+	}
+}
+
+// Begin 回合之外的询问开始为玩家计时，不影响其他玩家的计时，用 Stop 结束
+func (t *TurnTimer) Begin(id int64, d time.Duration) {
+	t.Lock()
+	defer t.Unlock()
+	t.begin(id, d)
+}
+
+// begin 开始为玩家计时，暂停中开始的计时从恢复时算起，调用时需持有计时器的锁
+func (t *TurnTimer) begin(id int64, d time.Duration) {
+	t.endTurn(id)
+	tn := &turn{started: t.now(), deadline: t.now().Add(d), stop: make(chan struct{})}
+	t.active[id] = tn
+	roomRoutines.Add(1)
+	async.Async(func() {
+		defer roomRoutines.Done()
+		t.tick(id, tn.stop)
+	})
+}
+
+// Stop 结束玩家的计时，动用的时间银行从余额里扣除，没有在计时时不做处理
+// 结束的是当前回合时计入玩家的出牌用时，每回合只算一次
+func (t *TurnTimer) Stop(id int64) {
+	t.Lock()
+	used, ok := t.used(id)
+	t.endTurn(id)
+	t.Unlock()
+	if ok {
+		getPlayer(id).RecordTurn(used)
+	}
+}
+
+// used 玩家当前回合已经用掉的时间，不是当前回合的玩家时返回 false
+func (t *TurnTimer) used(id int64) (time.Duration, bool) {
+	tn, ok := t.active[id]
+	if id == 0 || id != t.current || !ok {
+		return 0, false
+	}
+	return t.now().Sub(tn.started), true
+}
+
+func (t *TurnTimer) stopTurn() {
+	t.Lock()
+	defer t.Unlock()
+	for id := range t.active {
+		t.endTurn(id)
+	}
+}
+
+func (t *TurnTimer) endTurn(id int64) {
+	if id == t.current {
+		t.current = 0
+	}
+	tn, ok := t.active[id]
+	if !ok {
+		return
+	}
+	close(tn.stop)
+	if !tn.bankFrom.IsZero() {
+		t.banks[id] = max(t.bank(id)-t.now().Sub(tn.bankFrom), 0)
+	}
+	delete(t.active, id)
+}
+
+// Remaining 当前回合的剩余时间
+func (t *TurnTimer) Remaining() time.Duration {
+	t.Lock()
+	defer t.Unlock()
+	return t.remaining(t.current)
+}
+
+func (t *TurnTimer) remaining(id int64) time.Duration {
+	tn, ok := t.active[id]
+	if !ok {
+		return 0
+	}
+	return max(tn.deadline.Sub(t.now()), 0)
+}
+
+// now 暂停时计时停在暂停的那一刻
+func (t *TurnTimer) now() time.Time {
+	if !t.pausedAt.IsZero() {
+		return t.pausedAt
+	}
+	return time.Now()
+}
+
+func (t *TurnTimer) pause() {
+	t.Lock()
+	defer t.Unlock()
+	if t.pausedAt.IsZero() {
+		t.pausedAt = time.Now()
+	}
+}
+
+// resume 恢复计时，截止时间和动用时间银行的时间顺延暂停的时长
+func (t *TurnTimer) resume() {
+	t.Lock()
+	defer t.Unlock()
+	if t.pausedAt.IsZero() {
+		return
+	}
+	paused := time.Since(t.pausedAt)
+	t.pausedAt = time.Time{}
+	for _, tn := range t.active {
+		tn.started = tn.started.Add(paused)
+		tn.deadline = tn.deadline.Add(paused)
+		if !tn.bankFrom.IsZero() {
+			tn.bankFrom = tn.bankFrom.Add(paused)
+		}
+	}
+}
+
+// useBank 计时用完后动用时间银行，每次计时只能动用一次
+func (t *TurnTimer) useBank(id int64) (time.Duration, bool) {
+	t.Lock()
+	defer t.Unlock()
+	tn, ok := t.active[id]
+	if !ok || tn.noBank || !tn.bankFrom.IsZero() {
+		return 0, false
+	}
+	bank := t.bank(id)
+	if bank < time.Second {
+		return 0, false
+	}
+	tn.bankFrom = time.Now()
+	tn.deadline = tn.bankFrom.Add(bank)
+	return bank, true
+}
+
+// Offer 不回应就算放弃的询问，例如质疑，同样计时和随对局暂停，但不动用时间银行
+func (t *TurnTimer) Offer(player *Player, d time.Duration) (string, error) {
+	return t.offer(player, d, false)
+}
+
+// OfferPrivately 不向房间广播剩余时间的 Offer，例如抢出，其他玩家不会知道谁在被询问
+func (t *TurnTimer) OfferPrivately(player *Player, d time.Duration) (string, error) {
+	return t.offer(player, d, true)
+}
+
+func (t *TurnTimer) offer(player *Player, d time.Duration, private bool) (string, error) {
+	t.Lock()
+	t.begin(player.ID, d)
+	t.active[player.ID].noBank = true
+	t.active[player.ID].private = private
+	t.Unlock()
+	defer t.Stop(player.ID)
+	return t.Ask(player)
+}
+
+// Ask 在计时的剩余时间内等待玩家输入，计时和时间银行都用完后返回超时
+// 对局暂停时不会超时，玩家的输入会被忽略，掉线的玩家等到恢复后才按超时处理
+func (t *TurnTimer) Ask(player *Player) (string, error) {
+	for {
+		if t.room.Paused() {
+			if !player.IsOnline() {
+				t.room.waitResume()
+				continue
+			}
+			_, err := player.AskForString(time.Second)
+			if err == nil {
+				_ = player.WriteError(consts.ErrorsGamePaused)
+			} else if err != consts.ErrorsTimeout && player.IsOnline() {
+				return "", err
+			}
+			continue
+		}
+		t.Lock()
+		remain := t.remaining(player.ID)
+		t.Unlock()
+		if remain <= 0 {
+			bank, ok := t.useBank(player.ID)
+			if !ok {
+				return "", consts.ErrorsTimeout
+			}
+			Broadcast(t.room.ID, fmt.Sprintf("[timer] %s is using the time bank, %ds left\n", player.Name, int(bank.Seconds())))
+			continue
+		}
+		ans, err := player.AskForString(remain)
+		if err == consts.ErrorsTimeout {
+			continue
+		}
+		if err == nil && t.room.Paused() {
+			_ = player.WriteError(consts.ErrorsGamePaused)
+			continue
+		}
+		return ans, err
+	}
+}
+
+// tick 计时进行中定时广播剩余时间，对局结束或计时结束后退出
+func (t *TurnTimer) tick(id int64, stop chan struct{}) {
+	ticker := time.NewTicker(consts.TurnTimerInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if t.room.timer != t || !t.room.Running() {
+			t.stopTurn()
+			return
+		}
+		t.Lock()
+		remain, paused := t.remaining(id), !t.pausedAt.IsZero()
+		private := t.active[id] != nil && t.active[id].private
+		t.Unlock()
+		if remain >= time.Second && !paused && !private {
+			Broadcast(t.room.ID, fmt.Sprintf("[timer] %s: %ds left\n", playerName(id), int(remain.Seconds())))
+		}
+	}
+}
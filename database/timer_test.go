@@ -0,0 +1,63 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ratel-online/server/consts"
+)
+
+func TestTurnTimer(t *testing.T) {
+	room := &Room{ID: 7401, State: consts.RoomStateRunning}
+	timer := NewTurnTimer(room, time.Minute)
+	if room.Timer() != timer || timer.Remaining() != 0 {
+		t.Fatalf("timer should be idle before any turn")
+	}
+	timer.SetTurnTime(2, 30*time.Second)
+	timer.Start(1)
+	if remain := timer.Remaining(); remain <= 50*time.Second || remain > time.Minute {
+		t.Fatalf("turn should use the base time, got %v", remain)
+	}
+	if _, ok := timer.useBank(2); ok {
+		t.Fatalf("only the current player can use the time bank")
+	}
+	if bank, ok := timer.useBank(1); !ok || bank != consts.TimeBank {
+		t.Fatalf("current player should use the time bank, got %v", bank)
+	}
+	if _, ok := timer.useBank(1); ok {
+		t.Fatalf("time bank can only be used once per turn")
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	timer.Start(2)
+	if bank := timer.Bank(1); bank >= consts.TimeBank || bank < consts.TimeBank-time.Second {
+		t.Fatalf("used time should be taken from the bank, got %v", bank)
+	}
+	if remain := timer.Remaining(); remain > 30*time.Second {
+		t.Fatalf("turn should use the changed turn time, got %v", remain)
+	}
+	timer.Stop(1)
+	if timer.Remaining() == 0 {
+		t.Fatalf("stopping another player should not end the turn")
+	}
+	timer.Stop(2)
+	if timer.Remaining() != 0 || timer.Bank(2) != consts.TimeBank {
+		t.Fatalf("turn should end without using the bank")
+	}
+
+	// 回合之外的询问可以同时计时，不影响当前回合
+	timer.Start(1)
+	timer.Begin(2, 10*time.Second)
+	timer.Begin(3, 10*time.Second)
+	if timer.Remaining() <= 50*time.Second || timer.remaining(2) > 10*time.Second || timer.remaining(3) == 0 {
+		t.Fatalf("prompts should be timed separately from the turn")
+	}
+	if _, ok := timer.useBank(3); !ok {
+		t.Fatalf("prompts should be able to use the time bank")
+	}
+	timer.Stop(3)
+	if timer.Remaining() == 0 || timer.remaining(2) == 0 || timer.Bank(3) >= consts.TimeBank {
+		t.Fatalf("stopping a prompt should only end its own timing")
+	}
+	timer.stopTurn()
+}
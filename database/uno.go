@@ -14,10 +14,130 @@ import (
 )
 
 type UnoGame struct {
-	Room    *Room            `json:"room"`
-	Players []int            `json:"players"`
-	States  map[int]chan int `json:"states"`
-	Game    *game.Game       `json:"game"`
+	Room        *Room              `json:"room"`
+	Loop        *GameLoop          `json:"-"` // 本局的事件循环
+	Players     []int              `json:"players"`
+	Game        *game.Game         `json:"game"`
+	UnoPlayers  map[int]*UnoPlayer `json:"unoPlayers"`
+	Rules       UnoRules           `json:"rules"`
+	PendingDraw int                `json:"pendingDraw"`
+	Scores      map[int]int        `json:"scores"`
+	Round       int                `json:"round"`
+	// Color 当前要跟的颜色，万能牌为打出者选的颜色
+	Color color.Color `json:"color"`
+}
+
+// UnoRules 房间开启的房规
+type UnoRules struct {
+	Stacking    bool `json:"stacking"`
+	Challenge   bool `json:"challenge"`
+	UnoCall     bool `json:"unoCall"`
+	JumpIn      bool `json:"jumpIn"`
+	TargetScore int  `json:"targetScore"`
+}
+
+// NewRound 重新洗牌发牌，开始新的一局
+func (ug *UnoGame) NewRound() {
+	unoPlayers := make([]game.Player, 0, len(ug.Players))
+	for _, id := range ug.Players {
+		up := ug.UnoPlayers[id]
+		up.Called = false
+		unoPlayers = append(unoPlayers, up)
+	}
+	ug.Game = game.New(unoPlayers)
+	ug.Game.DealStartingCards()
+	ug.PendingDraw = 0
+	ug.Color = nil
+	ug.Round++
+}
+
+// Discard 把打出的牌放到弃牌堆顶，有色牌改变要跟的颜色，万能牌等 ChooseColor 选色
+func (ug *UnoGame) Discard(c card.Card) {
+	ug.Game.Pile().Add(c)
+	if c.Color() != nil {
+		ug.Color = c.Color()
+	}
+}
+
+// ChooseColor 给弃牌堆顶的万能牌选定颜色
+func (ug *UnoGame) ChooseColor(c color.Color) {
+	ug.Game.Pile().ReplaceTop(card.NewColoredCard(ug.Game.Pile().Top(), c))
+	ug.Color = c
+}
+
+// CanStack 是否可以在累积的罚牌上继续叠加，+2 上可以叠 +2 或 +4，+4 上只能叠 +4
+func (ug *UnoGame) CanStack(c card.Card) bool {
+	if ug.PendingDraw == 0 {
+		return false
+	}
+	switch c.(type) {
+	case card.WildDrawFourCard:
+		return true
+	case card.DrawTwoCard:
+		top := ug.Game.Pile().Top()
+		return top == nil || !top.Equal(card.NewWildDrawFourCard())
+	}
+	return false
+}
+
+func (ug *UnoGame) StackableCards(hand []card.Card) []card.Card {
+	cards := make([]card.Card, 0)
+	for _, c := range hand {
+		if ug.CanStack(c) {
+			cards = append(cards, c)
+		}
+	}
+	return cards
+}
+
+// SettleChallenge 结算对 +4 的质疑，出牌者手里有打出 +4 前要跟的颜色的牌时质疑成功，上一张是万能牌时按它选的颜色
+// 成功时出牌者摸 4 张和之前累积的罚牌，失败时下家摸累积的罚牌和 6 张并跳过，两种结果都清空累积的罚牌
+func (ug *UnoGame) SettleChallenge(offenderId int, prevColor color.Color) (guilty bool, penalty int) {
+	offender := ug.Game.Players().GetPlayerController(offenderId)
+	if prevColor != nil {
+		for _, c := range offender.Hand() {
+			if c.Color() == prevColor {
+				guilty = true
+				break
+			}
+		}
+	}
+	if guilty {
+		penalty = ug.PendingDraw + 4
+		ug.PendingDraw = 0
+		offender.AddCards(ug.Game.Deck().Draw(penalty))
+		return guilty, penalty
+	}
+	penalty = ug.PendingDraw + 6
+	ug.PendingDraw = 0
+	ug.Game.Players().Next().AddCards(ug.Game.Deck().Draw(penalty))
+	return guilty, penalty
+}
+
+// ReachedTarget 返回达到目标分数的玩家，未开启计分时总是结束
+func (ug *UnoGame) ReachedTarget(playerId int) bool {
+	return ug.Rules.TargetScore <= 0 || ug.Scores[playerId] >= ug.Rules.TargetScore
+}
+
+// UnoCardPoints 数字牌按点数计分，功能牌 20 分，万能牌 50 分
+func UnoCardPoints(c card.Card) int {
+	switch c := c.(type) {
+	case card.NumberCard:
+		return c.Number()
+	case card.SkipCard, card.ReverseCard, card.DrawTwoCard:
+		return 20
+	case card.WildCard, card.WildDrawFourCard:
+		return 50
+	}
+	return 0
+}
+
+func UnoHandPoints(hand []card.Card) int {
+	points := 0
+	for _, c := range hand {
+		points += UnoCardPoints(c)
+	}
+	return points
 }
 
 func (ug *UnoGame) HavePlay(player *Player) bool {
@@ -34,19 +154,19 @@ func (un *UnoGame) NeedExit() bool {
 }
 
 func (un *UnoGame) Clean() {
-	if un != nil {
-		for _, state := range un.States {
-			close(state)
-		}
-	}
 }
 
 type UnoPlayer struct {
-	ID   int    `json:"id"`
-	Name string `json:"name"`
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Called bool   `json:"called"`
+	// Filter 限制可以打出的牌，叠加罚牌时只能出 +2/+4
+	Filter func(card.Card) bool `json:"-"`
+	// Forced 抢出时直接打出的牌
+	Forced card.Card `json:"-"`
 }
 
-func NewUnoPlayer(p *Player) game.Player {
+func NewUnoPlayer(p *Player) *UnoPlayer {
 	return &UnoPlayer{
 		ID:   int(p.ID),
 		Name: p.Name,
@@ -105,6 +225,9 @@ func (up *UnoPlayer) OnPlayerPassed(payload event.PlayerPassedPayload) {
 
 func (up *UnoPlayer) PickColor(gameState game.State) color.Color {
 	p := getPlayer(int64(up.ID))
+	timer := playerTimer(p)
+	timer.Begin(p.ID, consts.PlayTimeout)
+	defer timer.Stop(p.ID)
 	loopCount := 0
 	for {
 		loopCount++
@@ -119,9 +242,9 @@ func (up *UnoPlayer) PickColor(gameState game.State) color.Color {
 			color.Green,
 			color.Blue,
 		))
-		colorName, err := p.AskForString(consts.PlayTimeout)
+		colorName, err := timer.Ask(p)
 		if err != nil {
-			if err == consts.ErrorsTimeout {
+			if err == consts.ErrorsTimeout || err == consts.ErrorsChanClosed {
 				return color.Red
 			}
 			p.WriteString(fmt.Sprintf("Unknown color '%s' \n", colorName))
@@ -137,6 +260,20 @@ func (up *UnoPlayer) PickColor(gameState game.State) color.Color {
 }
 
 func (up *UnoPlayer) Play(playableCards []card.Card, gameState game.State) (card.Card, error) {
+	if up.Forced != nil {
+		forced := up.Forced
+		up.Forced = nil
+		return forced, nil
+	}
+	if up.Filter != nil {
+		filtered := make([]card.Card, 0)
+		for _, c := range playableCards {
+			if up.Filter(c) {
+				filtered = append(filtered, c)
+			}
+		}
+		playableCards = filtered
+	}
 	p := getPlayer(int64(up.ID))
 	Broadcast(p.RoomID, fmt.Sprintf("It's %s turn! \n", p.Name), p.ID)
 	buf := bytes.Buffer{}
@@ -149,11 +286,17 @@ func (up *UnoPlayer) Play(playableCards []card.Card, gameState game.State) (card
 		label := string(runeSequence.next())
 		cardOptions[label] = card
 	}
-	cardSelectionLines := []string{"Select a card to play:"}
+	cardSelectionLines := []string{"Select a card to play (add 'uno' to call UNO, e.g. 'A uno'):"}
+	if up.Filter != nil {
+		cardSelectionLines = append(cardSelectionLines, "draw Take the stacked penalty")
+	}
 	for label, card := range cardOptions {
 		cardSelectionLines = append(cardSelectionLines, fmt.Sprintf("%s %s", label, card))
 	}
 	cardSelectionMessage := strings.Join(cardSelectionLines, " \n ") + " \n "
+	timer := playerTimer(p)
+	timer.Start(p.ID)
+	defer timer.Stop(p.ID)
 	loopCount := 0
 	for {
 		loopCount++
@@ -162,13 +305,28 @@ func (up *UnoPlayer) Play(playableCards []card.Card, gameState game.State) (card
 		}
 		p = getPlayer(p.ID)
 		p.WriteString(cardSelectionMessage)
-		selectedLabel, err := p.AskForString(consts.PlayTimeout)
+		selectedLabel, err := timer.Ask(p)
 		if err != nil {
-			if err == consts.ErrorsTimeout {
-				selectedLabel = "A"
-			} else {
+			if err != consts.ErrorsTimeout {
 				return nil, err
 			}
+			if up.Filter != nil {
+				return nil, nil
+			}
+			selectedLabel = "A"
+		}
+		fields := strings.Fields(selectedLabel)
+		if len(fields) > 0 && strings.ToLower(fields[len(fields)-1]) == "uno" {
+			up.Called = true
+			fields = fields[:len(fields)-1]
+			if len(fields) == 0 {
+				Broadcast(p.RoomID, fmt.Sprintf("%s shouts UNO!\n", p.Name))
+				continue
+			}
+			selectedLabel = strings.Join(fields, " ")
+		}
+		if up.Filter != nil && strings.ToLower(selectedLabel) == "draw" {
+			return nil, nil
 		}
 		selectedCard, found := cardOptions[strings.ToUpper(selectedLabel)]
 		if !found {
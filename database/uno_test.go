@@ -0,0 +1,110 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/feel-easy/uno/card"
+	"github.com/feel-easy/uno/card/color"
+	"github.com/feel-easy/uno/game"
+	"github.com/ratel-online/core/network"
+)
+
+// newTestUnoGame 两位玩家的空手牌对局
+func newTestUnoGame(t *testing.T, rules UnoRules) *UnoGame {
+	newTestStore(t,
+		&Player{ID: 1, Name: "Alice", online: true, conn: network.Wrapper(&fakeConn{})},
+		&Player{ID: 2, Name: "Bob", online: true, conn: network.Wrapper(&fakeConn{})},
+	)
+	ug := &UnoGame{
+		Players:    []int{1, 2},
+		UnoPlayers: map[int]*UnoPlayer{1: {ID: 1, Name: "Alice"}, 2: {ID: 2, Name: "Bob"}},
+		Rules:      rules,
+		Scores:     map[int]int{},
+	}
+	ug.Game = game.New([]game.Player{ug.UnoPlayers[1], ug.UnoPlayers[2]})
+	ug.Game.Players().Next() // 轮到 Alice 出牌
+	return ug
+}
+
+func TestUnoStacking(t *testing.T) {
+	ug := newTestUnoGame(t, UnoRules{Stacking: true})
+	drawTwo, drawFour := card.NewDrawTwoCard(color.Red), card.NewWildDrawFourCard()
+	if ug.CanStack(drawTwo) {
+		t.Fatalf("nothing to stack without a pending penalty")
+	}
+	ug.PendingDraw = 2
+	ug.Game.Pile().Add(card.NewDrawTwoCard(color.Blue))
+	hand := []card.Card{drawTwo, drawFour, card.NewNumberCard(color.Red, 5)}
+	if stackable := ug.StackableCards(hand); len(stackable) != 2 {
+		t.Fatalf("+2 and +4 should stack on +2, got %v", stackable)
+	}
+	ug.PendingDraw = 6
+	ug.Game.Pile().Add(card.NewColoredCard(drawFour, color.Green))
+	if ug.CanStack(drawTwo) || !ug.CanStack(drawFour) {
+		t.Fatalf("only +4 should stack on +4")
+	}
+}
+
+func TestUnoChallenge(t *testing.T) {
+	var prevColor color.Color = color.Red
+
+	// 质疑成功：出牌者摸 4 张和之前叠加的罚牌
+	ug := newTestUnoGame(t, UnoRules{Stacking: true, Challenge: true})
+	ug.Game.Players().GetPlayerController(1).AddCards([]card.Card{card.NewNumberCard(color.Red, 7)})
+	ug.PendingDraw = 2
+	if guilty, penalty := ug.SettleChallenge(1, prevColor); !guilty || penalty != 6 {
+		t.Fatalf("challenge should succeed with 6 cards, got %v %d", guilty, penalty)
+	}
+	if ug.PendingDraw != 0 || len(ug.Game.GetPlayerCards(1)) != 7 || len(ug.Game.GetPlayerCards(2)) != 0 {
+		t.Fatalf("offender should take the whole penalty, pending %d", ug.PendingDraw)
+	}
+
+	// 质疑失败：下家摸之前叠加的罚牌和 6 张
+	ug = newTestUnoGame(t, UnoRules{Stacking: true, Challenge: true})
+	ug.Game.Players().GetPlayerController(1).AddCards([]card.Card{card.NewNumberCard(color.Blue, 7)})
+	ug.PendingDraw = 2
+	if guilty, penalty := ug.SettleChallenge(1, prevColor); guilty || penalty != 8 {
+		t.Fatalf("challenge should fail with 8 cards, got %v %d", guilty, penalty)
+	}
+	if ug.PendingDraw != 0 || len(ug.Game.GetPlayerCards(2)) != 8 || len(ug.Game.GetPlayerCards(1)) != 1 {
+		t.Fatalf("challenger should take the whole penalty, pending %d", ug.PendingDraw)
+	}
+
+	// 上一张是万能牌时按它选的颜色判断
+	ug = newTestUnoGame(t, UnoRules{Challenge: true})
+	ug.Game.Players().GetPlayerController(1).AddCards([]card.Card{card.NewNumberCard(color.Green, 7)})
+	ug.Discard(card.NewWildCard())
+	ug.ChooseColor(color.Green)
+	prevColor = ug.Color
+	ug.Discard(card.NewWildDrawFourCard())
+	ug.ChooseColor(color.Blue)
+	if guilty, penalty := ug.SettleChallenge(1, prevColor); !guilty || penalty != 4 || ug.Color != color.Blue {
+		t.Fatalf("holding the wild's color should be guilty, got %v %d", guilty, penalty)
+	}
+}
+
+func TestUnoScoring(t *testing.T) {
+	hand := []card.Card{
+		card.NewNumberCard(color.Red, 7),
+		card.NewSkipCard(color.Blue),
+		card.NewDrawTwoCard(color.Green),
+		card.NewWildCard(),
+		card.NewWildDrawFourCard(),
+	}
+	if points := UnoHandPoints(hand); points != 147 {
+		t.Fatalf("hand should be worth 147 points, got %d", points)
+	}
+	ug := newTestUnoGame(t, UnoRules{})
+	if !ug.ReachedTarget(1) {
+		t.Fatalf("a single round should end without a target score")
+	}
+	ug.Rules.TargetScore = 200
+	ug.Scores[1] = 150
+	if ug.ReachedTarget(1) {
+		t.Fatalf("150 should not reach the target of 200")
+	}
+	ug.Scores[1] += UnoHandPoints(hand)
+	if !ug.ReachedTarget(1) {
+		t.Fatalf("297 should reach the target of 200")
+	}
+}
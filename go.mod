@@ -3,15 +3,16 @@ module github.com/ratel-online/server
 go 1.22
 
 require (
+	github.com/Szzrain/Milky-go-sdk v1.0.1
 	github.com/awesome-cap/hashmap v0.0.0-20211211100532-e3300ac4ae14
 	github.com/feel-easy/mahjong v0.0.0-20220721030133-7a0f4032c008
 	github.com/feel-easy/uno v0.0.0-20220721061415-e6a3189cfd70
 	github.com/gorilla/websocket v1.5.3
 	github.com/ratel-online/core v0.0.0-20250225062905-81b6faff6d25
+	github.com/spf13/cast v1.6.0
 )
 
 require (
-	github.com/Szzrain/Milky-go-sdk v1.0.1 // indirect
 	github.com/awesome-cap/im v0.0.0-20210720090440-7556eb92965d // indirect
 	github.com/fatih/color v1.13.0 // indirect
 	github.com/json-iterator/go v1.1.12 // indirect
@@ -19,6 +20,5 @@ require (
 	github.com/mattn/go-isatty v0.0.14 // indirect
 	github.com/modern-go/concurrent v0.0.0-20180228061459-e0a39a4cb421 // indirect
 	github.com/modern-go/reflect2 v1.0.2 // indirect
-	github.com/spf13/cast v1.6.0 // indirect
 	golang.org/x/sys v0.0.0-20210630005230-0f9fa26af87c // indirect
 )
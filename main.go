@@ -8,15 +8,19 @@ import (
 	"github.com/ratel-online/core/log"
 	"github.com/ratel-online/core/util/async"
 	"github.com/ratel-online/server/bot"
+	"github.com/ratel-online/server/database"
 	"github.com/ratel-online/server/network"
 )
 
 var (
-	Wsport   int
-	Tcpport  int
-	BotAddr  string
-	BotToken string
-	BotGroup int64
+	Wsport     int
+	Tcpport    int
+	BotAddr    string
+	BotToken   string
+	BotGroup   int64
+	AdminToken string
+	InviteURL  string
+	ChatWords  string
 )
 
 func main() {
@@ -25,8 +29,14 @@ func main() {
 	flag.StringVar(&BotAddr, "bot", "", "Bot connection address")
 	flag.StringVar(&BotToken, "bot-token", "", "Bot token")
 	flag.Int64Var(&BotGroup, "bot-group", 0, "Bot group ID")
+	flag.StringVar(&AdminToken, "admin-token", "", "Admin token, players input /sudo <token> to become admin")
+	flag.StringVar(&InviteURL, "invite-url", "", "Public websocket address used in invite links, e.g. ws://example.com:9998/ws")
+	flag.StringVar(&ChatWords, "chat-words", "", "Blocked chat words file, one word per line, reloaded when modified")
 
 	flag.Parse()
+	database.SetAdminToken(AdminToken)
+	database.SetInviteURL(InviteURL)
+	database.SetChatWordsFile(ChatWords)
 	// 连接机器人
 	if BotAddr != "" && BotToken != "" && BotGroup != 0 {
 		err := bot.Connect(BotAddr, BotToken, BotGroup)
@@ -50,4 +60,4 @@ func main() {
 
 	server := network.NewTcpServer(":" + strconv.Itoa(Tcpport))
 	log.Panic(server.Serve())
-}
\ No newline at end of file
+}
@@ -17,7 +17,7 @@ type Network interface {
 	Serve() error
 }
 
-func handle(rwc protocol.ReadWriteCloser) error {
+func handle(rwc protocol.ReadWriteCloser, inviteCode string) error {
 	// 给新进入的用户分配资源
 	c := network.Wrapper(rwc)
 	defer func() {
@@ -33,6 +33,7 @@ func handle(rwc protocol.ReadWriteCloser) error {
 		return err
 	}
 	player := database.Connected(c, authInfo)
+	player.SetInvite(inviteCode)
 	log.Infof("player auth accessed, ip %s, %d:%s\n", player.IP, player.ID, authInfo.Name)
 	go state.Run(player)
 	defer player.Offline()
@@ -59,6 +60,9 @@ func loginAuth(c *network.Conn) (*model.AuthInfo, error) {
 	})
 	select {
 	case authInfo := <-authChan:
+		if ban := database.CheckBan(database.AccountKey(authInfo), c.IP()); ban != nil {
+			return nil, ban.Err()
+		}
 		return authInfo, nil
 	case <-time.After(3 * time.Second):
 		return nil, consts.ErrorsAuthFail
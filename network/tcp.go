@@ -34,7 +34,7 @@ func (t Tcp) Serve() error {
 			continue
 		}
 		async.Async(func() {
-			err := handle(protocol.NewTcpReadWriteCloser(conn))
+			err := handle(protocol.NewTcpReadWriteCloser(conn), "")
 			if err != nil {
 				log.Error(err)
 			}
@@ -35,7 +35,8 @@ func serveWs(w http.ResponseWriter, r *http.Request) {
         log.Error(err)
         return
     }
-    err = handle(protocol.NewWebsocketReadWriteCloser(conn))
+    // 邀请链接带的邀请码，登录后直接进入房间
+    err = handle(protocol.NewWebsocketReadWriteCloser(conn), r.URL.Query().Get("code"))
     if err != nil{
         log.Error(err)
     }
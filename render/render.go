@@ -3,6 +3,9 @@ package render
 import (
 	"bytes"
 	"fmt"
+	"strings"
+	"time"
+
 	constx "github.com/ratel-online/core/consts"
 	"github.com/ratel-online/core/model"
 	"github.com/ratel-online/server/consts"
@@ -49,22 +52,75 @@ func GameTypeOptions(player *database.Player) error {
 	})
 }
 
-func RoomList(player *database.Player) error {
+// RoomListString 房间列表，带人数、设置和最近活跃时间，私密房间和有密码的房间前面带 *
+func RoomListString(rooms []*database.Room, page, pages int) string {
 	buf := bytes.Buffer{}
-	buf.WriteString(fmt.Sprintf("%-10s%-10s%-10s%-10s\n", "ID", "Type", "Players", "State"))
-	for _, room := range database.GetRooms() {
-		buf.WriteString(fmt.Sprintf("%-10d%-10s%-10d%-10s\n", room.ID, consts.GameTypes[room.Type], room.Players, consts.RoomStates[room.State]))
+	buf.WriteString(fmt.Sprintf("%-8s%-20s%-10s%-10s%-10s%-20s\n", "ID", "Type", "Players", "State", "Active", "Props"))
+	for _, room := range rooms {
+		flag := ""
+		if room.HasPassword() || room.Private {
+			flag = "*"
+		}
+		buf.WriteString(fmt.Sprintf("%-8d%-20s%-10s%-10s%-10s%-20s\n",
+			room.ID,
+			flag+consts.GameTypes[room.Type],
+			fmt.Sprintf("%d/%d", room.Players, room.MaxPlayers),
+			consts.RoomStates[room.State],
+			sprintIdle(time.Since(room.ActiveTime)),
+			strings.Join(room.Props(), ","),
+		))
 	}
-	modelRooms := make([]model.Room, 0)
-	for _, room := range database.GetRooms() {
-		modelRooms = append(modelRooms, room.Model())
+	buf.WriteString(fmt.Sprintf("Page %d/%d, input n/prev to turn pages, ls [t=1 w f o c sort=id p=2] to filter\n", page, pages))
+	return buf.String()
+}
+
+func sprintIdle(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
 	}
-	return player.WriteObject(model.RoomList{
+	return fmt.Sprintf("%dh", int(d.Hours()))
+}
+
+// RoomSummary 房间列表里的房间，在 core 的房间模型之外带上人数上限、设置和活跃时间
+type RoomSummary struct {
+	model.Room
+	MaxPlayers int       `json:"maxPlayers"`
+	Locked     bool      `json:"locked"` // 私密房间或有密码的房间
+	Props      []string  `json:"props"`
+	ActiveTime time.Time `json:"activeTime"`
+}
+
+// RoomListView 筛选后的房间列表，Msg 为文字版
+type RoomListView struct {
+	model.Data
+	Rooms []RoomSummary `json:"rooms"`
+	Page  int           `json:"page"`
+	Pages int           `json:"pages"`
+}
+
+func RoomList(player *database.Player, filter *database.RoomFilter) error {
+	rooms, pages := database.FilterRooms(filter)
+	summaries := make([]RoomSummary, 0, len(rooms))
+	for _, room := range rooms {
+		summaries = append(summaries, RoomSummary{
+			Room:       room.Model(),
+			MaxPlayers: room.MaxPlayers,
+			Locked:     room.HasPassword() || room.Private,
+			Props:      room.Props(),
+			ActiveTime: room.ActiveTime,
+		})
+	}
+	return player.WriteObject(RoomListView{
 		Data: model.Data{
 			Code: constx.CodeRoomList,
-			Msg:  buf.String(),
+			Msg:  RoomListString(rooms, filter.Page, pages),
 		},
-		Rooms: modelRooms,
+		Rooms: summaries,
+		Page:  filter.Page,
+		Pages: pages,
 	})
 }
 
@@ -129,3 +185,19 @@ func OwnerChange(player *database.Player, room *database.Room) {
 		Player: player.Model(),
 	})
 }
+
+// ProfileView 玩家资料，Msg 为文字版
+type ProfileView struct {
+	model.Data
+	Profile database.Profile `json:"profile"`
+}
+
+func Profile(player *database.Player, profile database.Profile) error {
+	return player.WriteObject(ProfileView{
+		Data: model.Data{
+			Code: consts.CodeProfile,
+			Msg:  profile.String(),
+		},
+		Profile: profile,
+	})
+}
@@ -186,14 +186,15 @@ func (SKLFSkill) Desc(player *database.Player) string {
 }
 
 func (SKLFSkill) Apply(player *database.Player, game *database.Game) {
-	for id := range game.PlayTimeOut {
+	timer := game.Room.Timer()
+	for _, id := range game.Players {
 		if id == player.ID {
 			continue
 		}
-		if game.PlayTimeOut[id] >= 10*time.Second {
-			game.PlayTimeOut[id] /= 2
+		if timeout := timer.TurnTime(id); timeout >= 10*time.Second {
+			timer.SetTurnTime(id, timeout/2)
 		} else {
-			game.PlayTimeOut[id] = 5 * time.Second
+			timer.SetTurnTime(id, 5*time.Second)
 		}
 	}
 }
@@ -0,0 +1,76 @@
+package state
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ratel-online/server/consts"
+	"github.com/ratel-online/server/database"
+	"github.com/spf13/cast"
+)
+
+// handleChat 处理大厅聊天、私聊、回复和屏蔽指令，返回输入是否已被处理
+// lobby 表示玩家在大厅，只有大厅里的玩家可以使用大厅频道
+func handleChat(player *database.Player, signal string, lobby bool) bool {
+	signal = strings.TrimSpace(signal)
+	if !strings.HasPrefix(signal, "/") {
+		return false
+	}
+	cmd, rest := splitFirst(signal)
+	switch strings.ToLower(cmd) {
+	case "/l":
+		if !lobby {
+			return false
+		}
+		if rest == "" {
+			_ = player.WriteError(consts.ErrorsInputInvalid)
+			return true
+		}
+		database.BroadcastLobby(player, fmt.Sprintf("[lobby] %s say: %s\n", player.Name, rest))
+	case "/w":
+		key, msg := splitFirst(rest)
+		whisper(player, database.FindPlayer(key), msg)
+	case "/r":
+		target := player.ReplyTarget()
+		if target == nil {
+			_ = player.WriteError(consts.ErrorsNoReply)
+			return true
+		}
+		whisper(player, target, rest)
+	case "/block":
+		target := database.FindPlayer(rest)
+		if target == nil {
+			target = database.GetPlayer(cast.ToInt64(rest))
+		}
+		if target == nil || target.ID == player.ID {
+			_ = player.WriteError(consts.ErrorsPlayerNotFound)
+		} else if player.ToggleMute(target.ID) {
+			_ = player.WriteString(fmt.Sprintf("You blocked %s, input /block %d again to unblock\n", target.Name, target.ID))
+		} else {
+			_ = player.WriteString(fmt.Sprintf("You unblocked %s\n", target.Name))
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+func whisper(player, target *database.Player, msg string) {
+	if msg == "" {
+		_ = player.WriteError(consts.ErrorsInputInvalid)
+		return
+	}
+	if err := database.Whisper(player, target, fmt.Sprintf("[whisper] %s(%d): %s\n", player.Name, player.ID, msg)); err != nil {
+		_ = player.WriteError(err)
+		return
+	}
+	_ = player.WriteString(fmt.Sprintf("[to %s] %s\n", target.Name, msg))
+}
+
+func splitFirst(s string) (string, string) {
+	fields := strings.SplitN(strings.TrimSpace(s), " ", 2)
+	if len(fields) < 2 {
+		return fields[0], ""
+	}
+	return fields[0], strings.TrimSpace(fields[1])
+}
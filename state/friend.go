@@ -0,0 +1,63 @@
+package state
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ratel-online/server/consts"
+	"github.com/ratel-online/server/database"
+)
+
+// handleFriend 处理以 / 开头的好友指令，返回下一个状态和输入是否已被处理
+// lobby 表示玩家在大厅，只有大厅里的玩家可以直接加入好友的房间
+func handleFriend(player *database.Player, signal string, lobby bool) (consts.StateID, bool) {
+	cmd, rest := splitFirst(signal)
+	switch strings.ToLower(cmd) {
+	case "/friends":
+		_ = player.WriteString(database.SprintFriends(player))
+	case "/friend":
+		action, name := splitFirst(rest)
+		switch strings.ToLower(action) {
+		case "add":
+			if friend, err := database.AddFriend(player, name); err != nil {
+				_ = player.WriteError(err)
+			} else {
+				_ = player.WriteString(fmt.Sprintf("%s is your friend now, %s\n", friend.Name, friend.Presence()))
+			}
+		case "rm":
+			if err := database.RemoveFriend(player, name); err != nil {
+				_ = player.WriteError(err)
+			} else {
+				_ = player.WriteString(fmt.Sprintf("%s removed from your friends\n", name))
+			}
+		case "join":
+			if !lobby {
+				_ = player.WriteError(consts.ErrorsLeaveRoomFirst)
+				return 0, true
+			}
+			return joinFriend(player, name), true
+		default:
+			_ = player.WriteError(consts.ErrorsInputInvalid)
+		}
+	default:
+		return 0, false
+	}
+	return 0, true
+}
+
+// joinFriend 加入好友所在的房间，房间满了或正在游戏时作为观众加入
+func joinFriend(player *database.Player, name string) consts.StateID {
+	room, err := database.FriendRoom(player, name)
+	if err != nil {
+		_ = player.WriteError(err)
+		return 0
+	}
+	if room.HasPassword() || room.Private {
+		if err = verifyAccess(player, room); err != nil {
+			_ = player.WriteError(err)
+			return 0
+		}
+	}
+	next, _ := enterRoom(player, room)
+	return next
+}
@@ -5,11 +5,11 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/ratel-online/core/util/rand"
 	"github.com/ratel-online/server/rule"
 
+	constx "github.com/ratel-online/core/consts"
 	"github.com/ratel-online/core/log"
 	modelx "github.com/ratel-online/core/model"
 	"github.com/ratel-online/core/util/poker"
@@ -23,18 +23,42 @@ type Game struct{}
 var (
 	stateRob       = 1
 	statePlay      = 2
-	stateReset     = 3
-	stateWaiting   = 4
-	stateFirstCard = 5
-	stateTakeCard  = 6
+	stateFirstCard = 3
+	stateTakeCard  = 4
+	stateDingQue   = 5
 )
 
 func (g *Game) Next(player *database.Player) (consts.StateID, error) {
-	room := database.GetRoom(player.RoomID)
-	if room == nil {
-		return 0, player.WriteError(consts.ErrorsExist)
+	return database.WaitGame(player)
+}
+
+// handleGame 房间事件循环里处理斗地主的抢地主和出牌
+func handleGame(game *database.Game) database.GameHandler {
+	return func(player *database.Player, state int) error {
+		switch state {
+		case stateRob:
+			if !game.Room.EnableLandlord {
+				// reset all players group
+				for i, id := range game.Players {
+					game.Groups[id] = i
+					if game.Room.EnableLaiZi {
+						game.Pokers[id].SetOaa(game.Universals...)
+						game.Pokers[id].SortByOaaValue()
+					}
+				}
+				game.Loop.Send(player.ID, statePlay)
+				return nil
+			}
+			return handleRob(player, game)
+		case statePlay:
+			return handlePlay(player, game)
+		}
+		return nil
 	}
-	game := room.Game.(*database.Game)
+}
+
+// sendPokers 开局和重新发牌后告诉玩家手里的牌
+func sendPokers(player *database.Player, game *database.Game) {
 	buf := bytes.Buffer{}
 	if game.Room.EnableLaiZi {
 		if game.Room.EnableSkill {
@@ -53,54 +77,6 @@ func (g *Game) Next(player *database.Player) (consts.StateID, error) {
 	}
 	buf.WriteString(fmt.Sprintf("Your pokers: %s\n", game.Pokers[player.ID].String()))
 	_ = player.WriteString(buf.String())
-	loopCount := 0
-	for {
-		loopCount++
-		if loopCount%100 == 0 {
-			log.Infof("[Game.Next] Player %d (Room %d) loop count: %d, room.State: %d\n", player.ID, player.RoomID, loopCount, room.State)
-		}
-		if room.State == consts.RoomStateWaiting {
-			log.Infof("[Game.Next] Player %d exiting, room state changed to waiting, loop count: %d\n", player.ID, loopCount)
-			return consts.StateWaiting, nil
-		}
-		log.Infof("[Game.Next] Player %d waiting for state, loop count: %d\n", player.ID, loopCount)
-		state := <-game.States[player.ID]
-		switch state {
-		case stateRob:
-			if !game.Room.EnableLandlord {
-				// reset all players group
-				for i, id := range game.Players {
-					game.Groups[id] = i
-					if game.Room.EnableLaiZi {
-						game.Pokers[id].SetOaa(game.Universals...)
-						game.Pokers[id].SortByOaaValue()
-					}
-				}
-				game.States[player.ID] <- statePlay
-			} else {
-				err := handleRob(player, game)
-				if err != nil {
-					log.Error(err)
-					return 0, err
-				}
-			}
-		case stateReset:
-			if player.ID == room.Creator {
-				game.States[game.Players[rand.Intn(len(game.States))]] <- stateRob
-			}
-			return 0, nil
-		case statePlay:
-			err := handlePlay(player, game)
-			if err != nil {
-				log.Error(err)
-				return 0, err
-			}
-		case stateWaiting:
-			return consts.StateWaiting, nil
-		default:
-			return 0, consts.ErrorsChanClosed
-		}
-	}
 }
 
 func (*Game) Exit(player *database.Player) consts.StateID {
@@ -117,8 +93,9 @@ func handleRob(player *database.Player, game *database.Game) error {
 			}
 			database.Broadcast(player.RoomID, "All players have give up the landlord, restarting...\n")
 			for _, playerId := range game.Players {
-				game.States[playerId] <- stateReset
+				sendPokers(database.GetPlayer(playerId), game)
 			}
+			game.Loop.Send(game.Players[rand.Intn(len(game.Players))], stateRob)
 		} else if game.FirstRob == game.LastRob {
 			landlord := database.GetPlayer(game.LastRob)
 			game.FirstPlayer = landlord.ID
@@ -138,10 +115,10 @@ func handleRob(player *database.Player, game *database.Game) error {
 				buf.WriteString(fmt.Sprintf("%s became landlord, got pokers: %s\n", landlord.Name, game.Additional.String()))
 			}
 			database.Broadcast(player.RoomID, buf.String())
-			game.States[landlord.ID] <- statePlay
+			game.Loop.Send(landlord.ID, statePlay)
 		} else {
 			game.FinalRob = true
-			game.States[game.FirstRob] <- stateRob
+			game.Loop.Send(game.FirstRob, stateRob)
 		}
 		return nil
 	}
@@ -150,20 +127,20 @@ func handleRob(player *database.Player, game *database.Game) error {
 		database.Broadcast(player.RoomID, fmt.Sprintf("%s's turn to rob\n", player.Name), player.ID)
 	}
 
-	timeout := consts.RobTimeout
+	timer := game.Room.Timer()
+	timer.Begin(player.ID, consts.RobTimeout)
+	defer timer.Stop(player.ID)
 	loopCount := 0
 	for {
 		loopCount++
 		if loopCount%100 == 0 {
-			log.Infof("[handleRob] Player %d (Room %d) loop count: %d, timeout: %v, FirstRob: %d, LastRob: %d\n", player.ID, player.RoomID, loopCount, timeout, game.FirstRob, game.LastRob)
+			log.Infof("[handleRob] Player %d (Room %d) loop count: %d, FirstRob: %d, LastRob: %d\n", player.ID, player.RoomID, loopCount, game.FirstRob, game.LastRob)
 		}
-		before := time.Now().Unix()
 		_ = player.WriteString("Are you want to become landlord? (y or n)\n")
-		ans, err := player.AskForString(timeout)
+		ans, err := timer.Ask(player)
 		if err != nil && err != consts.ErrorsExist {
 			ans = "n"
 		}
-		timeout -= time.Second * time.Duration(time.Now().Unix()-before)
 		ans = strings.ToLower(ans)
 		if ans == "y" {
 			if game.FirstRob == 0 {
@@ -184,39 +161,38 @@ func handleRob(player *database.Player, game *database.Game) error {
 	if game.FinalRob {
 		game.FinalRob = false
 		game.FirstRob = game.LastRob
-		game.States[game.FirstPlayer] <- stateRob
+		game.Loop.Send(game.FirstPlayer, stateRob)
 	} else {
-		game.States[game.NextPlayer(player.ID)] <- stateRob
+		game.Loop.Send(game.NextPlayer(player.ID), stateRob)
 	}
 	return nil
 }
 
 func playing(player *database.Player, game *database.Game, master bool, playTimes int) error {
-	timeout := game.PlayTimeOut[player.ID]
+	timer := game.Room.Timer()
+	timer.Start(player.ID)
+	defer timer.Stop(player.ID)
 	loopCount := 0
 	for {
 		loopCount++
 		if loopCount%100 == 0 {
-			log.Infof("[playing] Player %d (Room %d) loop count: %d, master: %v, playTimes: %d, timeout: %v\n", player.ID, player.RoomID, loopCount, master, playTimes, timeout)
+			log.Infof("[playing] Player %d (Room %d) loop count: %d, master: %v, playTimes: %d, timeout: %v\n", player.ID, player.RoomID, loopCount, master, playTimes, timer.Remaining())
 		}
 		buf := bytes.Buffer{}
 		buf.WriteString("\n")
 		if !master && len(game.LastPokers) > 0 {
 			buf.WriteString(fmt.Sprintf("Last player: %s (%s), played: %s\n", database.GetPlayer(game.LastPlayer).Name, game.Team(game.LastPlayer), game.LastPokers.String()))
 		}
-		buf.WriteString(fmt.Sprintf("Timeout: %ds, pokers: %s\n", int(timeout.Seconds()), game.Pokers[player.ID].String()))
+		buf.WriteString(fmt.Sprintf("Timeout: %ds, time bank: %ds, pokers: %s\n", int(timer.Remaining().Seconds()), int(timer.Bank(player.ID).Seconds()), game.Pokers[player.ID].String()))
 		_ = player.WriteString(buf.String())
-		before := time.Now().Unix()
 		pokers := game.Pokers[player.ID]
-		ans, err := player.AskForString(timeout)
+		ans, err := timer.Ask(player)
 		if err != nil {
 			if master {
 				ans = poker.GetAlias(pokers[0].Key)
 			} else {
 				ans = "p"
 			}
-		} else {
-			timeout -= time.Second * time.Duration(time.Now().Unix()-before)
 		}
 		ans = strings.ToLower(ans)
 		if ans == "" {
@@ -232,7 +208,7 @@ func playing(player *database.Player, game *database.Game, master bool, playTime
 			} else {
 				nextPlayer := database.GetPlayer(game.NextPlayer(player.ID))
 				database.Broadcast(player.RoomID, fmt.Sprintf("%s passed, next %s\n", player.Name, nextPlayer.Name))
-				game.States[nextPlayer.ID] <- statePlay
+				game.Loop.Send(nextPlayer.ID, statePlay)
 				return nil
 			}
 		}
@@ -318,18 +294,32 @@ func playing(player *database.Player, game *database.Game, master bool, playTime
 		game.Pokers[player.ID] = pokers
 		game.LastPlayer = player.ID
 		game.LastFaces = lastFaces
+		if lastFaces.Type == constx.FacesBomb {
+			player.RecordBomb()
+		}
 		game.LastPokers = sells
 		game.Discards = append(game.Discards, sells...)
 		if len(pokers) == 0 {
 			database.Broadcast(player.RoomID, fmt.Sprintf("%s played %s, won the game! \n", player.Name, sells.OaaString()))
-			room := database.GetRoom(player.RoomID)
-			if room != nil {
-				room.Game = nil
-				room.State = consts.RoomStateWaiting
+			winners, losers := make([]int64, 0), make([]int64, 0)
+			for _, id := range game.Players {
+				if game.IsTeammate(player.ID, id) {
+					winners = append(winners, id)
+				} else {
+					losers = append(losers, id)
+				}
 			}
-			for _, playerId := range game.Players {
-				game.States[playerId] <- stateWaiting
+			database.BroadcastRatings(player.RoomID, database.RateTeams(game.Room.Type, winners, losers))
+			database.RecordGame(game.Room.Type, game.Players, winners)
+			if game.Room.EnableLandlord {
+				for _, id := range game.Players {
+					if game.IsLandlord(id) {
+						database.GetPlayer(id).RecordLandlord(game.IsTeammate(player.ID, id))
+					}
+				}
 			}
+			database.EndGame(game.Room, nil)
+			database.OpenRematch(game.Room, game.Players, winners)
 			return nil
 		}
 		if master {
@@ -341,7 +331,7 @@ func playing(player *database.Player, game *database.Game, master bool, playTime
 		}
 		nextPlayer := database.GetPlayer(game.NextPlayer(player.ID))
 		database.Broadcast(player.RoomID, fmt.Sprintf("%s played %s, next %s\n", player.Name, sells.OaaString(), nextPlayer.Name))
-		game.States[nextPlayer.ID] <- statePlay
+		game.Loop.Send(nextPlayer.ID, statePlay)
 		return nil
 	}
 }
@@ -365,18 +355,15 @@ func InitGame(room *database.Room) (*database.Game, error) {
 
 	distributes, decks := poker.Distribute(room.Players, room.EnableDontShuffle, rules)
 	players := make([]int64, 0)
-	roomPlayers := database.RoomPlayers(room.ID)
-	for playerId := range roomPlayers {
+	for _, playerId := range database.RoomSeats(room.ID) {
 		players = append(players, playerId)
 	}
 	firstOaa := poker.Random(14, 15)
 	lastOaa := poker.Random(14, 15, firstOaa)
-	states := map[int64]chan int{}
 	groups := map[int64]int{}
 	pokers := map[int64]modelx.Pokers{}
 	skills := map[int64]int{}
 	playTimes := map[int64]int{}
-	playTimeout := map[int64]time.Duration{}
 	mnemonic := map[int]int{
 		14: decks,
 		15: decks,
@@ -385,31 +372,33 @@ func InitGame(room *database.Room) (*database.Game, error) {
 		mnemonic[i] = 4 * decks
 	}
 	for i := range players {
-		states[players[i]] = make(chan int, 1)
 		groups[players[i]] = 0
 		pokers[players[i]] = distributes[i]
 		skills[players[i]] = rand.Intn(len(skill.Skills))
 		playTimes[players[i]] = 1
-		playTimeout[players[i]] = consts.PlayTimeout
 	}
-	states[players[rand.Intn(len(states))]] <- stateRob
-	return &database.Game{
-		Room:        room,
-		States:      states,
-		Players:     players,
-		Groups:      groups,
-		Pokers:      pokers,
-		Additional:  distributes[len(distributes)-1],
-		Multiple:    1,
-		Universals:  []int{firstOaa, lastOaa},
-		Mnemonic:    mnemonic,
-		Decks:       decks,
-		Skills:      skills,
-		PlayTimes:   playTimes,
-		PlayTimeOut: playTimeout,
-		Rules:       rules,
-		Discards:    modelx.Pokers{},
-	}, nil
+	database.NewTurnTimer(room, consts.PlayTimeout)
+	game := &database.Game{
+		Room:       room,
+		Players:    players,
+		Groups:     groups,
+		Pokers:     pokers,
+		Additional: distributes[len(distributes)-1],
+		Multiple:   1,
+		Universals: []int{firstOaa, lastOaa},
+		Mnemonic:   mnemonic,
+		Decks:      decks,
+		Skills:     skills,
+		PlayTimes:  playTimes,
+		Rules:      rules,
+		Discards:   modelx.Pokers{},
+	}
+	game.Loop = database.NewGameLoop(room, handleGame(game))
+	game.Loop.Send(players[rand.Intn(len(players))], stateRob)
+	for _, id := range players {
+		sendPokers(database.GetPlayer(id), game)
+	}
+	return game, nil
 }
 
 func resetGame(game *database.Game) error {
@@ -420,15 +409,14 @@ func resetGame(game *database.Game) error {
 	players := game.Players
 	skills := map[int64]int{}
 	playTimes := map[int64]int{}
-	playTimeout := map[int64]time.Duration{}
 	firstOaa := poker.Random(14, 15)
 	lastOaa := poker.Random(14, 15, firstOaa)
 	for i := range players {
 		game.Pokers[players[i]] = distributes[i]
 		skills[players[i]] = rand.Intn(len(skill.Skills))
 		playTimes[players[i]] = 1
-		playTimeout[players[i]] = consts.PlayTimeout
 	}
+	database.NewTurnTimer(game.Room, consts.PlayTimeout)
 	game.Groups = map[int64]int{}
 	game.FirstPlayer = 0
 	game.LastPlayer = 0
@@ -441,7 +429,6 @@ func resetGame(game *database.Game) error {
 	game.Decks = decks
 	game.Skills = skills
 	game.PlayTimes = playTimes
-	game.PlayTimeOut = playTimeout
 	game.Discards = modelx.Pokers{}
 	return nil
 }
@@ -4,8 +4,8 @@ import (
 	"bytes"
 	"fmt"
 	"strings"
+	"time"
 
-	"github.com/ratel-online/core/log"
 	"github.com/ratel-online/core/model"
 	"github.com/ratel-online/core/util/poker"
 	"github.com/ratel-online/core/util/rand"
@@ -16,10 +16,11 @@ import (
 type Liar struct{}
 
 var (
-	liarStatePlay    = 1
-	liarStateGameEnd = 2
+	liarStatePlay = 1
 
-	codes = map[string]bool{
+	supervisorCommands = map[string]bool{
+		"supervise":   true,
+		"观察":          true,
 		"whosyourdad": true,
 		"hesoyam":     true,
 		"idddqd":      true,
@@ -27,55 +28,36 @@ var (
 )
 
 func (g *Liar) Next(player *database.Player) (consts.StateID, error) {
-	// 这里编写游戏的主要循环逻辑
-	// 例如：等待发牌、处理玩家出牌输入、判断胜负等
-	room := database.GetRoom(player.RoomID)
-	if room == nil {
-		return 0, player.WriteError(consts.ErrorsExist)
+	return database.WaitGame(player)
+}
+
+// handle 房间事件循环里处理骗子酒馆的出牌
+func (g *Liar) handle(game *database.Liar) database.GameHandler {
+	return func(player *database.Player, state int) error {
+		if state == liarStatePlay {
+			return g.handlePlay(player, game)
+		}
+		return nil
 	}
-	game := room.Game.(*database.Liar)
-	buf := bytes.Buffer{}
+}
 
+// welcome 开局时向玩家介绍指示牌和每位玩家的状态
+func (g *Liar) welcome(player *database.Player, game *database.Liar) {
+	buf := bytes.Buffer{}
 	buf.WriteString("欢迎来到骗子酒馆!\n")
 	if game.Target != nil {
 		buf.WriteString(fmt.Sprintf("当前指示牌: %s\n", poker.GetDesc(game.Target.Key)))
 	}
 	//获取每位玩家的状态
-	buf.WriteString(g.GetPlayerStatus(room))
-
-	_ = game.Bullets[player.ID]
+	buf.WriteString(g.GetPlayerStatus(game))
 	_ = player.WriteString(buf.String())
-
-	loopCount := 0
-	for {
-		loopCount++
-		if loopCount%100 == 0 {
-			log.Infof("[Game.Next] Player %d (Room %d) loop count: %d, room.State: %d\n", player.ID, player.RoomID, loopCount, room.State)
-		}
-		if room.State == consts.RoomStateWaiting {
-			log.Infof("[Game.Next] Player %d exiting, room state changed to waiting, loop count: %d\n", player.ID, loopCount)
-			return consts.StateWaiting, nil
-		}
-		log.Infof("[Game.Next] Player %d waiting for state, loop count: %d\n", player.ID, loopCount)
-		state := <-game.States[player.ID]
-		switch state {
-		case liarStatePlay:
-			err := g.handlePlay(player, game)
-			if err != nil {
-				log.Error(err)
-				return 0, err
-			}
-		case liarStateGameEnd:
-			return g.handleGameEnd(player, game)
-		}
-	}
 }
 
 func (g *Liar) handlePlay(player *database.Player, game *database.Liar) error {
 	// 如果玩家手牌为空，则跳过出牌
 	if len(game.Hands[player.ID]) == 0 {
 		nextID := g.getNextPlayer(game, player.ID)
-		game.States[nextID] <- liarStatePlay
+		game.Loop.Send(nextID, liarStatePlay)
 		return nil
 	}
 
@@ -101,8 +83,11 @@ func (g *Liar) handlePlay(player *database.Player, game *database.Liar) error {
 	buf.WriteString(fmt.Sprintf("你的手牌: %s\n", game.Hands[player.ID].String()))
 	_ = player.WriteString(buf.String())
 
+	timer := game.Room.Timer()
+	timer.Start(player.ID)
+	defer timer.Stop(player.ID)
 	for {
-		ans, err := player.AskForString(consts.PlayTimeout)
+		ans, err := timer.Ask(player)
 		if err != nil || ans == "" {
 			// 超时或无输入自动出第一张牌
 			ans = poker.GetAlias(game.Hands[player.ID][0].Key)
@@ -115,10 +100,11 @@ func (g *Liar) handlePlay(player *database.Player, game *database.Liar) error {
 			return nil
 		}
 
-		// 处理作弊码
-		if codes[ans] {
-			game.Supervisors[player.ID] = true
-			_ = player.WriteString("[系统提示] 观察者模式已开启。\n")
+		// 处理观察者模式申请
+		if IsLiarSupervisorCommand(ans) {
+			if err := LiarSupervise(player, game); err != nil {
+				_ = player.WriteError(err)
+			}
 			continue
 		}
 
@@ -190,35 +176,28 @@ func (g *Liar) handlePlay(player *database.Player, game *database.Liar) error {
 		game.Hands[player.ID] = tempHand
 		game.LastPlayerID = player.ID
 		game.LastPokers = playedPokers
+		game.SaveHands()
 
 		database.Broadcast(player.RoomID, fmt.Sprintf("%s 出了 %d 张牌, 剩余张数: %d\n", player.Name, len(playedPokers), len(game.Hands[player.ID])))
 
-		// 广播给具有观察权限的玩家以及房主（如果开启了详细日志）
-		for id, isSupervisor := range game.Supervisors {
-			if isSupervisor {
-				p := database.GetPlayer(id)
-				if p != nil {
-					_ = p.WriteString(fmt.Sprintf("[系统提示] %s 出了: %s\n", player.Name, playedPokers.String()))
-				}
-			}
-		}
+		// 广播给具有观察权限的玩家
+		game.NotifySupervisors(fmt.Sprintf("[观察者] %s 出了: %s\n", player.Name, playedPokers.String()))
 
 		// 游戏结束判定
 		if g.getAliveCount(game) == 1 {
-			for _, id := range game.PlayerIDs {
-				game.States[id] <- liarStateGameEnd
-			}
+			g.handleGameEnd(game)
 			return nil
 		}
 
 		// 下一位玩家
 		nextID := g.getNextPlayer(game, player.ID)
-		game.States[nextID] <- liarStatePlay
+		game.Loop.Send(nextID, liarStatePlay)
 		return nil
 	}
 }
 
 func (g *Liar) handleChallenge(challenger *database.Player, game *database.Liar) {
+	game.Room.Timer().Stop(challenger.ID)
 	lastPlayer := database.GetPlayer(game.LastPlayerID)
 	database.Broadcast(game.Room.ID, fmt.Sprintf("%s 质疑了 %s 的出牌！\n", challenger.Name, lastPlayer.Name))
 	database.Broadcast(game.Room.ID, fmt.Sprintf("%s 实际上出了: %s\n", lastPlayer.Name, game.LastPokers.String()))
@@ -249,9 +228,7 @@ func (g *Liar) handleChallenge(challenger *database.Player, game *database.Liar)
 
 	if isDead {
 		if g.getAliveCount(game) == 1 {
-			for _, id := range game.PlayerIDs {
-				game.States[id] <- liarStateGameEnd
-			}
+			g.handleGameEnd(game)
 			return
 		}
 	}
@@ -264,7 +241,7 @@ func (g *Liar) handleChallenge(challenger *database.Player, game *database.Liar)
 	if !game.Alive[nextID] {
 		nextID = g.getNextPlayer(game, nextID)
 	}
-	game.States[nextID] <- liarStatePlay
+	game.Loop.Send(nextID, liarStatePlay)
 }
 
 func (g *Liar) pullTrigger(player *database.Player, game *database.Liar) bool {
@@ -272,10 +249,12 @@ func (g *Liar) pullTrigger(player *database.Player, game *database.Liar) bool {
 	database.Broadcast(game.Room.ID, fmt.Sprintf("%s 满头大汗地拿起了枪，扣动了扳机... (第 %d 次尝试)\n", player.Name, game.Bong[player.ID]))
 	if game.Bong[player.ID] == game.Bullets[player.ID] {
 		game.Alive[player.ID] = false
+		game.Eliminated = append(game.Eliminated, player.ID)
 		database.Broadcast(game.Room.ID, fmt.Sprintf("砰！！！%s 被子弹贯穿，倒在了地上。\n", player.Name))
 		return true
 	}
 	database.Broadcast(game.Room.ID, fmt.Sprintf("咔哒。是空枪。%s 活了下来，长舒了一口气。\n", player.Name))
+	player.RecordSurvival()
 	return false
 }
 
@@ -296,28 +275,23 @@ func (g *Liar) resetRound(game *database.Liar) {
 			}
 		}
 	}
+	game.SaveHands()
 	database.Broadcast(game.Room.ID, "新的一轮开始了！指示牌已更新，存活玩家手牌已重新发放。\n")
 }
 
-func (g *Liar) handleGameEnd(player *database.Player, game *database.Liar) (consts.StateID, error) {
-	room := database.GetRoom(player.RoomID)
-	if room != nil {
-		room.Lock()
-		if room.Game != nil {
-			winnerID := g.getLastSurvivor(game)
-			winnerName := "未知"
-			winner := database.GetPlayer(winnerID)
-			if winner != nil {
-				winnerName = winner.Name
-			}
-			database.Broadcast(player.RoomID, fmt.Sprintf("游戏结束! %s 获得了胜利!\n", winnerName))
-			room.Game = nil
-			room.State = consts.RoomStateWaiting
-		}
-		room.Unlock()
+func (g *Liar) handleGameEnd(game *database.Liar) {
+	room := game.Room
+	winnerID := g.getLastSurvivor(game)
+	winnerName := "未知"
+	winner := database.GetPlayer(winnerID)
+	if winner != nil {
+		winnerName = winner.Name
 	}
-
-	return consts.StateWaiting, nil
+	database.Broadcast(room.ID, fmt.Sprintf("游戏结束! %s 获得了胜利!\n", winnerName))
+	database.BroadcastRatings(room.ID, database.RatePlacement(room.Type, survivalPlacements(winnerID, game.Eliminated)))
+	database.RecordGame(room.Type, game.PlayerIDs, []int64{winnerID})
+	database.EndGame(room, nil)
+	database.OpenRematch(room, game.PlayerIDs, []int64{winnerID})
 }
 
 func (g *Liar) getAliveCount(game *database.Liar) int {
@@ -372,14 +346,49 @@ func (g *Liar) getNextPlayer(game *database.Liar, curr int64) int64 {
 	return game.PlayerIDs[0]
 }
 
+// IsLiarSupervisorCommand 判断输入是否为开启观察者模式的指令
+func IsLiarSupervisorCommand(ans string) bool {
+	return supervisorCommands[strings.TrimSpace(strings.ToLower(ans))]
+}
+
+// LiarSupervise 为玩家开启观察者模式，开启后全房间广播，并推送当前所有玩家的手牌
+// 观众在等待房间里开启，不在事件循环里，手牌取事件循环记下的那份
+func LiarSupervise(player *database.Player, game *database.Liar) error {
+	if game.IsSupervisor(player.ID) {
+		return nil
+	}
+	delay, ok := game.SupervisorDelay(player)
+	if !ok {
+		return consts.ErrorsSupervisorDenied
+	}
+	game.AddSupervisor(player.ID, delay)
+
+	identity := "观众"
+	if player.IsAdmin() {
+		identity = "管理员"
+	} else if game.IsPlayer(player.ID) {
+		identity = "房主"
+	}
+	if delay > 0 {
+		database.Broadcast(game.Room.ID, fmt.Sprintf("[系统提示] %s (%s) 开启了观察者模式，真实牌面将延迟 %d 秒可见。\n", player.Name, identity, int(delay.Seconds())))
+	} else {
+		database.Broadcast(game.Room.ID, fmt.Sprintf("[系统提示] %s (%s) 开启了观察者模式，可以看到所有玩家的真实牌面。\n", player.Name, identity))
+	}
+
+	if delay > 0 {
+		_ = player.WriteString(fmt.Sprintf("[系统提示] 观察者模式已开启，%d 秒后开始推送真实牌面。\n", int(delay.Seconds())))
+	}
+	game.NotifySupervisor(player.ID, game.SavedHands())
+	return nil
+}
+
 func (g *Liar) Exit(player *database.Player) consts.StateID {
 	return consts.StateHome
 }
 
 // 获取房间内所有玩家的状态，显示为玩家名([已开枪次数]/6)
-func (g *Liar) GetPlayerStatus(room *database.Room) string {
+func (g *Liar) GetPlayerStatus(game *database.Liar) string {
 	buf := bytes.Buffer{}
-	game := room.Game.(*database.Liar)
 	for _, id := range game.PlayerIDs {
 		player := database.GetPlayer(id)
 		if player != nil {
@@ -395,16 +404,16 @@ func (g *Liar) GetPlayerStatus(room *database.Room) string {
 
 func InitLiarGame(room *database.Room) (*database.Liar, error) {
 	playerIDs := make([]int64, 0)
-	for id := range database.RoomPlayers(room.ID) {
+	for _, id := range database.RoomSeats(room.ID) {
 		playerIDs = append(playerIDs, id)
 	}
 	bullets := make(map[int64]int)
 	bong := make(map[int64]int)
-	states := make(map[int64]chan int)
 	hands := make(map[int64]model.Pokers)
 	alive := make(map[int64]bool)
-	supervisors := make(map[int64]bool)
+	supervisors := make(map[int64]time.Duration)
 	deck := initLiarDeck()
+	database.NewTurnTimer(room, consts.PlayTimeout)
 
 	// 抽取一张牌作为指示牌，根据房间设置决定是否允许大小王
 	var target *model.Poker
@@ -415,28 +424,33 @@ func InitLiarGame(room *database.Room) (*database.Liar, error) {
 	for i, id := range playerIDs {
 		bullets[id] = rand.Intn(6) + 1
 		bong[id] = 0
-		states[id] = make(chan int, 1)
 		alive[id] = true
 		// 每个人发5张牌
 		hands[id] = deck[i*5 : (i+1)*5]
 	}
 
-	// 随机选择一个玩家开始出牌
-	states[playerIDs[rand.Intn(len(playerIDs))]] <- liarStatePlay
-
-	return &database.Liar{
+	game := &database.Liar{
 		Room:        room,
 		PlayerIDs:   playerIDs,
 		Bullets:     bullets,
 		Bong:        bong,
-		States:      states,
 		Hands:       hands,
 		Pokers:      deck,
 		Target:      target,
 		Alive:       alive,
 		Supervisors: supervisors,
 		AllowJokers: room.EnableJokerAsTarget, // 保存房间设置以供后续轮次使用
-	}, nil
+	}
+	game.SaveHands()
+	liar := &Liar{}
+	for _, id := range playerIDs {
+		liar.welcome(database.GetPlayer(id), game)
+	}
+
+	// 随机选择一个玩家开始出牌
+	game.Loop = database.NewGameLoop(room, liar.handle(game))
+	game.Loop.Send(playerIDs[rand.Intn(len(playerIDs))], liarStatePlay)
+	return game, nil
 }
 
 // 初始化牌堆：八张K，八张Q，八张A，一张大王(S)，一张小王(X)
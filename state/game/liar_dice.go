@@ -0,0 +1,250 @@
+package game
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ratel-online/core/util/rand"
+	"github.com/ratel-online/server/consts"
+	"github.com/ratel-online/server/database"
+)
+
+type LiarDice struct{}
+
+var (
+	diceStatePlay = 1
+)
+
+func (g *LiarDice) Next(player *database.Player) (consts.StateID, error) {
+	return database.WaitGame(player)
+}
+
+// handle 房间事件循环里处理大话骰的叫点
+func (g *LiarDice) handle(game *database.LiarDice) database.GameHandler {
+	return func(player *database.Player, state int) error {
+		if state == diceStatePlay {
+			return g.handlePlay(player, game)
+		}
+		return nil
+	}
+}
+
+// welcome 开局时向玩家介绍规则和自己的骰子
+func (g *LiarDice) welcome(player *database.Player, game *database.LiarDice) {
+	buf := bytes.Buffer{}
+	buf.WriteString("欢迎来到大话骰!\n")
+	buf.WriteString(g.rules(game))
+	buf.WriteString(fmt.Sprintf("你的骰子: %s\n", database.DiceString(game.Dice[player.ID])))
+	_ = player.WriteString(buf.String())
+}
+
+func (g *LiarDice) Exit(player *database.Player) consts.StateID {
+	return consts.StateHome
+}
+
+func (g *LiarDice) rules(game *database.LiarDice) string {
+	buf := bytes.Buffer{}
+	if game.WildOnes {
+		buf.WriteString("规则: 1 点为万能骰\n")
+	}
+	if game.SpotOn {
+		buf.WriteString("规则: 可以开 [劈(so)]，叫点数量恰好正确时找回一颗骰子\n")
+	}
+	return buf.String()
+}
+
+func (g *LiarDice) handlePlay(player *database.Player, game *database.LiarDice) error {
+	if !game.Alive(player.ID) {
+		game.Loop.Send(game.NextAlive(player.ID), diceStatePlay)
+		return nil
+	}
+	hasBid := game.BidQuantity > 0
+	database.Broadcast(player.RoomID, fmt.Sprintf("轮到 %s 叫点\n", player.Name), player.ID)
+	_ = player.WriteString(g.status(player, game))
+
+	timer := game.Room.Timer()
+	timer.Start(player.ID)
+	defer timer.Stop(player.ID)
+	for {
+		ans, err := timer.Ask(player)
+		if err != nil {
+			// 超时自动操作：有叫点时质疑，否则按自己的第一颗骰子叫一个
+			if hasBid {
+				ans = "c"
+			} else {
+				ans = "1 " + strconv.Itoa(game.Dice[player.ID][0])
+			}
+		}
+		ans = strings.TrimSpace(strings.ToLower(ans))
+
+		switch {
+		case ans == "":
+			continue
+		case ans == "ls" || ans == "v":
+			_ = player.WriteString(g.status(player, game))
+			continue
+		case (ans == "c" || ans == "liar" || ans == "质疑") && hasBid:
+			g.handleChallenge(player, game, false)
+			return nil
+		case (ans == "so" || ans == "spot" || ans == "劈") && hasBid && game.SpotOn:
+			g.handleChallenge(player, game, true)
+			return nil
+		}
+
+		segments := strings.Fields(ans)
+		if len(segments) == 2 {
+			quantity, err1 := strconv.Atoi(segments[0])
+			face, err2 := strconv.Atoi(segments[1])
+			if err1 == nil && err2 == nil {
+				if !game.IsHigherBid(quantity, face) {
+					_ = player.WriteError(consts.ErrorsDiceBidInvalid)
+					continue
+				}
+				game.Bid(player.ID, quantity, face)
+				nextID := game.NextAlive(player.ID)
+				database.Broadcast(player.RoomID, fmt.Sprintf("%s 叫了 %d 个 %d, 下一位 %s\n", player.Name, quantity, face, database.GetPlayer(nextID).Name))
+				game.Loop.Send(nextID, diceStatePlay)
+				return nil
+			}
+		}
+		database.BroadcastChat(player, fmt.Sprintf("%s 说: %s\n", player.Name, ans))
+	}
+}
+
+func (g *LiarDice) status(player *database.Player, game *database.LiarDice) string {
+	buf := bytes.Buffer{}
+	buf.WriteString("\n")
+	for _, id := range game.PlayerIDs {
+		if p := database.GetPlayer(id); p != nil {
+			buf.WriteString(fmt.Sprintf("%s: %d 颗骰子\n", p.Name, len(game.Dice[id])))
+		}
+	}
+	buf.WriteString(fmt.Sprintf("场上共 %d 颗骰子\n", game.TotalDice()))
+	if game.BidQuantity > 0 {
+		bidder := database.GetPlayer(game.BidPlayerID)
+		buf.WriteString(fmt.Sprintf("当前叫点: %s 叫了 %d 个 %d\n", bidder.Name, game.BidQuantity, game.BidFace))
+		if game.SpotOn {
+			buf.WriteString("请输入 [数量 点数] 加注，或选择 [质疑(c)] / [劈(so)]\n")
+		} else {
+			buf.WriteString("请输入 [数量 点数] 加注，或选择 [质疑(c)]\n")
+		}
+	} else {
+		buf.WriteString("请输入 [数量 点数] 叫点，例如 2 5 表示至少两个 5\n")
+	}
+	buf.WriteString(fmt.Sprintf("你的骰子: %s\n", database.DiceString(game.Dice[player.ID])))
+	return buf.String()
+}
+
+func (g *LiarDice) handleChallenge(challenger *database.Player, game *database.LiarDice, spotOn bool) {
+	game.Room.Timer().Stop(challenger.ID)
+	bidder := database.GetPlayer(game.BidPlayerID)
+	buf := bytes.Buffer{}
+	if spotOn {
+		buf.WriteString(fmt.Sprintf("%s 认为 %s 叫的 %d 个 %d 恰好正确！开骰！\n", challenger.Name, bidder.Name, game.BidQuantity, game.BidFace))
+	} else {
+		buf.WriteString(fmt.Sprintf("%s 质疑了 %s 叫的 %d 个 %d！开骰！\n", challenger.Name, bidder.Name, game.BidQuantity, game.BidFace))
+	}
+	for _, id := range game.PlayerIDs {
+		if game.Alive(id) {
+			buf.WriteString(fmt.Sprintf("%s: %s\n", database.GetPlayer(id).Name, database.DiceString(game.Dice[id])))
+		}
+	}
+	count := game.Count(game.BidFace)
+	buf.WriteString(fmt.Sprintf("场上共有 %d 个 %d\n", count, game.BidFace))
+
+	// 本轮输家（劈中时为劈的玩家）开始下一轮
+	var loser *database.Player
+	switch {
+	case spotOn && count == game.BidQuantity:
+		game.GainDie(challenger.ID, consts.LiarDiceCount)
+		buf.WriteString(fmt.Sprintf("劈中了！%s 找回一颗骰子。\n", challenger.Name))
+		loser = challenger
+	case spotOn:
+		buf.WriteString(fmt.Sprintf("没有劈中！%s 失去一颗骰子。\n", challenger.Name))
+		loser = challenger
+		game.LoseDie(loser.ID)
+	case count >= game.BidQuantity:
+		buf.WriteString(fmt.Sprintf("叫点成立！%s 质疑失败，失去一颗骰子。\n", challenger.Name))
+		loser = challenger
+		game.LoseDie(loser.ID)
+	default:
+		buf.WriteString(fmt.Sprintf("抓到了！%s 在吹牛，失去一颗骰子。\n", bidder.Name))
+		loser = bidder
+		game.LoseDie(loser.ID)
+	}
+	if !game.Alive(loser.ID) {
+		buf.WriteString(fmt.Sprintf("%s 失去了所有骰子，出局！\n", loser.Name))
+	}
+	database.Broadcast(game.Room.ID, buf.String())
+
+	if game.AliveCount() <= 1 {
+		g.handleGameEnd(game)
+		return
+	}
+
+	// 重新摇骰，由输家（或其下一位存活玩家）开始新一轮
+	game.Roll()
+	for _, id := range game.PlayerIDs {
+		if game.Alive(id) {
+			if p := database.GetPlayer(id); p != nil {
+				_ = p.WriteString(fmt.Sprintf("新的一轮开始了！你的骰子: %s\n", database.DiceString(game.Dice[id])))
+			}
+		}
+	}
+	nextID := loser.ID
+	if !game.Alive(nextID) {
+		nextID = game.NextAlive(nextID)
+	}
+	game.Loop.Send(nextID, diceStatePlay)
+}
+
+func (g *LiarDice) handleGameEnd(game *database.LiarDice) {
+	room := game.Room
+	var winnerID int64
+	winnerName := "未知"
+	for _, id := range game.PlayerIDs {
+		if game.Alive(id) {
+			winnerID = id
+			if winner := database.GetPlayer(id); winner != nil {
+				winnerName = winner.Name
+			}
+		}
+	}
+	database.Broadcast(room.ID, fmt.Sprintf("游戏结束! %s 获得了胜利!\n", winnerName))
+	database.BroadcastRatings(room.ID, database.RatePlacement(room.Type, survivalPlacements(winnerID, game.Eliminated)))
+	database.RecordGame(room.Type, game.PlayerIDs, []int64{winnerID})
+	database.EndGame(room, nil)
+	database.OpenRematch(room, game.PlayerIDs, []int64{winnerID})
+}
+
+func InitLiarDiceGame(room *database.Room) (*database.LiarDice, error) {
+	playerIDs := make([]int64, 0)
+	for _, id := range database.RoomSeats(room.ID) {
+		playerIDs = append(playerIDs, id)
+	}
+	dice := make(map[int64][]int)
+	for _, id := range playerIDs {
+		dice[id] = make([]int, consts.LiarDiceCount)
+	}
+	database.NewTurnTimer(room, consts.PlayTimeout)
+	game := &database.LiarDice{
+		Room:      room,
+		PlayerIDs: playerIDs,
+		Dice:      dice,
+		WildOnes:  room.EnableWildOnes,
+		SpotOn:    room.EnableSpotOn,
+	}
+	game.Roll()
+
+	liarDice := &LiarDice{}
+	for _, id := range playerIDs {
+		liarDice.welcome(database.GetPlayer(id), game)
+	}
+
+	// 随机选择一个玩家开始叫点
+	game.Loop = database.NewGameLoop(room, liarDice.handle(game))
+	game.Loop.Send(playerIDs[rand.Intn(len(playerIDs))], diceStatePlay)
+	return game, nil
+}
@@ -10,8 +10,8 @@ import (
 	mjgame "github.com/feel-easy/mahjong/game"
 	"github.com/feel-easy/mahjong/tile"
 	"github.com/feel-easy/mahjong/util"
-	"github.com/feel-easy/mahjong/win"
 	"github.com/ratel-online/core/log"
+	"github.com/ratel-online/core/util/async"
 	"github.com/ratel-online/core/util/rand"
 	"github.com/ratel-online/server/consts"
 	"github.com/ratel-online/server/database"
@@ -20,45 +20,48 @@ import (
 type Mahjong struct{}
 
 func (g *Mahjong) Next(player *database.Player) (consts.StateID, error) {
-	room := database.GetRoom(player.RoomID)
-	if room == nil {
-		return 0, player.WriteError(consts.ErrorsExist)
+	return database.WaitGame(player)
+}
+
+// handleMahjong 房间事件循环里处理麻将的定缺、摸牌和出牌，电脑玩家也由事件循环代为行动
+func handleMahjong(room *database.Room, game *database.Mahjong) database.GameHandler {
+	return func(player *database.Player, state int) error {
+		switch state {
+		case stateDingQue:
+			askMissingSuits(room, game)
+		case statePlay:
+			return handlePlayMahjong(room, player, game)
+		case stateTakeCard:
+			return handleTake(room, player, game)
+		}
+		return nil
 	}
-	game := room.Game.(*database.Mahjong)
+}
+
+// welcomeMahjong 开局时告诉玩家庄家和自己的手牌
+func welcomeMahjong(room *database.Room, player *database.Player, game *database.Mahjong) {
 	buf := bytes.Buffer{}
 	buf.WriteString("WELCOME TO MAHJONG GAME!!! \n")
+	if game.Sichuan {
+		buf.WriteString("Sichuan blood battle (血战到底): no honors, no 吃, play on until three players win. \n")
+	}
 	buf.WriteString(fmt.Sprintf("%s is Banker! \n", database.GetPlayer(int64(room.Banker)).Name))
 	buf.WriteString(fmt.Sprintf("Your Tiles: %s\n", game.Game.GetPlayerTiles(int(player.ID))))
 	_ = player.WriteString(buf.String())
-	loopCount := 0
-	for {
-		loopCount++
-		if loopCount%100 == 0 {
-			log.Infof("[Mahjong.Next] Player %d (Room %d) loop count: %d, room.State: %d\n", player.ID, player.RoomID, loopCount, room.State)
-		}
-		if room.State == int(consts.StateWaiting) {
-			log.Infof("[Mahjong.Next] Player %d exiting, room state changed to waiting, loop count: %d\n", player.ID, loopCount)
-			return consts.StateWaiting, nil
-		}
-		log.Infof("[Mahjong.Next] Player %d waiting for state, loop count: %d\n", player.ID, loopCount)
-		state := <-game.States[int(player.ID)]
-		switch state {
-		case statePlay:
-			err := handlePlayMahjong(room, player, game)
-			if err != nil {
-				return 0, err
-			}
-		case stateTakeCard:
-			err := handleTake(room, player, game)
-			if err != nil {
-				return 0, err
-			}
-		case stateWaiting:
-			return consts.StateWaiting, nil
-		default:
-			return 0, consts.ErrorsChanClosed
-		}
+}
+
+// askMissingSuits 血战麻将所有玩家同时定缺，都定完后庄家开始摸牌
+func askMissingSuits(room *database.Room, game *database.Mahjong) {
+	for _, id := range game.PlayerIDs {
+		player := database.GetPlayer(int64(id))
+		async.Async(func() {
+			defer game.DingQue.Done()
+			suit := game.Players[id].AskMissingSuit(game.Game.Players().GetPlayerController(id).Hand())
+			database.Broadcast(room.ID, fmt.Sprintf("%s 定缺 %s\n", player.Name, database.SuitName(suit)))
+		})
 	}
+	game.DingQue.Wait()
+	game.Loop.Send(int64(game.Game.Current().ID()), stateTakeCard)
 }
 
 func (g *Mahjong) Exit(player *database.Player) consts.StateID {
@@ -70,40 +73,51 @@ func (g *Mahjong) Exit(player *database.Player) consts.StateID {
 	if game == nil {
 		return consts.StateHome
 	}
-	for _, playerId := range game.PlayerIDs {
-		game.States[playerId] <- stateWaiting
-	}
+	database.EndGame(room, nil)
 	database.Broadcast(player.RoomID, fmt.Sprintf("player %s exit, game over! \n", player.Name))
 	database.LeaveRoom(player.RoomID, player.ID)
-	room.Game = nil
-	room.State = consts.RoomStateWaiting
 	return consts.StateHome
 }
 
 func handleTake(room *database.Room, player *database.Player, game *database.Mahjong) error {
 	p := game.Game.Current()
 	if p.ID() != int(player.ID) {
-		game.States[p.ID()] <- stateTakeCard
+		game.Loop.Send(int64(p.ID()), stateTakeCard)
 		return nil
 	}
-	if game.Game.Deck().NoTiles() {
-		database.Broadcast(room.ID, "Game over but no winners!!! \n")
-		room.Game = nil
-		room.State = consts.RoomStateWaiting
-		for _, playerId := range game.PlayerIDs {
-			game.States[playerId] <- stateWaiting
+	if game.NoTiles() {
+		if len(game.Winners) > 0 {
+			database.Broadcast(room.ID, "No tiles left, game over!!! \n")
+		} else {
+			database.Broadcast(room.ID, "Game over but no winners!!! \n")
 		}
+		endMahjong(room, game)
 		return nil
 	}
 
 	gameState := game.Game.ExtractState(p)
+	game.FilterState(&gameState)
 	if len(gameState.SpecialPrivileges) > 0 {
-		_, ok, err := p.Take(gameState, game.Game.Deck(), game.Game.Pile())
+		var (
+			op  int
+			ok  bool
+			err error
+		)
+		if game.Sichuan {
+			op, ok, err = game.TakeSichuan(gameState)
+		} else {
+			op, ok, err = p.Take(gameState, game.Game.Deck(), game.Game.Pile())
+		}
 		if err != nil {
 			return err
 		}
 		if ok {
-			game.States[p.ID()] <- statePlay
+			game.ClaimedFrom = gameState.LastPlayer.ID()
+			// 杠完从牌尾补一张
+			if op == mjconsts.GANG && !game.NoTiles() {
+				drawMahjongTile(game, p, true)
+			}
+			game.Loop.Send(int64(p.ID()), statePlay)
 			return nil
 		}
 		loopCount := 0
@@ -114,34 +128,107 @@ func handleTake(room *database.Room, player *database.Player, game *database.Mah
 			}
 			if gameState.OriginallyPlayer.ID() == p.ID() {
 				log.Infof("[handleTake] Player %d found originally player, loop count: %d\n", p.ID(), loopCount)
-				p.TryTopDecking(game.Game.Deck())
-				game.States[p.ID()] <- statePlay
+				drawMahjongTile(game, p, false)
+				game.Loop.Send(int64(p.ID()), statePlay)
 				return nil
 			}
 			p = game.Game.Next()
 		}
 	}
-	p.TryTopDecking(game.Game.Deck())
-	game.States[p.ID()] <- statePlay
+	drawMahjongTile(game, p, false)
+	game.Loop.Send(int64(p.ID()), statePlay)
 	return nil
 }
 
+// mahjongDrawer 库里的 playerController 未导出，通过接口摸牌
+type mahjongDrawer interface {
+	AddTiles(tiles []int)
+	TryTopDecking(deck *mjgame.Deck)
+	TryBottomDecking(deck *mjgame.Deck)
+}
+
+func drawMahjongTile(game *database.Mahjong, p mahjongDrawer, bottom bool) {
+	game.ClaimedFrom = 0
+	switch {
+	case game.Sichuan:
+		p.AddTiles(game.DrawTiles(1))
+	case bottom:
+		p.TryBottomDecking(game.Game.Deck())
+	default:
+		p.TryTopDecking(game.Game.Deck())
+	}
+}
+
+// endMahjong 结束本局，由第一个胡牌的玩家坐庄，房间设置了轮庄时再来一局由下一位坐庄
+func endMahjong(room *database.Room, game *database.Mahjong) {
+	if len(game.Winners) > 0 {
+		if room.RematchSeats != database.RematchBanker {
+			room.Banker = game.Winners[0]
+		}
+		placements := make([][]int64, 0, len(game.Winners)+1)
+		rest := make([]int64, 0)
+		for _, id := range game.Winners {
+			placements = append(placements, []int64{int64(id)})
+		}
+		for _, id := range game.PlayerIDs {
+			if !game.HasWon(id) {
+				rest = append(rest, int64(id))
+			}
+		}
+		database.BroadcastRatings(room.ID, database.RatePlacement(room.Type, append(placements, rest)))
+	}
+	players, winners := make([]int64, 0, len(game.PlayerIDs)), make([]int64, 0, len(game.Winners))
+	for _, id := range game.PlayerIDs {
+		players = append(players, int64(id))
+	}
+	for _, id := range game.Winners {
+		winners = append(winners, int64(id))
+	}
+	database.RecordGame(room.Type, players, winners)
+	database.EndGame(room, nil)
+	database.OpenRematch(room, players, winners)
+}
+
+// continueSichuan 血战麻将有人胡牌后，由当前或之后第一位未胡牌的玩家摸牌继续
+func continueSichuan(room *database.Room, game *database.Mahjong) {
+	if game.GameOver() || game.NoTiles() {
+		database.Broadcast(room.ID, "Blood battle is over!!! \n")
+		endMahjong(room, game)
+		return
+	}
+	pc := game.Game.Current()
+	for game.HasWon(pc.ID()) {
+		pc = game.Game.Next()
+	}
+	drawMahjongTile(game, pc, false)
+	game.Loop.Send(int64(pc.ID()), statePlay)
+}
+
 func handlePlayMahjong(room *database.Room, player *database.Player, game *database.Mahjong) error {
 	p := game.Game.Current()
 	if p.ID() != int(player.ID) {
-		game.States[p.ID()] <- statePlay
+		game.Loop.Send(int64(p.ID()), statePlay)
 		return nil
 	}
 	gameState := game.Game.ExtractState(p)
-	if win.CanWin(p.Hand(), p.GetShowCardTiles()) {
+	if game.CanWin(p.ID(), p.Hand(), p.GetShowCardTiles()) {
 		tiles := p.Tiles()
 		sort.Ints(tiles)
-		database.Broadcast(room.ID, fmt.Sprintf("%s wins! \n%s \n", p.Name(), tile.ToTileString(tiles)))
-		room.Game = nil
-		room.Banker = p.ID()
-		room.State = consts.RoomStateWaiting
-		for _, playerId := range game.PlayerIDs {
-			game.States[playerId] <- stateWaiting
+		// 吃碰别人打出的牌后胡牌算点炮，由打出的玩家支付
+		score := game.Score(p.Hand(), p.GetShowCard(), game.ClaimedFrom == 0)
+		others := make([]int64, 0, len(game.PlayerIDs)-1)
+		for _, id := range game.PlayerIDs {
+			if id != p.ID() && !game.HasWon(id) {
+				others = append(others, int64(id))
+			}
+		}
+		paid := database.SettleMahjong(int64(p.ID()), int64(game.ClaimedFrom), others, score.Points)
+		database.Broadcast(room.ID, fmt.Sprintf("%s wins! \n%s \n%s%s", p.Name(), tile.ToTileString(tiles), score, sprintMahjongPaid(p.Name(), paid)))
+		game.Winners = append(game.Winners, p.ID())
+		if game.Sichuan {
+			continueSichuan(room, game)
+		} else {
+			endMahjong(room, game)
 		}
 		return nil
 	}
@@ -150,6 +237,7 @@ func handlePlayMahjong(room *database.Room, player *database.Player, game *datab
 	if err != nil {
 		return err
 	}
+	game.ClaimedFrom = 0
 	game.Game.Pile().Add(til)
 	game.Game.Pile().SetLastPlayer(p)
 	event.TilePlayed.Emit(event.TilePlayedPayload{
@@ -157,19 +245,26 @@ func handlePlayMahjong(room *database.Room, player *database.Player, game *datab
 		Tile:       til,
 	})
 	pc := game.Game.Next()
+	for game.HasWon(pc.ID()) {
+		pc = game.Game.Next()
+	}
 	game.Game.Pile().SetOriginallyPlayer(pc)
 	gameState = game.Game.ExtractState(p)
+	game.FilterState(&gameState)
 	if len(gameState.CanWin) > 0 {
-		for _, p := range gameState.CanWin {
-			tiles := append(p.Tiles(), gameState.LastPlayedTile)
+		// 点炮的玩家向每位胡牌玩家支付
+		for _, winner := range gameState.CanWin {
+			tiles := append(winner.Tiles(), gameState.LastPlayedTile)
 			sort.Ints(tiles)
-			database.Broadcast(room.ID, fmt.Sprintf("%s wins! \n%s \n", p.Name(), tile.ToTileString(tiles)))
+			score := game.Score(append(winner.Hand(), gameState.LastPlayedTile), winner.GetShowCard(), false)
+			paid := database.SettleMahjong(int64(winner.ID()), int64(p.ID()), nil, score.Points)
+			database.Broadcast(room.ID, fmt.Sprintf("%s wins! \n%s \n%s%s", winner.Name(), tile.ToTileString(tiles), score, sprintMahjongPaid(winner.Name(), paid)))
+			game.Winners = append(game.Winners, winner.ID())
 		}
-		room.Game = nil
-		room.Banker = gameState.CanWin[rand.Intn(len(gameState.CanWin))].ID()
-		room.State = consts.RoomStateWaiting
-		for _, playerId := range game.PlayerIDs {
-			game.States[playerId] <- stateWaiting
+		if game.Sichuan {
+			continueSichuan(room, game)
+		} else {
+			endMahjong(room, game)
 		}
 		return nil
 	}
@@ -196,29 +291,62 @@ func handlePlayMahjong(room *database.Room, player *database.Player, game *datab
 			}
 			if pc.ID() == pvID {
 				log.Infof("[handlePlayMahjong] Player %d found privilege player, loop count: %d\n", pc.ID(), loopCount)
-				game.States[pc.ID()] <- stateTakeCard
+				game.Loop.Send(int64(pc.ID()), stateTakeCard)
 				return nil
 			}
 			pc = game.Game.Next()
 		}
 	}
-	game.States[pc.ID()] <- stateTakeCard
+	game.Loop.Send(int64(pc.ID()), stateTakeCard)
 	return nil
 }
 
+func sprintMahjongPaid(winnerName string, paid map[int64]uint) string {
+	buf := bytes.Buffer{}
+	for id, amount := range paid {
+		if payer := database.GetPlayer(id); payer != nil {
+			buf.WriteString(fmt.Sprintf("%s pays %s %d\n", payer.Name, winnerName, amount))
+		}
+	}
+	return buf.String()
+}
+
 func InitMahjongGame(room *database.Room) (*database.Mahjong, error) {
+	database.NewTurnTimer(room, consts.PlayMahjongTimeout)
 	playerIDs := make([]int, 0, room.Players)
 	mjPlayers := make([]mjgame.Player, 0, room.Players)
-	states := map[int]chan int{}
-	roomPlayers := database.RoomPlayers(room.ID)
-	for playerId := range roomPlayers {
+	players := map[int]*database.MahjongPlayer{}
+	for _, playerId := range database.RoomSeats(room.ID) {
 		player := database.GetPlayer(playerId)
-		mjPlayers = append(mjPlayers, database.NewPlayer(player))
+		if player.IsAI() {
+			ai := database.NewMahjongAI(player)
+			mjPlayers = append(mjPlayers, ai)
+			players[int(player.ID)] = ai.MahjongPlayer
+		} else {
+			mjPlayer := database.NewPlayer(player)
+			mjPlayers = append(mjPlayers, mjPlayer)
+			players[int(player.ID)] = mjPlayer
+		}
 		playerIDs = append(playerIDs, int(player.ID))
-		states[int(playerId)] = make(chan int, 1)
 	}
 	mahjong := mjgame.New(mjPlayers)
-	mahjong.DealStartingTiles()
+	game := &database.Mahjong{
+		Room:      room,
+		PlayerIDs: playerIDs,
+		Game:      mahjong,
+		Players:   players,
+		Sichuan:   room.EnableSichuan,
+	}
+	if game.Sichuan {
+		// 血战麻将不使用库里带字牌的牌墙
+		game.Wall = database.NewSichuanWall()
+		for _, id := range playerIDs {
+			mahjong.Players().GetPlayerController(id).AddTiles(game.DrawTiles(13))
+		}
+		game.DingQue.Add(len(playerIDs))
+	} else {
+		mahjong.DealStartingTiles()
+	}
 	if room.Banker == 0 || !util.IntInSlice(room.Banker, playerIDs) {
 		room.Banker = playerIDs[rand.Intn(len(playerIDs))]
 	}
@@ -234,11 +362,15 @@ func InitMahjongGame(room *database.Room) (*database.Mahjong, error) {
 		}
 		mahjong.Next()
 	}
-	states[mahjong.Current().ID()] <- stateTakeCard
-	return &database.Mahjong{
-		Room:      room,
-		PlayerIDs: playerIDs,
-		States:    states,
-		Game:      mahjong,
-	}, nil
+	for _, id := range playerIDs {
+		welcomeMahjong(room, database.GetPlayer(int64(id)), game)
+	}
+	game.Loop = database.NewGameLoop(room, handleMahjong(room, game))
+	if game.Sichuan {
+		// 所有玩家定缺后才开始摸牌
+		game.Loop.Send(int64(mahjong.Current().ID()), stateDingQue)
+	} else {
+		game.Loop.Send(int64(mahjong.Current().ID()), stateTakeCard)
+	}
+	return game, nil
 }
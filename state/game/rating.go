@@ -0,0 +1,13 @@
+package game
+
+// survivalPlacements 最后的幸存者第一，其余玩家越晚淘汰名次越高
+func survivalPlacements(survivor int64, eliminated []int64) [][]int64 {
+	placements := make([][]int64, 0, len(eliminated)+1)
+	if survivor != 0 {
+		placements = append(placements, []int64{survivor})
+	}
+	for i := len(eliminated) - 1; i >= 0; i-- {
+		placements = append(placements, []int64{eliminated[i]})
+	}
+	return placements
+}
@@ -5,10 +5,10 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/ratel-online/core/util/rand"
 
+	constx "github.com/ratel-online/core/consts"
 	"github.com/ratel-online/core/log"
 	modelx "github.com/ratel-online/core/model"
 	"github.com/ratel-online/core/util/poker"
@@ -21,49 +21,22 @@ import (
 type RunFastGame struct{}
 
 func (g *RunFastGame) Next(player *database.Player) (consts.StateID, error) {
-	room := database.GetRoom(player.RoomID)
-	if room == nil {
-		return 0, player.WriteError(consts.ErrorsExist)
-	}
-	game := room.Game.(*database.Game)
-	buf := bytes.Buffer{}
-	buf.WriteString(fmt.Sprintf("Game starting!\n"))
-	buf.WriteString(fmt.Sprintf("Your pokers: %s\n", game.Pokers[player.ID].String()))
-	_ = player.WriteString(buf.String())
-	loopCount := 0
-	for {
-		loopCount++
-		if loopCount%100 == 0 {
-			log.Infof("[RunFastGame.Next] Player %d (Room %d) loop count: %d, room.State: %d\n", player.ID, player.RoomID, loopCount, room.State)
-		}
-		if room.State == consts.RoomStateWaiting {
-			log.Infof("[RunFastGame.Next] Player %d exiting, room state changed to waiting, loop count: %d\n", player.ID, loopCount)
-			return consts.StateWaiting, nil
-		}
-		log.Infof("[RunFastGame.Next] Player %d waiting for state, loop count: %d\n", player.ID, loopCount)
-		state := <-game.States[player.ID]
+	return database.WaitGame(player)
+}
+
+// handleRunFast 房间事件循环里处理跑得快的出牌
+func handleRunFast(game *database.Game) database.GameHandler {
+	return func(player *database.Player, state int) error {
 		switch state {
 		case stateRob:
 			for i, id := range game.Players {
 				game.Groups[id] = i
 			}
-			game.States[player.ID] <- statePlay
-		case stateReset:
-			if player.ID == room.Creator {
-				game.States[game.Players[rand.Intn(len(game.States))]] <- stateRob
-			}
-			return 0, nil
+			game.Loop.Send(player.ID, statePlay)
 		case statePlay:
-			err := runFastHandlePlay(player, game)
-			if err != nil {
-				log.Error(err)
-				return 0, err
-			}
-		case stateWaiting:
-			return consts.StateWaiting, nil
-		default:
-			return 0, consts.ErrorsChanClosed
+			return runFastHandlePlay(player, game)
 		}
+		return nil
 	}
 }
 
@@ -72,21 +45,22 @@ func (g *RunFastGame) Exit(player *database.Player) consts.StateID {
 }
 
 func runFastPlaying(player *database.Player, game *database.Game, master bool, playTimes int) error {
-	timeout := game.PlayTimeOut[player.ID]
+	timer := game.Room.Timer()
+	timer.Start(player.ID)
+	defer timer.Stop(player.ID)
 	loopCount := 0
 	for {
 		loopCount++
 		if loopCount%100 == 0 {
-			log.Infof("[runFastPlaying] Player %d (Room %d) loop count: %d, master: %v, playTimes: %d, timeout: %v\n", player.ID, player.RoomID, loopCount, master, playTimes, timeout)
+			log.Infof("[runFastPlaying] Player %d (Room %d) loop count: %d, master: %v, playTimes: %d, timeout: %v\n", player.ID, player.RoomID, loopCount, master, playTimes, timer.Remaining())
 		}
 		buf := bytes.Buffer{}
 		buf.WriteString("\n")
 		if !master && len(game.LastPokers) > 0 {
 			buf.WriteString(fmt.Sprintf("Last player: %s (%s), played: %s\n", database.GetPlayer(game.LastPlayer).Name, game.Team(game.LastPlayer), game.LastPokers.String()))
 		}
-		buf.WriteString(fmt.Sprintf("Timeout: %ds, pokers: %s\n", int(timeout.Seconds()), game.Pokers[player.ID].String()))
+		buf.WriteString(fmt.Sprintf("Timeout: %ds, time bank: %ds, pokers: %s\n", int(timer.Remaining().Seconds()), int(timer.Bank(player.ID).Seconds()), game.Pokers[player.ID].String()))
 		_ = player.WriteString(buf.String())
-		before := time.Now().Unix()
 		pokers := game.Pokers[player.ID]
 		//auto pass
 		if !master {
@@ -94,11 +68,11 @@ func runFastPlaying(player *database.Player, game *database.Game, master bool, p
 			if len(list) == 0 {
 				nextPlayer := database.GetPlayer(game.NextPlayer(player.ID))
 				database.Broadcast(player.RoomID, fmt.Sprintf("%s auto passed, next %s\n", player.Name, nextPlayer.Name))
-				game.States[nextPlayer.ID] <- statePlay
+				game.Loop.Send(nextPlayer.ID, statePlay)
 				return nil
 			}
 		}
-		ans, err := player.AskForString(timeout)
+		ans, err := timer.Ask(player)
 		if err != nil {
 			if master {
 				ans = poker.GetAlias(pokers[0].Key)
@@ -116,8 +90,6 @@ func runFastPlaying(player *database.Player, game *database.Game, master bool, p
 					}
 				}
 			}
-		} else {
-			timeout -= time.Second * time.Duration(time.Now().Unix()-before)
 		}
 
 		ans = strings.ToLower(ans)
@@ -140,7 +112,7 @@ func runFastPlaying(player *database.Player, game *database.Game, master bool, p
 				} else {
 					nextPlayer := database.GetPlayer(game.NextPlayer(player.ID))
 					database.Broadcast(player.RoomID, fmt.Sprintf("%s passed, next %s\n", player.Name, nextPlayer.Name))
-					game.States[nextPlayer.ID] <- statePlay
+					game.Loop.Send(nextPlayer.ID, statePlay)
 					return nil
 				}
 			}
@@ -234,18 +206,21 @@ func runFastPlaying(player *database.Player, game *database.Game, master bool, p
 		game.Pokers[player.ID] = pokers
 		game.LastPlayer = player.ID
 		game.LastFaces = lastFaces
+		if lastFaces.Type == constx.FacesBomb {
+			player.RecordBomb()
+		}
 		game.LastPokers = sells
 		game.Discards = append(game.Discards, sells...)
 		if len(pokers) == 0 {
 			database.Broadcast(player.RoomID, fmt.Sprintf("%s played %s, won the game! \n", player.Name, sells.OaaString()))
-			room := database.GetRoom(player.RoomID)
-			if room != nil {
-				room.Game = nil
-				room.State = consts.RoomStateWaiting
-			}
-			for _, playerId := range game.Players {
-				game.States[playerId] <- stateWaiting
+			results := map[int64]int{}
+			for _, id := range game.Players {
+				results[id] = -len(game.Pokers[id])
 			}
+			database.BroadcastRatings(player.RoomID, database.RateResult(game.Room.Type, results))
+			database.RecordGame(game.Room.Type, game.Players, []int64{player.ID})
+			database.EndGame(game.Room, nil)
+			database.OpenRematch(game.Room, game.Players, []int64{player.ID})
 			return nil
 		}
 		if master {
@@ -257,7 +232,7 @@ func runFastPlaying(player *database.Player, game *database.Game, master bool, p
 		}
 		nextPlayer := database.GetPlayer(game.NextPlayer(player.ID))
 		database.Broadcast(player.RoomID, fmt.Sprintf("%s played %s, next %s\n", player.Name, sells.OaaString(), nextPlayer.Name))
-		game.States[nextPlayer.ID] <- statePlay
+		game.Loop.Send(nextPlayer.ID, statePlay)
 		return nil
 	}
 }
@@ -271,16 +246,13 @@ func runFastHandlePlay(player *database.Player, game *database.Game) error {
 func InitRunFastGame(room *database.Room, rules poker.Rules) (*database.Game, error) {
 	distributes := poker.RunFastDistribute(room.EnableDontShuffle, rules)
 	players := make([]int64, 0)
-	roomPlayers := database.RoomPlayers(room.ID)
-	for playerId := range roomPlayers {
+	for _, playerId := range database.RoomSeats(room.ID) {
 		players = append(players, playerId)
 	}
-	states := map[int64]chan int{}
 	groups := map[int64]int{}
 	pokers := map[int64]modelx.Pokers{}
 	skills := map[int64]int{}
 	playTimes := map[int64]int{}
-	playTimeout := map[int64]time.Duration{}
 	mnemonic := map[int]int{}
 	for i := 1; i <= 13; i++ {
 		if i == 1 {
@@ -292,13 +264,12 @@ func InitRunFastGame(room *database.Room, rules poker.Rules) (*database.Game, er
 		}
 	}
 	for i := range players {
-		states[players[i]] = make(chan int, 1)
 		groups[players[i]] = 0
 		pokers[players[i]] = distributes[i]
 		skills[players[i]] = rand.Intn(len(skill.Skills))
 		playTimes[players[i]] = 1
-		playTimeout[players[i]] = consts.PlayTimeout
 	}
+	database.NewTurnTimer(room, consts.PlayTimeout)
 	FirstPlayerIds := make([]int64, 0)
 	// 跑得快誰先出
 	for k, v := range pokers {
@@ -314,11 +285,9 @@ func InitRunFastGame(room *database.Room, rules poker.Rules) (*database.Game, er
 	} else {
 		FirstPlayerId = FirstPlayerIds[rand.Intn(len(FirstPlayerIds)-1)]
 	}
-	states[players[rand.Intn(len(states))]] <- stateRob
-	return &database.Game{
+	game := &database.Game{
 		FirstPlayer: FirstPlayerId,
 		Room:        room,
-		States:      states,
 		Players:     players,
 		Groups:      groups,
 		Pokers:      pokers,
@@ -329,10 +298,16 @@ func InitRunFastGame(room *database.Room, rules poker.Rules) (*database.Game, er
 		Decks:       1,
 		Skills:      skills,
 		PlayTimes:   playTimes,
-		PlayTimeOut: playTimeout,
 		Rules:       rules,
 		Discards:    modelx.Pokers{},
-	}, nil
+	}
+	game.Loop = database.NewGameLoop(room, handleRunFast(game))
+	game.Loop.Send(players[rand.Intn(len(players))], stateRob)
+	for _, id := range players {
+		p := database.GetPlayer(id)
+		_ = p.WriteString(fmt.Sprintf("Game starting!\nYour pokers: %s\n", game.Pokers[id].String()))
+	}
+	return game, nil
 }
 
 func runFastViewGame(game *database.Game, currPlayer *database.Player) {
@@ -4,10 +4,8 @@ import (
 	"bytes"
 	"fmt"
 	"strings"
-	"time"
 
 	"github.com/ratel-online/core/log"
-	"github.com/ratel-online/server/consts"
 	"github.com/ratel-online/server/database"
 	"github.com/spf13/cast"
 )
@@ -24,14 +22,15 @@ func bet(player *database.Player, game *database.Texas) error {
 
 	database.Broadcast(player.RoomID, fmt.Sprintf("%s's turn to bet\n", player.Name), player.ID)
 
-	timeout := consts.BetTimeout
+	timer := game.Room.Timer()
+	timer.Start(player.ID)
+	defer timer.Stop(player.ID)
 	loopCount := 0
 	for {
 		loopCount++
 		if loopCount%100 == 0 {
-			log.Infof("[bet] Player %d (Room %d) loop count: %d, timeout: %v\n", player.ID, player.RoomID, loopCount, timeout)
+			log.Infof("[bet] Player %d (Room %d) loop count: %d, timeout: %v\n", player.ID, player.RoomID, loopCount, timer.Remaining())
 		}
-		before := time.Now().Unix()
 
 		buf := bytes.Buffer{}
 		buf.WriteString(fmt.Sprintf("Your hand: %s\n", texasPlayer.Hand.TexasString()))
@@ -49,13 +48,12 @@ func bet(player *database.Player, game *database.Texas) error {
 			}
 			buf.WriteString(fmt.Sprintf("%s amount %d, total bets %d, status: %s\n", name, p.Amount(), p.Bets, status))
 		}
-		buf.WriteString("What do you want to do? (call/raise/fold/check/allin)\n")
+		buf.WriteString(fmt.Sprintf("What do you want to do? (call/raise/fold/check/allin), %ds left, time bank: %ds\n", int(timer.Remaining().Seconds()), int(timer.Bank(player.ID).Seconds())))
 		_ = player.WriteString(buf.String())
-		ans, err := player.AskForString(timeout)
+		ans, err := timer.Ask(player)
 		if err != nil {
 			ans = "fold"
 		}
-		timeout -= time.Second * time.Duration(time.Now().Unix()-before)
 		minCall := game.MaxBetAmount - texasPlayer.Bets
 
 		instructions := strings.Split(ans, " ")
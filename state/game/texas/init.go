@@ -2,10 +2,12 @@ package texas
 
 import (
 	"github.com/ratel-online/core/util/poker"
+	"github.com/ratel-online/server/consts"
 	"github.com/ratel-online/server/database"
 )
 
 func Init(room *database.Room) (game database.RoomGame, err error) {
+	database.NewTurnTimer(room, consts.BetTimeout)
 	if room.Game != nil {
 		return resetGame(room)
 	}
@@ -17,15 +19,13 @@ func createGame(room *database.Room) (database.RoomGame, error) {
 	base.Shuffle(len(base), 1)
 
 	index := 0
-	roomPlayers := database.RoomPlayers(room.ID)
 	players := make([]*database.TexasPlayer, 0)
-	for playerId := range roomPlayers {
+	for _, playerId := range database.RoomSeats(room.ID) {
 		player := database.GetPlayer(playerId)
 		players = append(players, &database.TexasPlayer{
-			ID:    playerId,
-			Name:  player.Name,
-			State: make(chan int, 1),
-			Hand:  base[index*2 : (index+1)*2],
+			ID:   playerId,
+			Name: player.Name,
+			Hand: base[index*2 : (index+1)*2],
 		})
 		index++
 	}
@@ -39,6 +39,7 @@ func createGame(room *database.Room) (database.RoomGame, error) {
 		MaxBetAmount: 20,
 		Round:        "start",
 	}
+	game.Loop = database.NewGameLoop(room, handle(game))
 	return game, nextRound(game)
 }
 
@@ -53,9 +54,8 @@ func resetGame(room *database.Room) (database.RoomGame, error) {
 	}
 
 	index := 0
-	roomPlayers := database.RoomPlayers(room.ID)
 	players := make([]*database.TexasPlayer, 0)
-	for playerId := range roomPlayers {
+	for _, playerId := range database.RoomSeats(room.ID) {
 		if texasPlayer, ok := texasPlayers[playerId]; ok {
 			texasPlayer.Reset()
 			texasPlayer.Hand = base[index*2 : (index+1)*2]
@@ -63,10 +63,9 @@ func resetGame(room *database.Room) (database.RoomGame, error) {
 		} else {
 			player := database.GetPlayer(playerId)
 			players = append(players, &database.TexasPlayer{
-				ID:    playerId,
-				Name:  player.Name,
-				State: make(chan int, 1),
-				Hand:  base[index*2 : (index+1)*2],
+				ID:   playerId,
+				Name: player.Name,
+				Hand: base[index*2 : (index+1)*2],
 			})
 		}
 		index++
@@ -81,13 +80,14 @@ func resetGame(room *database.Room) (database.RoomGame, error) {
 		MaxBetAmount: 20,
 		Round:        "start",
 	}
+	newGame.Loop = database.NewGameLoop(room, handle(newGame))
 	return newGame, nextRound(newGame)
 }
 
 func nextPlayer(current *database.Player, game *database.Texas, state int) error {
 	next := game.NextPlayer(current.ID)
 	if next != nil {
-		next.State <- state
+		game.Loop.Send(next.ID, state)
 	}
 	return nil
 }
@@ -64,7 +64,7 @@ func preFlopRound(game *database.Texas) error {
 		}
 		_ = player.WriteString(buf.String())
 	}
-	game.SBPlayer().State <- stateBet
+	game.Loop.Send(game.SBPlayer().ID, stateBet)
 	return nil
 }
 
@@ -74,7 +74,7 @@ func flopRound(game *database.Texas) error {
 	game.Board = append(game.Board, game.Pool[1:4]...)
 	game.Pool = game.Pool[4:]
 	database.Broadcast(game.Room.ID, fmt.Sprintf("Flop round, board: %s\n", game.Board.TexasString()))
-	game.SBPlayer().State <- stateBet
+	game.Loop.Send(game.SBPlayer().ID, stateBet)
 	return nil
 }
 
@@ -84,7 +84,7 @@ func turnRound(game *database.Texas) error {
 	game.Board = append(game.Board, game.Pool[1:2]...)
 	game.Pool = game.Pool[2:]
 	database.Broadcast(game.Room.ID, fmt.Sprintf("Turn round, board: %s\n", game.Board.TexasString()))
-	game.SBPlayer().State <- stateBet
+	game.Loop.Send(game.SBPlayer().ID, stateBet)
 	return nil
 }
 
@@ -94,7 +94,7 @@ func riverRound(game *database.Texas) error {
 	game.Board = append(game.Board, game.Pool[1:2]...)
 	game.Pool = game.Pool[2:]
 	database.Broadcast(game.Room.ID, fmt.Sprintf("River round, board: %s\n", game.Board.TexasString()))
-	game.SBPlayer().State <- stateBet
+	game.Loop.Send(game.SBPlayer().ID, stateBet)
 	return nil
 }
 
@@ -102,6 +102,7 @@ func settlementRound(game *database.Texas) error {
 	buf := bytes.Buffer{}
 	buf.WriteString("Settlement round\n")
 	buf.WriteString(fmt.Sprintf("Board: %s\n", game.Board.TexasString()))
+	won := map[int64]uint{}
 
 	if game.Folded == len(game.Players)-1 {
 		var winner *database.TexasPlayer
@@ -113,6 +114,7 @@ func settlementRound(game *database.Texas) error {
 		}
 		if winner != nil {
 			winner.Add(game.Pot)
+			won[winner.ID] = game.Pot
 			buf.WriteString(fmt.Sprintf("Winner: %s, got all pot: %d\n", winner.Name, game.Pot))
 		} else {
 			buf.WriteString("All players folded\n")
@@ -159,15 +161,26 @@ func settlementRound(game *database.Texas) error {
 		}
 		for _, winner := range winners {
 			winner.Add(game.Pot / uint(len(winners)))
+			won[winner.ID] = game.Pot / uint(len(winners))
+		}
+	}
+	// 按本局筹码输赢两两比较积分
+	results := map[int64]int{}
+	players, winners := make([]int64, 0, len(game.Players)), make([]int64, 0)
+	for _, player := range game.Players {
+		results[player.ID] = int(won[player.ID]) - int(player.Bets)
+		players = append(players, player.ID)
+		if won[player.ID] > 0 {
+			winners = append(winners, player.ID)
+			database.GetPlayer(player.ID).RecordPot(game.Pot)
 		}
 	}
 	buf.WriteString(fmt.Sprintf("Please room owner %s to start a new game\n", database.GetPlayer(game.Room.Creator).Name))
 	database.Broadcast(game.Room.ID, buf.String())
+	database.BroadcastRatings(game.Room.ID, database.RateResult(game.Room.Type, results))
+	database.RecordGame(game.Room.Type, players, winners)
 
-	room := game.Room
-	room.State = consts.RoomStateWaiting
-	for _, player := range game.Players {
-		player.State <- stateWaiting
-	}
+	database.EndGame(game.Room, game)
+	database.OpenRematch(game.Room, players, winners)
 	return nil
 }
@@ -3,10 +3,10 @@ package game
 import (
 	"bytes"
 	"fmt"
+	"strings"
+
+	"github.com/feel-easy/uno/card"
 	"github.com/feel-easy/uno/card/color"
-	"github.com/feel-easy/uno/event"
-	"github.com/feel-easy/uno/game"
-	"github.com/ratel-online/core/log"
 	"github.com/ratel-online/server/consts"
 	"github.com/ratel-online/server/database"
 )
@@ -14,11 +14,30 @@ import (
 type Uno struct{}
 
 func (g *Uno) Next(player *database.Player) (consts.StateID, error) {
-	room := database.GetRoom(player.RoomID)
-	if room == nil {
-		return 0, player.WriteError(consts.ErrorsExist)
+	return database.WaitGame(player)
+}
+
+// handleUno 房间事件循环里处理 UNO 的翻首牌和出牌
+func handleUno(room *database.Room, game *database.UnoGame) database.GameHandler {
+	return func(player *database.Player, state int) error {
+		switch state {
+		case stateFirstCard:
+			if msg := game.Game.PlayFirstCard(); msg != "" {
+				database.Broadcast(room.ID, msg)
+			}
+			game.Color = game.Game.Pile().Top().Color()
+			database.Broadcast(room.ID, fmt.Sprintf("First card is %s\n", game.Game.Pile().Top()))
+			pc := game.Game.Players().Next()
+			game.Loop.Send(int64(pc.ID()), statePlay)
+		case statePlay:
+			return handlePlayUno(room, player, game)
+		}
+		return nil
 	}
-	game := room.Game.(*database.UnoGame)
+}
+
+// welcomeUno 开局时向玩家介绍房规和手牌
+func welcomeUno(player *database.Player, game *database.UnoGame) {
 	buf := bytes.Buffer{}
 	buf.WriteString(fmt.Sprintf(
 		"WELCOME TO %s%s%s!!!\n",
@@ -26,105 +45,305 @@ func (g *Uno) Next(player *database.Player) (consts.StateID, error) {
 		color.Yellow.Paint("N"),
 		color.Blue.Paint("O"),
 	))
+	buf.WriteString(unoRules(game))
 	buf.WriteString(fmt.Sprintf("Your Cards: %s\n", game.Game.GetPlayerCards(int(player.ID))))
 	_ = player.WriteString(buf.String())
-	loopCount := 0
-	for {
-		loopCount++
-		if loopCount%100 == 0 {
-			log.Infof("[Uno.Next] Player %d (Room %d) loop count: %d, room.State: %d\n", player.ID, player.RoomID, loopCount, room.State)
-		}
-		if room.State == consts.RoomStateWaiting {
-			log.Infof("[Uno.Next] Player %d exiting, room state changed to waiting, loop count: %d\n", player.ID, loopCount)
-			return consts.StateWaiting, nil
-		}
-		log.Infof("[Uno.Next] Player %d waiting for state, loop count: %d\n", player.ID, loopCount)
-		state := <-game.States[int(player.ID)]
-		switch state {
-		case stateFirstCard:
-			if msg := game.Game.PlayFirstCard(); msg != "" {
-				database.Broadcast(room.ID, msg)
-			}
-			pc := game.Game.Players().Next()
-			game.States[pc.ID()] <- statePlay
-		case statePlay:
-			err := handlePlayUno(room, player, game)
-			if err != nil {
-				log.Error(err)
-				return 0, err
-			}
-		case stateWaiting:
-			return consts.StateWaiting, nil
-		default:
-			return 0, consts.ErrorsChanClosed
-		}
-	}
 }
 
 func (g *Uno) Exit(player *database.Player) consts.StateID {
 	return consts.StateHome
 }
 
+func unoRules(game *database.UnoGame) string {
+	buf := bytes.Buffer{}
+	if game.Rules.Stacking {
+		buf.WriteString("Rule: +2/+4 can be stacked, the next player draws the total. \n")
+	}
+	if game.Rules.Challenge {
+		buf.WriteString("Rule: Wild Draw Four can be challenged. \n")
+	}
+	if game.Rules.UnoCall {
+		buf.WriteString("Rule: forgetting to call UNO costs 2 cards. \n")
+	}
+	if game.Rules.JumpIn {
+		buf.WriteString("Rule: an identical card can jump in out of turn. \n")
+	}
+	if game.Rules.TargetScore > 0 {
+		buf.WriteString(fmt.Sprintf("Rule: first player to reach %d points wins. \n", game.Rules.TargetScore))
+	}
+	return buf.String()
+}
+
 func handlePlayUno(room *database.Room, player *database.Player, game *database.UnoGame) error {
 	p := game.Game.Current()
 	if p.ID() != int(player.ID) {
-		game.States[p.ID()] <- statePlay
+		game.Loop.Send(int64(p.ID()), statePlay)
 		return nil
 	}
 	if !game.HavePlay(player) {
 		pc := game.Game.Players().Next()
-		game.States[pc.ID()] <- statePlay
+		game.Loop.Send(int64(pc.ID()), statePlay)
+		return nil
+	}
+	up := game.UnoPlayers[p.ID()]
+	if game.PendingDraw > 0 {
+		if len(game.StackableCards(p.Hand())) == 0 {
+			unoTakePenalty(room, game, p.ID())
+			pc := game.Game.Players().Next()
+			game.Loop.Send(int64(pc.ID()), statePlay)
+			return nil
+		}
+		up.Filter = game.CanStack
 	}
 	gameState := game.Game.ExtractState(p)
-	card, err := p.Play(gameState, game.Game.Deck())
-	if err != nil || card == nil {
-		event.PlayerPassed.Emit(event.PlayerPassedPayload{
-			PlayerName: p.Name(),
-		})
+	playedCard, err := p.Play(gameState, game.Game.Deck())
+	up.Filter = nil
+	if err != nil || playedCard == nil {
+		if game.PendingDraw > 0 {
+			unoTakePenalty(room, game, p.ID())
+		} else {
+			database.Broadcast(room.ID, fmt.Sprintf("%s passed!\n", p.Name()))
+		}
 		pc := game.Game.Players().Next()
-		game.States[pc.ID()] <- statePlay
+		game.Loop.Send(int64(pc.ID()), statePlay)
 		return err
 	}
-	game.Game.Pile().Add(card)
-	event.CardPlayed.Emit(event.CardPlayedPayload{
-		PlayerName: p.Name(),
-		Card:       card,
-	})
-	if msg := game.Game.PerformCardActions(card); msg != "" {
-		database.Broadcast(room.ID, msg)
+
+	prevColor := game.Color
+	for {
+		if unoAfterPlay(room, game, p.ID(), playedCard, prevColor) {
+			return unoRoundEnd(room, game, p.ID())
+		}
+		jumperID := unoJumpIn(room, game, p.ID(), playedCard)
+		if jumperID == 0 {
+			break
+		}
+		// 抢出后从抢出的玩家继续
+		for game.Game.Current().ID() != jumperID {
+			game.Game.Players().Next()
+		}
+		p = game.Game.Current()
+		prevColor = game.Color
+		game.UnoPlayers[jumperID].Forced = playedCard
+		playedCard, _ = p.Play(game.Game.ExtractState(p), game.Game.Deck())
+		database.Broadcast(room.ID, fmt.Sprintf("%s jumped in!\n", p.Name()))
+	}
+	pc := game.Game.Players().Next()
+	game.Loop.Send(int64(pc.ID()), statePlay)
+	return nil
+}
+
+// unoAfterPlay 出牌后的结算，返回本局是否结束
+func unoAfterPlay(room *database.Room, game *database.UnoGame, playerId int, playedCard card.Card, prevColor color.Color) bool {
+	p := game.Game.Players().GetPlayerController(playerId)
+	up := game.UnoPlayers[playerId]
+	game.Discard(playedCard)
+	database.Broadcast(room.ID, fmt.Sprintf("%s played %s!\n", p.Name(), playedCard))
+	if len(p.Hand()) == 1 {
+		if up.Called {
+			database.Broadcast(room.ID, fmt.Sprintf("%s: UNO!\n", p.Name()))
+		} else if game.Rules.UnoCall {
+			database.Broadcast(room.ID, fmt.Sprintf("%s forgot to call UNO and draws 2 cards!\n", p.Name()))
+			p.AddCards(game.Game.Deck().Draw(2))
+		}
 	}
+	up.Called = false
 	if p.NoCards() || game.NeedExit() {
-		database.Broadcast(room.ID, fmt.Sprintf("%s wins! \n", p.Name()))
-		room.Game = nil
-		room.State = consts.RoomStateWaiting
-		for _, playerId := range game.Players {
-			game.States[playerId] <- stateWaiting
+		return true
+	}
+	unoPerformCardActions(room, game, playerId, playedCard, prevColor)
+	return false
+}
+
+// unoPerformCardActions 代替库里的 PerformCardActions，以支持叠加和质疑等房规
+func unoPerformCardActions(room *database.Room, game *database.UnoGame, playerId int, playedCard card.Card, prevColor color.Color) {
+	players := game.Game.Players()
+	switch playedCard.(type) {
+	case card.SkipCard:
+		database.Broadcast(room.ID, players.Skip())
+	case card.ReverseCard:
+		database.Broadcast(room.ID, players.Reverse())
+		if len(game.Players) == 2 {
+			database.Broadcast(room.ID, players.Skip())
+		}
+	case card.DrawTwoCard:
+		unoDraw(room, game, 2)
+	case card.WildCard:
+		unoPickColor(room, game, playerId)
+	case card.WildDrawFourCard:
+		unoPickColor(room, game, playerId)
+		if game.Rules.Challenge && unoChallenge(room, game, playerId, prevColor) {
+			return
+		}
+		unoDraw(room, game, 4)
+	}
+}
+
+// unoDraw 开启叠加时累积罚牌，否则下家直接摸牌并跳过
+func unoDraw(room *database.Room, game *database.UnoGame, amount int) {
+	if game.Rules.Stacking {
+		game.PendingDraw += amount
+		database.Broadcast(room.ID, fmt.Sprintf("Penalty stacked to %d cards!\n", game.PendingDraw))
+		return
+	}
+	victim := game.Game.Players().Next()
+	victim.AddCards(game.Game.Deck().Draw(amount))
+	database.Broadcast(room.ID, fmt.Sprintf("%s draws %d cards and is skipped!\n", victim.Name(), amount))
+}
+
+func unoTakePenalty(room *database.Room, game *database.UnoGame, playerId int) {
+	p := game.Game.Players().GetPlayerController(playerId)
+	p.AddCards(game.Game.Deck().Draw(game.PendingDraw))
+	database.Broadcast(room.ID, fmt.Sprintf("%s draws %d cards!\n", p.Name(), game.PendingDraw))
+	game.PendingDraw = 0
+}
+
+func unoPickColor(room *database.Room, game *database.UnoGame, playerId int) {
+	p := game.Game.Players().GetPlayerController(playerId)
+	c := p.PickColor(game.Game.ExtractState(p))
+	game.ChooseColor(c)
+	database.Broadcast(room.ID, fmt.Sprintf("%s picked color %s!\n", p.Name(), c))
+}
+
+// unoPeekNext 返回下家 ID，不改变出牌顺序
+func unoPeekNext(game *database.UnoGame) int {
+	players := game.Game.Players()
+	next := players.Next().ID()
+	players.Reverse()
+	players.Next()
+	players.Reverse()
+	return next
+}
+
+// unoChallenge 下家可以质疑 +4，出牌者手里有打出 +4 前要跟的颜色的牌时质疑成功。返回是否发生了质疑
+func unoChallenge(room *database.Room, game *database.UnoGame, playerId int, prevColor color.Color) bool {
+	victimID := unoPeekNext(game)
+	victim := database.GetPlayer(int64(victimID))
+	if victim == nil || !victim.IsOnline() {
+		return false
+	}
+	_ = victim.WriteString(fmt.Sprintf("Challenge the Wild Draw Four? (y/n), %ds left\n", int(consts.UnoChallengeTimeout.Seconds())))
+	ans, err := game.Room.Timer().Offer(victim, consts.UnoChallengeTimeout)
+	if err != nil || strings.ToLower(strings.TrimSpace(ans)) != "y" {
+		return false
+	}
+	offender := game.Game.Players().GetPlayerController(playerId)
+	if guilty, penalty := game.SettleChallenge(playerId, prevColor); guilty {
+		database.Broadcast(room.ID, fmt.Sprintf("%s challenged successfully! %s draws %d cards instead. Hand: %s\n", victim.Name, offender.Name(), penalty, offender.Hand()))
+	} else {
+		database.Broadcast(room.ID, fmt.Sprintf("Challenge failed! %s draws %d cards and is skipped!\n", victim.Name, penalty))
+	}
+	return true
+}
+
+// unoJumpIn 其他玩家手里有完全相同的牌时可以抢出，返回抢出的玩家 ID
+// 在事件循环里按座位顺序逐个私下询问，不向房间广播谁在被询问
+func unoJumpIn(room *database.Room, game *database.UnoGame, playerId int, playedCard card.Card) int {
+	if !game.Rules.JumpIn || playedCard.Color() == nil {
+		return 0
+	}
+	for _, id := range game.Players {
+		if id == playerId || !unoHasCard(game, id, playedCard) {
+			continue
+		}
+		p := database.GetPlayer(int64(id))
+		if p == nil || !p.IsOnline() {
+			continue
+		}
+		_ = p.WriteString(fmt.Sprintf("You also have %s! Input j (or 'j uno') within %ds to jump in.\n", playedCard, int(consts.UnoJumpInTimeout.Seconds())))
+		ans, err := game.Room.Timer().OfferPrivately(p, consts.UnoJumpInTimeout)
+		fields := strings.Fields(strings.ToLower(ans))
+		if err == nil && len(fields) > 0 && fields[0] == "j" {
+			game.UnoPlayers[id].Called = len(fields) > 1 && fields[1] == "uno"
+			return id
+		}
+	}
+	return 0
+}
+
+func unoHasCard(game *database.UnoGame, playerId int, c card.Card) bool {
+	for _, held := range game.Game.GetPlayerCards(playerId) {
+		if held.Equal(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// unoRoundEnd 本局结束，赢家获得其他玩家手牌的分数，未达到目标分数时开始下一局
+func unoRoundEnd(room *database.Room, game *database.UnoGame, winnerId int) error {
+	winner := game.Game.Players().GetPlayerController(winnerId)
+	points := 0
+	buf := bytes.Buffer{}
+	buf.WriteString(fmt.Sprintf("%s wins round %d! \n", winner.Name(), game.Round))
+	for _, id := range game.Players {
+		if id == winnerId {
+			continue
+		}
+		hand := game.Game.GetPlayerCards(id)
+		points += database.UnoHandPoints(hand)
+		buf.WriteString(fmt.Sprintf("%s: %s\n", game.Game.Players().GetPlayerController(id).Name(), hand))
+	}
+	game.Scores[winnerId] += points
+	buf.WriteString(fmt.Sprintf("%s scores %d points.\n", winner.Name(), points))
+	if game.Rules.TargetScore > 0 {
+		buf.WriteString("Scores: \n")
+		for _, id := range game.Players {
+			buf.WriteString(fmt.Sprintf("%s: %d/%d\n", game.Game.Players().GetPlayerController(id).Name(), game.Scores[id], game.Rules.TargetScore))
+		}
+	}
+	database.Broadcast(room.ID, buf.String())
+
+	if game.ReachedTarget(winnerId) || game.NeedExit() {
+		database.Broadcast(room.ID, fmt.Sprintf("%s wins! \n", winner.Name()))
+		results := map[int64]int{}
+		for _, id := range game.Players {
+			results[int64(id)] = game.Scores[id]
 		}
+		database.BroadcastRatings(room.ID, database.RateResult(room.Type, results))
+		players := make([]int64, 0, len(game.Players))
+		for _, id := range game.Players {
+			players = append(players, int64(id))
+		}
+		database.RecordGame(room.Type, players, []int64{int64(winnerId)})
+		database.EndGame(room, nil)
+		database.OpenRematch(room, players, []int64{int64(winnerId)})
 		return nil
 	}
-	pc := game.Game.Players().Next()
-	game.States[pc.ID()] <- statePlay
+
+	game.NewRound()
+	database.Broadcast(room.ID, fmt.Sprintf("Round %d starts! \n", game.Round))
+	game.Loop.Send(int64(game.Game.Current().ID()), stateFirstCard)
 	return nil
 }
 
 func InitUnoGame(room *database.Room) (*database.UnoGame, error) {
 	players := make([]int, 0)
-	roomPlayers := database.RoomPlayers(room.ID)
-	unoPlayers := make([]game.Player, 0)
-	states := map[int]chan int{}
-	for playerId := range roomPlayers {
+	unoPlayers := map[int]*database.UnoPlayer{}
+	for _, playerId := range database.RoomSeats(room.ID) {
 		p := database.GetPlayer(playerId)
 		players = append(players, int(p.ID))
-		unoPlayers = append(unoPlayers, database.NewUnoPlayer(p))
-		states[int(playerId)] = make(chan int, 1)
-	}
-	unoGame := game.New(unoPlayers)
-	unoGame.DealStartingCards()
-	states[unoGame.Current().ID()] <- stateFirstCard
-	return &database.UnoGame{
-		Room:    room,
-		Players: players,
-		States:  states,
-		Game:    unoGame,
-	}, nil
+		unoPlayers[int(p.ID)] = database.NewUnoPlayer(p)
+	}
+	database.NewTurnTimer(room, consts.PlayTimeout)
+	unoGame := &database.UnoGame{
+		Room:       room,
+		Players:    players,
+		UnoPlayers: unoPlayers,
+		Rules: database.UnoRules{
+			Stacking:    room.EnableUnoStacking,
+			Challenge:   room.EnableUnoChallenge,
+			UnoCall:     room.EnableUnoCall,
+			JumpIn:      room.EnableUnoJumpIn,
+			TargetScore: room.UnoTargetScore,
+		},
+		Scores: map[int]int{},
+	}
+	unoGame.NewRound()
+	for _, id := range players {
+		welcomeUno(database.GetPlayer(int64(id)), unoGame)
+	}
+	unoGame.Loop = database.NewGameLoop(room, handleUno(room, unoGame))
+	unoGame.Loop.Send(int64(unoGame.Game.Current().ID()), stateFirstCard)
+	return unoGame, nil
 }
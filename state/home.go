@@ -2,6 +2,9 @@ package state
 
 import (
 	"bytes"
+	"strconv"
+	"strings"
+
 	"github.com/ratel-online/server/consts"
 	"github.com/ratel-online/server/database"
 )
@@ -12,18 +15,56 @@ func (*home) Next(player *database.Player) (consts.StateID, error) {
 	buf := bytes.Buffer{}
 	buf.WriteString("1.Join\n")
 	buf.WriteString("2.New\n")
+	buf.WriteString("3.Quick match\n")
+	buf.WriteString("4.Leaderboard\n")
+	buf.WriteString("5.Join by invite code\n")
+	buf.WriteString("6.Profile\n")
+	buf.WriteString("Chat: /l msg, /w <name> msg, /r msg, /block <name>, /report <id> <reason>\n")
+	buf.WriteString("Friends: /friends, /friend add/rm/join <name>\n")
 	err := player.WriteString(buf.String())
 	if err != nil {
 		return 0, player.WriteError(err)
 	}
-	selected, err := player.AskForInt()
+	signal, err := player.AskForString()
 	if err != nil {
 		return 0, player.WriteError(err)
 	}
+	if handleChat(player, signal, true) || handleModeration(player, signal) {
+		return consts.StateHome, nil
+	}
+	if next, ok := handleFriend(player, signal, true); ok {
+		return next, nil
+	}
+	selected, err := strconv.Atoi(strings.TrimSpace(signal))
+	if err != nil {
+		return 0, player.WriteError(consts.ErrorsInputInvalid)
+	}
 	if selected == 1 {
 		return consts.StateJoin, nil
 	} else if selected == 2 {
 		return consts.StateCreate, nil
+	} else if selected == 3 {
+		return consts.StateMatch, nil
+	} else if selected == 4 {
+		gameType, err := askForGameType(player)
+		if err != nil {
+			return 0, err
+		}
+		_ = player.WriteString(sprintLeaderboard(gameType) + sprintRatingHistory(player, gameType))
+		return consts.StateHome, nil
+	} else if selected == 5 {
+		err = player.WriteString("Please input invite code: \n")
+		if err != nil {
+			return 0, player.WriteError(err)
+		}
+		code, err := player.AskForString()
+		if err != nil {
+			return 0, player.WriteError(err)
+		}
+		return joinByCode(player, code)
+	} else if selected == 6 {
+		viewProfile(player, player.ID)
+		return consts.StateHome, nil
 	}
 	return 0, player.WriteError(consts.ErrorsInputInvalid)
 }
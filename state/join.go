@@ -1,27 +1,20 @@
 package state
 
 import (
-	"bytes"
 	"fmt"
+	"strconv"
+	"strings"
+
 	"github.com/ratel-online/server/consts"
 	"github.com/ratel-online/server/database"
-	"strconv"
+	"github.com/ratel-online/server/render"
 )
 
 type join struct{}
 
 func (s *join) Next(player *database.Player) (consts.StateID, error) {
-	buf := bytes.Buffer{}
-	rooms := database.GetRooms()
-	buf.WriteString(fmt.Sprintf("%-10s%-10s%-10s%-10s\n", "ID", "Type", "Players", "State"))
-	for _, room := range rooms {
-		pwdFlag := ""
-		if room.Password != "" {
-			pwdFlag = "*"
-		}
-		buf.WriteString(fmt.Sprintf("%-10d%-10s%-10d%-10s\n", room.ID, pwdFlag+consts.GameTypes[room.Type], room.Players, consts.RoomStates[room.State]))
-	}
-	err := player.WriteString(buf.String())
+	filter := player.RoomFilter()
+	err := render.RoomList(player, filter)
 	if err != nil {
 		return 0, player.WriteError(err)
 	}
@@ -32,7 +25,34 @@ func (s *join) Next(player *database.Player) (consts.StateID, error) {
 	if isExit(signal) {
 		return s.Exit(player), nil
 	}
-	if isLs(signal) {
+	if handleChat(player, signal, true) || handleModeration(player, signal) {
+		return consts.StateJoin, nil
+	}
+	if next, ok := handleFriend(player, signal, true); ok {
+		return next, nil
+	}
+	segments := strings.Fields(strings.ToLower(signal))
+	if len(segments) == 0 {
+		return consts.StateJoin, nil
+	}
+	if isLs(segments[0]) {
+		newFilter, err := database.ParseRoomFilter(segments[1:])
+		if err != nil {
+			return 0, player.WriteError(err)
+		}
+		*filter = newFilter
+		return consts.StateJoin, nil
+	}
+	if isX(segments[0], "n", "next") {
+		filter.Page++
+		return consts.StateJoin, nil
+	}
+	if isX(segments[0], "prev") {
+		filter.Page--
+		return consts.StateJoin, nil
+	}
+	if targetId, ok := isProfile(segments); ok {
+		viewProfile(player, targetId)
 		return consts.StateJoin, nil
 	}
 	roomId, err := strconv.ParseInt(signal, 10, 64)
@@ -44,41 +64,63 @@ func (s *join) Next(player *database.Player) (consts.StateID, error) {
 		return 0, player.WriteError(consts.ErrorsRoomInvalid)
 	}
 
-	//房间存在密码，要求输入密码
-	pwd := room.Password
-	if pwd != "" {
-		err = verifyPassword(player, pwd)
+	//私密房间或房间存在密码，要求输入密码或邀请码
+	if room.HasPassword() || room.Private {
+		err = verifyAccess(player, room)
 		if err != nil {
 			return 0, player.WriteError(err)
 		}
 	}
-	err = database.JoinRoom(roomId, player.ID)
+	return enterRoom(player, room)
+}
+
+func (s *join) Exit(player *database.Player) consts.StateID {
+	player.ResetRoomFilter()
+	return consts.StateHome
+}
+
+// 加入房间并通知房间内的玩家
+func enterRoom(player *database.Player, room *database.Room) (consts.StateID, error) {
+	err := database.JoinRoom(room.ID, player.ID)
 	if err != nil {
 		return 0, player.WriteError(err)
 	}
 	if room.State != consts.RoomStateRunning {
-		database.Broadcast(roomId, fmt.Sprintf("%s [%s] joined room! room current has %d players\n", player.Name, player.Role, room.Players))
+		database.Broadcast(room.ID, fmt.Sprintf("%s [%s] joined room! room current has %d players\n", player.Name, player.Role, room.Players))
 	} else {
 		_ = player.WriteString("You have joined a running game, please wait for the game to finish.\n")
 	}
+	if history := database.ChatHistory(room); history != "" {
+		_ = player.WriteString(history)
+	}
 	return consts.StateWaiting, nil
 }
 
-func (*join) Exit(player *database.Player) consts.StateID {
-	return consts.StateHome
+// 通过邀请码加入房间，不需要密码
+func joinByCode(player *database.Player, code string) (consts.StateID, error) {
+	room, err := database.GetInviteRoom(code)
+	if err != nil {
+		_ = player.WriteError(err)
+		return consts.StateHome, nil
+	}
+	return enterRoom(player, room)
 }
 
-// 校验密码
-func verifyPassword(player *database.Player, pwd string) error {
-	err := player.WriteString("Please input room password: \n")
+// 校验密码或邀请码
+func verifyAccess(player *database.Player, room *database.Room) error {
+	msg := "Please input room password: \n"
+	if room.Private {
+		msg = "This room is private, please input invite code or password: \n"
+	}
+	err := player.WriteString(msg)
 	if err != nil {
 		return err
 	}
-	password, err := player.AskForString()
+	secret, err := player.AskForString()
 	if err != nil {
 		return err
 	}
-	if password != pwd {
+	if !room.CheckAccess(secret) {
 		return consts.ErrorsRoomPassword
 	}
 	return nil
@@ -0,0 +1,56 @@
+package state
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ratel-online/core/log"
+	"github.com/ratel-online/server/consts"
+	"github.com/ratel-online/server/database"
+)
+
+type match struct{}
+
+func (*match) Next(player *database.Player) (consts.StateID, error) {
+	gameType, err := askForGameType(player)
+	if err != nil {
+		return 0, err
+	}
+	database.EnqueueMatch(player, gameType)
+	defer database.DequeueMatch(player.ID)
+	err = player.WriteString(fmt.Sprintf("Matching %s, your rating: %d, input exit to cancel\n", consts.GameTypes[gameType], player.Rating(gameType)))
+	if err != nil {
+		return 0, player.WriteError(err)
+	}
+
+	player.StartTransaction()
+	defer player.StopTransaction()
+	lastWindow := 0
+	loopCount := 0
+	for {
+		loopCount++
+		if loopCount%100 == 0 {
+			log.Infof("[match] Player %d (game type %d) loop count: %d\n", player.ID, gameType, loopCount)
+		}
+		_, err = player.AskForStringWithoutTransaction(time.Second)
+		if err != nil && err != consts.ErrorsTimeout {
+			return 0, err
+		}
+		if room := database.Match(gameType); room != nil {
+			database.Broadcast(room.ID, fmt.Sprintf("Match found! room %d has %d players, game starting...\n", room.ID, room.Players))
+		}
+		// 凑成一桌后进入房间，由房间的自动开局开始游戏
+		if player.RoomID > 0 {
+			return consts.StateWaiting, nil
+		}
+		window, queued := database.MatchWindow(player.ID, gameType)
+		if window != lastWindow {
+			lastWindow = window
+			_ = player.WriteString(fmt.Sprintf("Waiting for players, %d in queue, rating window ±%d\n", queued, window))
+		}
+	}
+}
+
+func (*match) Exit(_ *database.Player) consts.StateID {
+	return consts.StateHome
+}
@@ -0,0 +1,61 @@
+package state
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ratel-online/server/consts"
+	"github.com/ratel-online/server/database"
+)
+
+// handleModeration 处理举报、提升管理员和管理员的封禁指令，指令以 / 开头，返回输入是否已被处理
+func handleModeration(player *database.Player, signal string) bool {
+	cmd, rest := splitFirst(signal)
+	switch strings.ToLower(cmd) {
+	case "/report":
+		target, reason := splitFirst(rest)
+		if err := database.ReportPlayer(player, target, reason); err != nil {
+			_ = player.WriteError(err)
+		} else {
+			_ = player.WriteString("Report received, thanks.\n")
+		}
+	case "/ban", "/banip":
+		target, rest := splitFirst(rest)
+		duration, reason := splitFirst(rest)
+		d, err := database.ParseBanDuration(strings.ToLower(duration))
+		if err == nil {
+			var ban *database.Ban
+			ban, err = database.BanPlayer(player, target, strings.EqualFold(cmd, "/banip"), d, reason)
+			if err == nil {
+				_ = player.WriteString(ban.String() + "\n")
+			}
+		}
+		if err != nil {
+			_ = player.WriteError(err)
+		}
+	case "/unban":
+		if err := database.Unban(player, rest); err != nil {
+			_ = player.WriteError(err)
+		} else {
+			_ = player.WriteString(fmt.Sprintf("Ban on %s lifted\n", rest))
+		}
+	case "/sudo":
+		// 口令区分大小写，用原始输入校验
+		if err := player.Elevate(rest); err != nil {
+			_ = player.WriteError(err)
+		} else {
+			_ = player.WriteString("You are admin now.\n")
+		}
+	case "/bans", "/reports":
+		if !player.IsAdmin() {
+			_ = player.WriteError(consts.ErrorsAdminRequired)
+		} else if strings.EqualFold(cmd, "/bans") {
+			_ = player.WriteString(database.SprintBans())
+		} else {
+			_ = player.WriteString(database.SprintReports())
+		}
+	default:
+		return false
+	}
+	return true
+}
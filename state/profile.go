@@ -0,0 +1,26 @@
+package state
+
+import (
+	"github.com/ratel-online/server/consts"
+	"github.com/ratel-online/server/database"
+	"github.com/ratel-online/server/render"
+	"github.com/spf13/cast"
+)
+
+// isProfile 输入 /profile <id> 时返回要查看的玩家 ID
+func isProfile(segments []string) (int64, bool) {
+	if len(segments) != 2 || segments[0] != "/profile" {
+		return 0, false
+	}
+	return cast.ToInt64(segments[1]), true
+}
+
+// viewProfile 查看玩家资料
+func viewProfile(player *database.Player, targetId int64) {
+	target := database.GetPlayer(targetId)
+	if target == nil || target.IsAI() {
+		_ = player.WriteError(consts.ErrorsPlayerNotFound)
+		return
+	}
+	_ = render.Profile(player, target.Profile())
+}
@@ -0,0 +1,30 @@
+package state
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/ratel-online/server/consts"
+	"github.com/ratel-online/server/database"
+)
+
+// sprintLeaderboard 某种玩法的积分排行榜
+func sprintLeaderboard(gameType int) string {
+	buf := bytes.Buffer{}
+	buf.WriteString(fmt.Sprintf("%s leaderboard\n", consts.GameTypes[gameType]))
+	buf.WriteString(fmt.Sprintf("%-6s%-20s%-10s\n", "Rank", "Name", "Rating"))
+	for i, p := range database.Leaderboard(gameType, consts.LeaderboardSize) {
+		buf.WriteString(fmt.Sprintf("%-6d%-20s%-10d\n", i+1, p.Name, p.Rating(gameType)))
+	}
+	return buf.String()
+}
+
+// sprintRatingHistory 玩家某种玩法的积分和最近的变化
+func sprintRatingHistory(player *database.Player, gameType int) string {
+	buf := bytes.Buffer{}
+	buf.WriteString(fmt.Sprintf("%s rating of %s: %d\n", consts.GameTypes[gameType], player.Name, player.Rating(gameType)))
+	for _, r := range player.RatingHistory(gameType) {
+		buf.WriteString(fmt.Sprintf("  %s  %d (%+d)\n", r.Time.Format("01-02 15:04"), r.Rating, r.Delta))
+	}
+	return buf.String()
+}
@@ -18,6 +18,7 @@ func init() {
 	register(consts.StateHome, &home{})
 	register(consts.StateJoin, &join{})
 	register(consts.StateCreate, &create{})
+	register(consts.StateMatch, &match{})
 	register(consts.StateWaiting, &waiting{})
 	register(consts.StateGame, &game.Game{})
 	register(consts.StateUnoGame, &game.Uno{})
@@ -25,6 +26,7 @@ func init() {
 	register(consts.StateMahjongGame, &game.Mahjong{})
 	register(consts.StateTexasGame, &texas.Texas{})
 	register(consts.StateLiarGame, &game.Liar{})
+	register(consts.StateLiarDiceGame, &game.LiarDice{})
 }
 
 func register(id consts.StateID, state State) {
@@ -30,24 +30,30 @@ func (s *waiting) Next(player *database.Player) (consts.StateID, error) {
 		return 0, err
 	}
 	if access {
-		switch room.Type {
-		default:
-			return consts.StateGame, nil
-		case consts.GameTypeRunFast:
-			return consts.StateRunFastGame, nil
-		case consts.GameTypeUno:
-			return consts.StateUnoGame, nil
-		case consts.GameTypeMahjong:
-			return consts.StateMahjongGame, nil
-		case consts.GameTypeTexas:
-			return consts.StateTexasGame, nil
-		case consts.GameTypeLiar:
-			return consts.StateLiarGame, nil
-		}
+		return gameState(room), nil
 	}
 	return s.Exit(player), nil
 }
 
+// gameState 房间玩法对应的游戏状态
+func gameState(room *database.Room) consts.StateID {
+	switch room.Type {
+	case consts.GameTypeRunFast:
+		return consts.StateRunFastGame
+	case consts.GameTypeUno:
+		return consts.StateUnoGame
+	case consts.GameTypeMahjong:
+		return consts.StateMahjongGame
+	case consts.GameTypeTexas:
+		return consts.StateTexasGame
+	case consts.GameTypeLiar:
+		return consts.StateLiarGame
+	case consts.GameTypeLiarDice:
+		return consts.StateLiarDiceGame
+	}
+	return consts.StateGame
+}
+
 func (s *waiting) Exit(player *database.Player) consts.StateID {
 	room := database.GetRoom(player.RoomID)
 	if room != nil {
@@ -64,7 +70,7 @@ func (s *waiting) Exit(player *database.Player) consts.StateID {
 }
 
 func (*waiting) Backfill(room *database.Room) {
-	if room.State == consts.RoomStateRunning {
+	if room.Running() {
 		return
 	}
 	newPlayer := database.Backfill(room.ID)
@@ -82,6 +88,154 @@ func (*waiting) Kicking(player *database.Player) {
 	}
 }
 
+// Invite 房主生成新的邀请码，旧的邀请码作废，房间变为私密房间
+func (*waiting) Invite(player *database.Player, room *database.Room) {
+	invite := database.CreateInvite(room)
+	buf := bytes.Buffer{}
+	buf.WriteString(fmt.Sprintf("Invite code: %s, expires in %s\n", invite.Code, consts.InviteTTL))
+	if link := invite.Link(); link != "" {
+		buf.WriteString(fmt.Sprintf("Invite link: %s\n", link))
+	}
+	_ = player.WriteString(buf.String())
+}
+
+// Ready 切换准备状态并通知房间
+func (*waiting) Ready(player *database.Player, room *database.Room) {
+	if database.ToggleReady(room, player.ID) {
+		database.Broadcast(room.ID, fmt.Sprintf("%s is ready\n", player.Name))
+	} else {
+		database.Broadcast(room.ID, fmt.Sprintf("%s is not ready\n", player.Name))
+	}
+}
+
+// readyCheck 房间坐满且全部准备后倒计时自动开局，超时未准备的玩家按房主的设置踢出或移到观众席
+func (s *waiting) readyCheck(room *database.Room) {
+	state := database.ReadyTick(room)
+	if state.Cancelled {
+		database.Broadcast(room.ID, "Auto start cancelled\n")
+	}
+	if state.Countdown > 0 {
+		database.Broadcast(room.ID, fmt.Sprintf("All players are ready, game starts in %ds\n", state.Countdown))
+	}
+	if state.Start {
+		if owner := database.GetPlayer(room.Creator); owner != nil {
+			if err := startGame(owner, room); err != nil {
+				database.Broadcast(room.ID, fmt.Sprintf("Auto start failed: %s\n", err))
+			}
+		}
+	}
+	for _, id := range state.Idle {
+		idle := database.GetPlayer(id)
+		if idle == nil {
+			continue
+		}
+		switch room.UnreadyPolicy {
+		case database.UnreadyKick:
+			s.Kicking(idle)
+		case database.UnreadySpectate:
+			database.MoveToSpectator(room.ID, id)
+			database.Broadcast(room.ID, fmt.Sprintf("%s was not ready in time and became a spectator\n", idle.Name))
+		}
+	}
+}
+
+// rematchCheck 一局结束后入座的玩家全部同意再来一局时自动开局
+func (s *waiting) rematchCheck(room *database.Room) {
+	state := database.RematchTick(room)
+	if state.Expired {
+		database.Broadcast(room.ID, "Rematch vote timed out, waiting for the owner to start\n")
+	}
+	if state.Start {
+		database.Broadcast(room.ID, "Everyone accepted, rematch starts!\n")
+		if owner := database.GetPlayer(room.Creator); owner != nil {
+			if err := startGame(owner, room); err != nil {
+				database.Broadcast(room.ID, fmt.Sprintf("Rematch failed: %s\n", err))
+			}
+		}
+	}
+}
+
+// Rematch 同意再来一局，或者让出座位给排队的观众
+func (*waiting) Rematch(player *database.Player, room *database.Room, accept bool) {
+	if accept {
+		vote, err := database.AcceptRematch(room, player.ID)
+		if err != nil {
+			_ = player.WriteError(err)
+			return
+		}
+		accepted, seated := vote.Count(room)
+		database.Broadcast(room.ID, fmt.Sprintf("%s accepted the rematch (%d/%d)\n", player.Name, accepted, seated))
+		return
+	}
+	promoted, err := database.DeclineRematch(room, player.ID)
+	if err != nil {
+		_ = player.WriteError(err)
+		return
+	}
+	database.Broadcast(room.ID, fmt.Sprintf("%s declined the rematch and became a spectator\n", player.Name))
+	if promoted != nil {
+		database.Broadcast(room.ID, fmt.Sprintf("%s takes the free seat, input rematch to play\n", promoted.Name))
+	}
+}
+
+// Swap 请求和其他玩家换座，对方输入 swap 请求人的 ID 确认后交换
+func (*waiting) Swap(player *database.Player, room *database.Room, targetId int64) {
+	result, err := database.Swap(room, player.ID, targetId)
+	if err != nil {
+		_ = player.WriteError(err)
+		return
+	}
+	target := database.GetPlayer(targetId)
+	if result == database.SwapDone {
+		database.Broadcast(room.ID, fmt.Sprintf("%s and %s swapped seats\n", player.Name, target.Name))
+		return
+	}
+	_ = player.WriteString(fmt.Sprintf("Waiting for %s to accept the swap\n", target.Name))
+	_ = target.WriteString(fmt.Sprintf("%s asks to swap seats with you, input swap %d to accept\n", player.Name, player.ID))
+}
+
+// voteCheck 投票超时后宣布结果
+func (s *waiting) voteCheck(room *database.Room) {
+	if vote, result := database.KickVoteTick(room); result != database.VotePending {
+		s.announceVote(room, vote, result)
+	}
+}
+
+// announceVote 广播投票进度，通过后踢出玩家并加入本房间的禁止名单
+func (s *waiting) announceVote(room *database.Room, vote *database.KickVote, result int) {
+	target := database.GetPlayer(vote.Target)
+	if target == nil {
+		return
+	}
+	switch result {
+	case database.VotePassed:
+		database.Broadcast(room.ID, fmt.Sprintf("Vote to kick %s passed\n", target.Name))
+		s.Kicking(target)
+	case database.VoteRejected:
+		database.Broadcast(room.ID, fmt.Sprintf("Vote to kick %s failed\n", target.Name))
+	default:
+		yes, no, voters := vote.Count(room)
+		database.Broadcast(room.ID, fmt.Sprintf("Vote to kick %s: %d yes, %d no, %d voters, input /yes or /no to vote within %ds\n",
+			target.Name, yes, no, voters, int(time.Until(vote.Deadline).Seconds())))
+	}
+}
+
+// FillAI 房主用电脑玩家填满麻将房间的空位
+func (*waiting) FillAI(player *database.Player, room *database.Room) {
+	if room.Type != consts.GameTypeMahjong {
+		_ = player.WriteError(consts.ErrorsAIUnsupported)
+		return
+	}
+	for room.Players < room.MaxPlayers {
+		ai, err := database.AddAI(room.ID)
+		if err != nil {
+			_ = player.WriteError(err)
+			return
+		}
+		database.Broadcast(room.ID, fmt.Sprintf("%s has joined room! room current has %d players\n", ai.Name, room.Players))
+	}
+}
+
 func (s *waiting) waitingForStart(player *database.Player, room *database.Room) (bool, error) {
 	access := false
 	//对局类别
@@ -102,10 +256,20 @@ func (s *waiting) waitingForStart(player *database.Player, room *database.Room)
 			return false, consts.ErrorsPlayerNotInRoom
 		}
 
-		if room.State == consts.RoomStateRunning && player.Role == database.RolePlayer {
+		// 自动开局和再来一局可能由其他玩家的协程开局，入座的玩家都跟着进入游戏
+		if room.Running() && room.Seated(player.ID) {
 			access = true
 			break
 		}
+		s.readyCheck(room)
+		s.rematchCheck(room)
+		s.voteCheck(room)
+		if handleChat(player, signal, false) || handleModeration(player, signal) {
+			continue
+		}
+		if _, ok := handleFriend(player, signal, false); ok {
+			continue
+		}
 		signal = strings.TrimSpace(strings.ToLower(signal))
 		if signal == "" {
 			continue
@@ -133,8 +297,113 @@ func (s *waiting) waitingForStart(player *database.Player, room *database.Room)
 					access = true
 					break
 				}
+			} else if segments[0] == "ready" || segments[0] == "r" {
+				if player.Role != database.RoleSpectator && !room.Running() {
+					s.Ready(player, room)
+					continue
+				}
+			} else if segments[0] == "rematch" || segments[0] == "decline" {
+				s.Rematch(player, room, segments[0] == "rematch")
+				continue
+			} else if segments[0] == "/yes" || segments[0] == "/no" {
+				vote, result, err := database.CastKickVote(room, player.ID, segments[0] == "/yes")
+				if err != nil {
+					_ = player.WriteError(err)
+				} else {
+					s.announceVote(room, vote, result)
+				}
+				continue
+			} else if segments[0] == "table" {
+				if table := database.Table(room); table != "" {
+					_ = player.WriteString(table)
+				} else {
+					_ = player.WriteError(consts.ErrorsNoGame)
+				}
+				continue
+			} else if segments[0] == "rank" {
+				_ = player.WriteString(sprintLeaderboard(room.Type))
+				continue
+			} else if segments[0] == "rating" {
+				_ = player.WriteString(sprintRatingHistory(player, room.Type))
+				continue
+			} else if segments[0] == "invite" {
+				if room.Creator == player.ID {
+					s.Invite(player, room)
+					continue
+				}
+			} else if segments[0] == "ai" {
+				if room.Creator == player.ID {
+					s.FillAI(player, room)
+					continue
+				}
+			} else if game.IsLiarSupervisorCommand(segments[0]) {
+				if liar, ok := room.Game.(*database.Liar); ok && room.Running() {
+					if err := game.LiarSupervise(player, liar); err != nil {
+						_ = player.WriteError(err)
+					}
+				}
+				continue
 			}
 		} else if len(segments) == 2 {
+			if targetId, ok := isProfile(segments); ok {
+				viewProfile(player, targetId)
+				continue
+			}
+			if segments[0] == "invite" && segments[1] == "off" && room.Creator == player.ID {
+				database.RevokeInvite(room)
+				_ = player.WriteString("Invite code revoked, room is public now.\n")
+				continue
+			}
+			if segments[0] == "sit" {
+				if err := database.Sit(room, player.ID, cast.ToInt(segments[1])); err != nil {
+					_ = player.WriteError(err)
+				} else {
+					database.Broadcast(room.ID, fmt.Sprintf("%s moved to seat %d\n", player.Name, room.Seat(player.ID)))
+				}
+				continue
+			}
+			if segments[0] == "swap" {
+				s.Swap(player, room, cast.ToInt64(segments[1]))
+				continue
+			}
+			if segments[0] == "/votekick" {
+				vote, result, err := database.StartKickVote(room, player.ID, cast.ToInt64(segments[1]))
+				if err != nil {
+					_ = player.WriteError(err)
+				} else {
+					s.announceVote(room, vote, result)
+				}
+				continue
+			}
+			if segments[0] == "/transfer" && room.Creator == player.ID {
+				if err := database.TransferOwner(room, cast.ToInt64(segments[1])); err != nil {
+					_ = player.WriteError(err)
+				} else {
+					database.Broadcast(room.ID, fmt.Sprintf("%s transferred ownership, %s become new owner\n", player.Name, database.GetPlayer(room.Creator).Name))
+				}
+				continue
+			}
+			if segments[0] == "/mute" {
+				target := database.GetPlayer(cast.ToInt64(segments[1]))
+				if target == nil || target.ID == player.ID {
+					_ = player.WriteError(consts.ErrorsPlayerNotFound)
+				} else if player.ToggleMute(target.ID) {
+					_ = player.WriteString(fmt.Sprintf("You muted %s, input /mute %d again to unmute\n", target.Name, target.ID))
+				} else {
+					_ = player.WriteString(fmt.Sprintf("You unmuted %s\n", target.Name))
+				}
+				continue
+			}
+			if segments[0] == "/chatlog" {
+				if !player.IsAdmin() {
+					_ = player.WriteError(consts.ErrorsAdminRequired)
+				} else if text, err := database.SprintChatLog(segments[1]); err != nil {
+					_ = player.WriteError(err)
+				} else {
+					_ = player.WriteString(text)
+				}
+				continue
+			}
 			if segments[0] == "kicking" || segments[0] == "kill" || segments[0] == "k" {
 				if room.Creator == player.ID {
 					kickedId := cast.ToInt64(segments[1])
@@ -159,7 +428,9 @@ func (s *waiting) waitingForStart(player *database.Player, room *database.Room)
 		}
 
 		if room.EnableChat {
-			if room.State == consts.RoomStateRunning {
+			if room.Running() && player.Role == database.RoleSpectator {
+				database.BroadcastSpectatorChat(player, fmt.Sprintf("%s [spectator] say: %s\n", player.Name, signal))
+			} else if room.Running() {
 				_ = player.WriteString(fmt.Sprintf("%s\n", consts.ErrorsChatUnopenedDuringGame.Error()))
 			} else {
 				database.BroadcastChat(player, fmt.Sprintf("%s [%s] say: %s\n", player.Name, player.Role, signal))
@@ -187,12 +458,17 @@ func startGame(player *database.Player, room *database.Room) (err error) {
 		room.Game, err = texas.Init(room)
 	case consts.GameTypeLiar:
 		room.Game, err = game.InitLiarGame(room)
+	case consts.GameTypeLiarDice:
+		room.Game, err = game.InitLiarDiceGame(room)
 	}
 	if err != nil {
 		_ = player.WriteError(err)
 		return err
 	}
+	database.ResetReady(room)
 	room.State = consts.RoomStateRunning
+	room.Loop().Run()
+	database.NotifyGameStarted(room)
 	return nil
 }
 
@@ -200,12 +476,19 @@ func viewRoomPlayers(room *database.Room, currPlayer *database.Player) {
 	buf := bytes.Buffer{}
 	buf.WriteString(fmt.Sprintf("Room ID: %d\n", room.ID))
 	buf.WriteString("Players:\n")
-	for playerId := range database.RoomPlayers(room.ID) {
-		player := database.GetPlayer(playerId)
+	for _, seat := range database.SeatSnapshot(room) {
+		player := database.GetPlayer(seat.PlayerID)
+		if player == nil {
+			continue
+		}
+		ready := ""
+		if seat.Ready {
+			ready = " [ready]"
+		}
 		if room.EnableShowIP {
-			buf.WriteString(fmt.Sprintf("%s [%s], score: %d, id: %d, ip: %s\n", player.Name, player.Role, player.Amount, player.ID, maskIP(player.IP)))
+			buf.WriteString(fmt.Sprintf("%d. %s [%s]%s, score: %d, id: %d, ip: %s\n", seat.Seat, player.Name, player.Role, ready, player.Amount, player.ID, maskIP(player.IP)))
 		} else {
-			buf.WriteString(fmt.Sprintf("%s [%s], score: %d, id: %d\n", player.Name, player.Role, player.Amount, player.ID))
+			buf.WriteString(fmt.Sprintf("%d. %s [%s]%s, score: %d, id: %d\n", seat.Seat, player.Name, player.Role, ready, player.Amount, player.ID))
 		}
 	}
 
@@ -221,28 +504,50 @@ func viewRoomPlayers(room *database.Room, currPlayer *database.Player) {
 
 	buf.WriteString("\nSettings:\n")
 	switch room.Type {
-	case consts.GameTypeUno, consts.GameTypeMahjong:
+	case consts.GameTypeUno:
+		buf.WriteString(fmt.Sprintf("%-5s%-5v%-5s%-5v\n", "sd:", sprintPropsState(room.EnableUnoStacking)+",", "ch:", sprintPropsState(room.EnableUnoChallenge)))
+		buf.WriteString(fmt.Sprintf("%-5s%-5v%-5s%-5v\n", "uc:", sprintPropsState(room.EnableUnoCall)+",", "ji:", sprintPropsState(room.EnableUnoJumpIn)))
+		buf.WriteString(fmt.Sprintf("%-5s%-5v%-5s%-5v\n", "ts:", room.UnoTargetScore, "pn:", room.MaxPlayers))
+		buf.WriteString(fmt.Sprintf("%-5s%-5v\n", "ip:", sprintPropsState(room.EnableShowIP)))
+	case consts.GameTypeMahjong:
+		buf.WriteString(fmt.Sprintf("%-5s%-5v\n", "sc:", sprintPropsState(room.EnableSichuan)))
 		buf.WriteString(fmt.Sprintf("%-5s%-5v\n", "ip:", sprintPropsState(room.EnableShowIP)))
 	case consts.GameTypeTexas:
 		buf.WriteString(fmt.Sprintf("%-5s%-5v\n", "pn:", room.MaxPlayers))
 		buf.WriteString(fmt.Sprintf("%-5s%-5v\n", "ip:", sprintPropsState(room.EnableShowIP)))
 	case consts.GameTypeLiar:
 		buf.WriteString(fmt.Sprintf("%-5s%-5v\n", "jt:", sprintPropsState(room.EnableJokerAsTarget)))
+		buf.WriteString(fmt.Sprintf("%-5s%-5v\n", "cs:", sprintPropsState(room.EnableCasual)))
 		buf.WriteString(fmt.Sprintf("%-5s%-5v\n", "ip:", sprintPropsState(room.EnableShowIP)))
+	case consts.GameTypeLiarDice:
+		buf.WriteString(fmt.Sprintf("%-5s%-5v%-5s%-5v\n", "wo:", sprintPropsState(room.EnableWildOnes)+",", "so:", sprintPropsState(room.EnableSpotOn)))
+		buf.WriteString(fmt.Sprintf("%-5s%-5v%-5s%-5v\n", "pn:", room.MaxPlayers, "ip:", sprintPropsState(room.EnableShowIP)))
 	default:
-		buf.WriteString(fmt.Sprintf("%-5s%-5v%-5s%-5v\n", "lz:", sprintPropsState(room.EnableLaiZi)))
+		buf.WriteString(fmt.Sprintf("%-5s%-5v\n", "lz:", sprintPropsState(room.EnableLaiZi)))
 		buf.WriteString(fmt.Sprintf("%-5s%-5v%-5s%-5v\n", "ds:", sprintPropsState(room.EnableDontShuffle)+",", "sk:", sprintPropsState(room.EnableSkill)))
 		buf.WriteString(fmt.Sprintf("%-5s%-5v%-5s%-5v\n", "pn:", room.MaxPlayers, "ct:", sprintPropsState(room.EnableChat)))
 		buf.WriteString(fmt.Sprintf("%-5s%-5v\n", "ip:", sprintPropsState(room.EnableShowIP)))
-		pwd := room.Password
-		if pwd != "" {
-			if room.Creator != currPlayer.ID {
-				pwd = "********"
+		buf.WriteString(fmt.Sprintf("%-5s%-5v\n", "pwd:", sprintPropsState(room.HasPassword())))
+	}
+	unready := "off"
+	if room.UnreadyPolicy != "" {
+		unready = room.UnreadyPolicy
+	}
+	buf.WriteString(fmt.Sprintf("%-5s%-5v%-5s%-5v\n", "ar:", sprintPropsState(room.EnableAutoStart)+",", "ur:", unready))
+	reveal := "off"
+	if room.EnableReveal {
+		reveal = fmt.Sprintf("%ds", room.RevealDelay)
+	}
+	buf.WriteString(fmt.Sprintf("%-5s%-5v%-5s%-5v\n", "rs:", room.RematchSeats+",", "rv:", reveal))
+	if room.Private {
+		code := "********"
+		if room.Creator == currPlayer.ID {
+			code = "expired"
+			if invite := database.GetInvite(room); invite != nil {
+				code = invite.Code
 			}
-		} else {
-			pwd = "off"
 		}
-		buf.WriteString(fmt.Sprintf("%-5s%-20v\n", "pwd", pwd))
+		buf.WriteString(fmt.Sprintf("%-8s%-10v\n", "invite:", code))
 	}
 	_ = currPlayer.WriteString(buf.String())
 }
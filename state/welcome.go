@@ -16,6 +16,10 @@ func (*welcome) Next(player *database.Player) (consts.StateID, error) {
 	if err != nil {
 		return 0, player.WriteError(err)
 	}
+	// 通过邀请链接连接的玩家直接进入房间
+	if code := player.TakeInvite(); code != "" {
+		return joinByCode(player, code)
+	}
 	return consts.StateHome, nil
 }
 